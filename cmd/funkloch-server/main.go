@@ -16,13 +16,17 @@ import (
 func main() {
 	r := mux.NewRouter()
 	db100.Initialisation(&global.Conf.Connection)
+	db100.SetPackingPolicy(global.Conf.Packing)
+	db100.SetTimeouts(global.Conf.Timeouts)
 	//API Handler
 	//Setzt alle Routen zu den API Pfaden
 	apig := apiglobal.GetSubrouter("/api")
 	r.PathPrefix("/api").Handler(apig)
 	//1.0.0 Api Version
-	a100 := api100.GetSubrouter("/api/v100")
+	a100 := api100.GetSubrouter("/api/v100", db100.DefaultRepositories())
 	apig.PathPrefix("/v100").Handler(a100)
+	// The purge removes attachment files, so it starts once the api has set up the storage
+	db100.StartTrashPurge(global.Conf.Trash.RetentionDays)
 
 	log.Println("funkloch Server Running")
 	port := ":" + strconv.Itoa(global.Conf.Port)
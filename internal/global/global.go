@@ -21,6 +21,7 @@ const saltSize = 32
 
 const storeItemPrefix = 1
 const boxPrefix = 3
+const locationPrefix = 5
 
 type DBConnection struct {
 	Driver     string
@@ -47,10 +48,50 @@ func Exists(path string) (bool, error) {
 	return true, err
 }
 
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// StorageConfig selects where attachments are stored. Backend is "local" (default) or "s3".
+// MaxSize is the upload limit in bytes, ThumbnailSize the longest thumbnail edge in pixels.
+type StorageConfig struct {
+	Backend       string
+	Path          string
+	MaxSize       int64
+	ThumbnailSize int
+	S3            S3Config
+}
+
+// PackingConfig controls which boxes may be added to packinglists.
+type PackingConfig struct {
+	RefuseUnfixable          bool
+	RefuseOverdueInspections bool
+}
+
+// TrashConfig controls how long deleted rows are kept in the trash, 0 keeps them until purged manually.
+type TrashConfig struct {
+	RetentionDays int
+}
+
+// TimeoutConfig limits how long a request and the database queries of a request may run, in seconds.
+// 0 runs them without a limit.
+type TimeoutConfig struct {
+	Request int
+	Query   int
+}
+
 type Config struct {
 	Port       int
 	Connection DBConnection
 	TokenKey   string
+	Storage    StorageConfig
+	Packing    PackingConfig
+	Trash      TrashConfig
+	Timeouts   TimeoutConfig
 }
 
 func (c *Config) load() error {
@@ -89,6 +130,10 @@ func CreateBoxCode(id int) string {
 	return CreateCode(boxPrefix, id)
 }
 
+func CreateLocationCode(id int) string {
+	return CreateCode(locationPrefix, id)
+}
+
 func CreateCode(prefix, id int) string {
 	pre := strconv.Itoa(prefix)
 	ids := strconv.Itoa(id)
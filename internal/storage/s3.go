@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Chaosvermittlung/funkloch-server/internal/global"
+)
+
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3 stores the files in a bucket of an S3 compatible object store. Requests use
+// path-style addressing and AWS signature version 4, so MinIO and similar servers work as well.
+type S3 struct {
+	Config global.S3Config
+	Client *http.Client
+	now    func() time.Time
+}
+
+func NewS3(c global.S3Config) (*S3, error) {
+	if c.Endpoint == "" || c.Bucket == "" {
+		return nil, errors.New("S3 storage needs an endpoint and a bucket")
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	return &S3{Config: c, Client: http.DefaultClient, now: time.Now}, nil
+}
+
+func (s *S3) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.Config.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	u.Path = u.Path + "/" + s.Config.Bucket + "/" + key
+	return u, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign adds the signature version 4 authorization header to the request.
+func (s *S3) sign(r *http.Request) {
+	t := s.now().UTC()
+	amzdate := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+	r.Header.Set("x-amz-date", amzdate)
+	r.Header.Set("x-amz-content-sha256", s3UnsignedPayload)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		"host:" + r.URL.Host + "\nx-amz-content-sha256:" + s3UnsignedPayload + "\nx-amz-date:" + amzdate + "\n",
+		strings.Join(signed, ";"),
+		s3UnsignedPayload,
+	}, "\n")
+	scope := day + "/" + s.Config.Region + "/s3/aws4_request"
+	ch := sha256.Sum256([]byte(canonical))
+	tosign := "AWS4-HMAC-SHA256\n" + amzdate + "\n" + scope + "\n" + hex.EncodeToString(ch[:])
+	k := hmacSHA256([]byte("AWS4"+s.Config.SecretKey), day)
+	k = hmacSHA256(k, s.Config.Region)
+	k = hmacSHA256(k, "s3")
+	k = hmacSHA256(k, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(k, tosign))
+	r.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.Config.AccessKey+"/"+scope+", SignedHeaders="+strings.Join(signed, ";")+", Signature="+sig)
+}
+
+func (s *S3) do(method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		r.ContentLength = size
+		r.Header.Set("Content-Type", contentType)
+	}
+	s.sign(r)
+	res, err := s.Client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		res.Body.Close()
+		return nil, errors.New("S3 " + method + " failed with status " + strconv.Itoa(res.StatusCode) + ": " + string(msg))
+	}
+	return res, nil
+}
+
+func (s *S3) Put(key string, r io.Reader, size int64, contentType string) error {
+	res, err := s.do("PUT", key, r, size, contentType)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	res, err := s.do("GET", key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *S3) Delete(key string) error {
+	res, err := s.do("DELETE", key, nil, 0, "")
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
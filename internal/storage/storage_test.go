@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Chaosvermittlung/funkloch-server/internal/global"
+)
+
+// s3Standin is a minimal in-memory object store answering PUT, GET and DELETE on /bucket/key.
+type s3Standin struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *s3Standin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case "PUT":
+		b, _ := ioutil.ReadAll(r.Body)
+		s.objects[r.URL.Path] = b
+	case "GET":
+		b, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(b)
+	case "DELETE":
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func testBackend(t *testing.T, b Backend) {
+	data := []byte("Handbuch")
+	err := b.Put("item/1/manual", bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	o, err := b.Get("item/1/manual")
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	got, _ := ioutil.ReadAll(o)
+	o.Close()
+	if !bytes.Equal(got, data) {
+		t.Errorf("Expected %s but got %s", data, got)
+	}
+	err = b.Delete("item/1/manual")
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	_, err = b.Get("item/1/manual")
+	if err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound but got %v", err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "funkloch-storage")
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	b, err := New(global.StorageConfig{Backend: "local", Path: dir})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	testBackend(t, b)
+	err = b.Put("../escape", bytes.NewReader(nil), 0, "")
+	if err == nil {
+		t.Error("Expected error storing outside the root")
+	}
+}
+
+func TestS3(t *testing.T) {
+	srv := httptest.NewServer(&s3Standin{objects: make(map[string][]byte)})
+	defer srv.Close()
+	b, err := New(global.StorageConfig{Backend: "s3", S3: global.S3Config{Endpoint: srv.URL, Bucket: "funkloch", AccessKey: "key", SecretKey: "secret"}})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	testBackend(t, b)
+}
+
+func TestThumbnail(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	for x := 0; x < 800; x++ {
+		img.Set(x, x%400, color.RGBA{255, 0, 0, 255})
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	thumb, err := Thumbnail(&buf, 200)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	c, err := jpeg.DecodeConfig(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if c.Width != 200 || c.Height != 100 {
+		t.Errorf("Expected 200x100 but got %vx%v", c.Width, c.Height)
+	}
+}
+
+func TestThumbnailTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	// Declare 100000x100000 pixels in the IHDR chunk and fix its checksum.
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b[16:20], 100000)
+	binary.BigEndian.PutUint32(b[20:24], 100000)
+	binary.BigEndian.PutUint32(b[29:33], crc32.ChecksumIEEE(b[12:29]))
+	_, err = Thumbnail(bytes.NewReader(b), 200)
+	if err != ErrImageTooLarge {
+		t.Errorf("Expected ErrImageTooLarge but got %v", err)
+	}
+}
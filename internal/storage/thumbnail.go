@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+const DefaultThumbnailSize = 256
+
+// MaxThumbnailPixels limits the size of the images thumbnails are made of. The size is read
+// from the header before decoding, so a small file can not make the server allocate a huge image.
+const MaxThumbnailPixels = 40 * 1000 * 1000
+
+// ErrImageTooLarge is returned for images with more than MaxThumbnailPixels pixels.
+var ErrImageTooLarge = errors.New("image is too large for a thumbnail")
+
+// Thumbnail decodes a JPEG, PNG or GIF image and returns a JPEG scaled down so that
+// its longer edge is at most max pixels. Each target pixel is the average of its source area.
+func Thumbnail(r io.Reader, max int) ([]byte, error) {
+	if max <= 0 {
+		max = DefaultThumbnailSize
+	}
+	var head bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxThumbnailPixels {
+		return nil, ErrImageTooLarge
+	}
+	src, _, err := image.Decode(io.MultiReader(&head, r))
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > max || h > max {
+		if w >= h {
+			tw, th = max, h*max/w
+		} else {
+			tw, th = w*max/h, max
+		}
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, (y+1)*h/th
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, (x+1)*w/tw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var sr, sg, sb, sa, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+					sr += cr >> 8
+					sg += cg >> 8
+					sb += cb >> 8
+					sa += ca >> 8
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(sr / n), uint8(sg / n), uint8(sb / n), uint8(sa / n)})
+		}
+	}
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	return buf.Bytes(), err
+}
@@ -0,0 +1,134 @@
+package api100
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/carbocation/interpose"
+)
+
+func getAssetRouter(prefix string) *interpose.Middleware {
+	r, m := GetNewSubrouter(prefix)
+	r.HandleFunc("/report", getAssetReportHandler).Methods("GET")
+	r.HandleFunc("/report/csv", getAssetReportCSVHandler).Methods("GET")
+	r.HandleFunc("/disposal", getDisposalReportHandler).Methods("GET")
+	r.HandleFunc("/disposal/csv", getDisposalReportCSVHandler).Methods("GET")
+	return m
+}
+
+// getAssetDate returns the date of ?date=YYYY-MM-DD, defaulting to now.
+func getAssetDate(r *http.Request) (time.Time, error) {
+	d := r.URL.Query().Get("date")
+	if d == "" {
+		return time.Now(), nil
+	}
+	at, err := time.Parse("2006-01-02", d)
+	if err != nil {
+		return at, errors.New("Error converting date: " + err.Error())
+	}
+	return at, nil
+}
+
+func getAssetReportHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	at, err := getAssetDate(r)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	ar, err := db100.GetAssetReport(r.Context(), at)
+	if err != nil {
+		dberror(w, r, "Error creating Asset report", err)
+		return
+	}
+	j, err := json.Marshal(&ar)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getAssetReportCSVHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "item"
+	}
+	if by != "item" && by != "store" && by != "equipment" {
+		apierror(w, r, "Unknown grouping "+by+", use item, store or equipment", http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	at, err := getAssetDate(r)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	ar, err := db100.GetAssetReport(r.Context(), at)
+	if err != nil {
+		dberror(w, r, "Error creating Asset report", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"assets-"+by+"-"+ar.Date.Format("2006-01-02")+".csv\"")
+	err = writeAssetReportCSV(w, ar, by)
+	if err != nil {
+		apierror(w, r, "Error writing CSV: "+err.Error(), http.StatusInternalServerError, ERROR_FILEERROR)
+		return
+	}
+}
+
+func formatCents(c int) string {
+	sign := ""
+	if c < 0 {
+		sign = "-"
+		c = -c
+	}
+	return fmt.Sprintf("%v%d.%02d", sign, c/100, c%100)
+}
+
+func writeAssetReportCSV(w io.Writer, ar db100.AssetReport, by string) error {
+	cw := csv.NewWriter(w)
+	switch by {
+	case "item":
+		cw.Write([]string{"Code", "Equipment", "Serial", "Manufacturer", "Supplier", "Store", "Box", "PurchaseDate", "PurchasePrice", "CurrentValue"})
+		for _, a := range ar.Items {
+			pd := ""
+			if !a.Item.PurchaseDate.IsZero() {
+				pd = a.Item.PurchaseDate.Format("2006-01-02")
+			}
+			cw.Write([]string{strconv.Itoa(a.Item.ItemCode), a.Item.EquipmentName, a.Item.Serial, a.Item.Manufacturer, a.Item.Supplier, a.Item.StoreName, a.Item.BoxDescription, pd, formatCents(a.Item.PurchasePrice), formatCents(a.CurrentValue)})
+		}
+		cw.Write([]string{"Total", "", "", "", "", "", "", "", formatCents(ar.PurchaseValue), formatCents(ar.CurrentValue)})
+	default:
+		vv := ar.Stores
+		if by == "equipment" {
+			vv = ar.Equipment
+		}
+		cw.Write([]string{"ID", "Name", "Count", "PurchaseValue", "CurrentValue"})
+		for _, v := range vv {
+			cw.Write([]string{strconv.Itoa(v.ID), v.Name, strconv.Itoa(v.Count), formatCents(v.PurchaseValue), formatCents(v.CurrentValue)})
+		}
+		cw.Write([]string{"Total", "", strconv.Itoa(len(ar.Items)), formatCents(ar.PurchaseValue), formatCents(ar.CurrentValue)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
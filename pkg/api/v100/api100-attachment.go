@@ -0,0 +1,324 @@
+package api100
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Chaosvermittlung/funkloch-server/internal/global"
+	"github.com/Chaosvermittlung/funkloch-server/internal/storage"
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/carbocation/interpose"
+	"github.com/gorilla/mux"
+)
+
+const defaultAttachmentMaxSize = 10 << 20
+
+var attachmentStorage storage.Backend
+
+func getAttachmentRouter(prefix string) *interpose.Middleware {
+	var err error
+	attachmentStorage, err = storage.New(global.Conf.Storage)
+	if err != nil {
+		log.Println("Attachment storage not available:", err)
+	}
+	db100.SetAttachmentStorage(attachmentStorage)
+	r, m := GetNewSubrouter(prefix)
+	r.HandleFunc("/{Type:item|box|equipment|fault|event}/{ID:[0-9]+}", postAttachmentHandler).Methods("POST")
+	r.HandleFunc("/{Type:item|box|equipment|fault|event}/{ID:[0-9]+}", listAttachmentsHandler).Methods("GET")
+	r.HandleFunc("/{AID:[0-9]+}", getAttachmentHandler).Methods("GET")
+	r.HandleFunc("/{AID:[0-9]+}", deleteAttachmentHandler).Methods("DELETE")
+	r.HandleFunc("/{AID:[0-9]+}/file", getAttachmentFileHandler).Methods("GET")
+	r.HandleFunc("/{AID:[0-9]+}/thumbnail", getAttachmentThumbnailHandler).Methods("GET")
+	return m
+}
+
+func attachmentMaxSize() int64 {
+	if global.Conf.Storage.MaxSize > 0 {
+		return global.Conf.Storage.MaxSize
+	}
+	return defaultAttachmentMaxSize
+}
+
+// hashAttachment returns the hex encoded MD5 and SHA-256 sums of the uploaded file
+// and rewinds it for storing.
+func hashAttachment(f multipart.File) (string, string, error) {
+	hm := md5.New()
+	hs := sha256.New()
+	_, err := io.Copy(io.MultiWriter(hm, hs), f)
+	if err != nil {
+		return "", "", err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return hex.EncodeToString(hm.Sum(nil)), hex.EncodeToString(hs.Sum(nil)), err
+}
+
+// inlineContentTypes are the types served inline, every other file is served as a download so
+// that uploaded HTML or scripts are never run by a browser on the origin of the api.
+var inlineContentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/bmp":  true,
+}
+
+// attachmentContentType sniffs the type of the uploaded file from its content, the type sent
+// by the client is not trusted.
+func attachmentContentType(f multipart.File) (string, error) {
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return http.DetectContentType(buf[:n]), err
+}
+
+func postAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	if attachmentStorage == nil {
+		apierror(w, r, "Attachment storage not configured", http.StatusInternalServerError, ERROR_FILEERROR)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["ID"])
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	a := db100.Attachment{OwnerType: db100.AttachmentOwner(vars["Type"]), OwnerID: id}
+	err = a.CheckOwner(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Attachment owner", err)
+		return
+	}
+	max := attachmentMaxSize()
+	r.Body = http.MaxBytesReader(w, r.Body, max+1<<20)
+	err = r.ParseMultipartForm(1 << 20)
+	if err != nil {
+		apierror(w, r, "Error reading upload: "+err.Error(), http.StatusRequestEntityTooLarge, ERROR_FILEERROR)
+		return
+	}
+	f, fh, err := r.FormFile("file")
+	if err != nil {
+		apierror(w, r, "Error reading upload: "+err.Error(), http.StatusBadRequest, ERROR_FILEERROR)
+		return
+	}
+	defer f.Close()
+	if fh.Size > max {
+		apierror(w, r, "File is larger than "+strconv.FormatInt(max, 10)+" bytes", http.StatusRequestEntityTooLarge, ERROR_FILEERROR)
+		return
+	}
+	a.MD5, a.SHA256, err = hashAttachment(f)
+	if err != nil {
+		apierror(w, r, "Error hashing upload: "+err.Error(), http.StatusInternalServerError, ERROR_FILEERROR)
+		return
+	}
+	if m := r.FormValue("md5"); m != "" && !strings.EqualFold(m, a.MD5) {
+		apierror(w, r, "MD5 mismatch: got "+a.MD5, http.StatusBadRequest, ERROR_FILEHASH)
+		return
+	}
+	if s := r.FormValue("sha256"); s != "" && !strings.EqualFold(s, a.SHA256) {
+		apierror(w, r, "SHA-256 mismatch: got "+a.SHA256, http.StatusBadRequest, ERROR_FILEHASH)
+		return
+	}
+	a.ContentType, err = attachmentContentType(f)
+	if err != nil {
+		apierror(w, r, "Error reading upload: "+err.Error(), http.StatusInternalServerError, ERROR_FILEERROR)
+		return
+	}
+	a.Filename = fh.Filename
+	a.Size = fh.Size
+	a.StorageKey = fmt.Sprintf("%v/%v/%v-%v", a.OwnerType, a.OwnerID, a.SHA256[:16], time.Now().UnixNano())
+	err = attachmentStorage.Put(a.StorageKey, f, a.Size, a.ContentType)
+	if err != nil {
+		apierror(w, r, "Error storing file: "+err.Error(), http.StatusInternalServerError, ERROR_FILEERROR)
+		return
+	}
+	if inlineContentTypes[a.ContentType] {
+		_, err = f.Seek(0, io.SeekStart)
+		if err == nil {
+			thumb, err := storage.Thumbnail(f, global.Conf.Storage.ThumbnailSize)
+			if err == nil {
+				tk := a.StorageKey + ".thumb.jpg"
+				err = attachmentStorage.Put(tk, bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg")
+				if err == nil {
+					a.ThumbnailKey = tk
+				}
+			}
+		}
+	}
+	u, err := getUserfromRequest(r)
+	if err == nil {
+		a.UploaderID = u.UserID
+	}
+	err = a.Insert(r.Context())
+	if err != nil {
+		attachmentStorage.Delete(a.StorageKey)
+		if a.ThumbnailKey != "" {
+			attachmentStorage.Delete(a.ThumbnailKey)
+		}
+		dberror(w, r, "Error Inserting Attachment", err)
+		return
+	}
+	j, err := json.Marshal(&a)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func listAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["ID"])
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	aa, err := db100.GetAttachments(r.Context(), db100.AttachmentOwner(vars["Type"]), id)
+	if err != nil {
+		dberror(w, r, "Error fetching Attachments", err)
+		return
+	}
+	j, err := json.Marshal(&aa)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getAttachmentfromRequest(w http.ResponseWriter, r *http.Request) (db100.Attachment, bool) {
+	var a db100.Attachment
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return a, false
+	}
+	vars := mux.Vars(r)
+	a.AttachmentID, err = strconv.Atoi(vars["AID"])
+	if err != nil {
+		apierror(w, r, "Error converting Attachment ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return a, false
+	}
+	err = a.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Attachment", err)
+		return a, false
+	}
+	return a, true
+}
+
+func getAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	a, ok := getAttachmentfromRequest(w, r)
+	if !ok {
+		return
+	}
+	j, err := json.Marshal(&a)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func writeAttachmentObject(w http.ResponseWriter, r *http.Request, key, contentType, filename string, size int64) {
+	if attachmentStorage == nil {
+		apierror(w, r, "Attachment storage not configured", http.StatusInternalServerError, ERROR_FILEERROR)
+		return
+	}
+	o, err := attachmentStorage.Get(key)
+	if err == storage.ErrNotFound {
+		apierror(w, r, "File not found in storage", http.StatusNotFound, ERROR_NOTFOUND)
+		return
+	}
+	if err != nil {
+		apierror(w, r, "Error reading file: "+err.Error(), http.StatusInternalServerError, ERROR_FILEERROR)
+		return
+	}
+	defer o.Close()
+	if size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	disposition := "attachment"
+	if inlineContentTypes[contentType] {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", disposition+"; filename=\""+strings.Replace(filename, "\"", "", -1)+"\"")
+	io.Copy(w, o)
+}
+
+func getAttachmentFileHandler(w http.ResponseWriter, r *http.Request) {
+	a, ok := getAttachmentfromRequest(w, r)
+	if !ok {
+		return
+	}
+	writeAttachmentObject(w, r, a.StorageKey, a.ContentType, a.Filename, a.Size)
+}
+
+func getAttachmentThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	a, ok := getAttachmentfromRequest(w, r)
+	if !ok {
+		return
+	}
+	if a.ThumbnailKey == "" {
+		apierror(w, r, "Attachment has no thumbnail", http.StatusNotFound, ERROR_NOTFOUND)
+		return
+	}
+	writeAttachmentObject(w, r, a.ThumbnailKey, "image/jpeg", "thumb-"+a.Filename+".jpg", 0)
+}
+
+func deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	a, ok := getAttachmentfromRequest(w, r)
+	if !ok {
+		return
+	}
+	if attachmentStorage == nil {
+		apierror(w, r, "Attachment storage not configured", http.StatusInternalServerError, ERROR_FILEERROR)
+		return
+	}
+	err := a.Delete(r.Context())
+	if err != nil {
+		dberror(w, r, "Error deleting Attachment", err)
+		return
+	}
+	// The row is gone, a file that can not be deleted is only left behind in the storage.
+	for _, k := range []string{a.StorageKey, a.ThumbnailKey} {
+		if k == "" {
+			continue
+		}
+		err = attachmentStorage.Delete(k)
+		if err != nil && err != storage.ErrNotFound {
+			log.Println("Error deleting attachment file "+k+":", err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package api100
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/gorilla/mux"
+)
+
+const attributeFilterPrefix = "attr."
+
+// parseAttributeFilters reads filters like ?attr.length>=10 from the query. The query parser
+// splits at the first '=', so "attr.length>=10" arrives as key "attr.length>" and value "10",
+// while "attr.length>10" arrives as key "attr.length>10" with an empty value.
+func parseAttributeFilters(q url.Values) ([]db100.AttributeFilter, error) {
+	var ff []db100.AttributeFilter
+	for k, vv := range q {
+		if !strings.HasPrefix(k, attributeFilterPrefix) {
+			continue
+		}
+		k = strings.TrimPrefix(k, attributeFilterPrefix)
+		for _, v := range vv {
+			var f db100.AttributeFilter
+			switch {
+			case strings.HasSuffix(k, ">") || strings.HasSuffix(k, "<") || strings.HasSuffix(k, "!"):
+				f = db100.AttributeFilter{Name: k[:len(k)-1], Op: k[len(k)-1:] + "=", Value: v}
+			case v != "":
+				f = db100.AttributeFilter{Name: k, Op: "=", Value: v}
+			default:
+				n := strings.IndexAny(k, "<>")
+				if n < 1 {
+					return ff, errors.New("Attribute filter " + k + " has no value")
+				}
+				f = db100.AttributeFilter{Name: k[:n], Op: k[n : n+1], Value: k[n+1:]}
+			}
+			if f.Name == "" {
+				return ff, errors.New("Attribute filter without name")
+			}
+			ff = append(ff, f)
+		}
+	}
+	return ff, nil
+}
+
+func getEquipmentAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	e := db100.Equipment{EquipmentID: id}
+	aa, err := e.GetAttributes(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Attributes", err)
+		return
+	}
+	j, err := json.Marshal(&aa)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func postEquipmentAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var a db100.Attribute
+	err = decoder.Decode(&a)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	a.AttributeID = 0
+	a.EquipmentID = id
+	err = a.Insert(r.Context())
+	if err != nil {
+		dberror(w, r, "Error Inserting Attribute", err)
+		return
+	}
+	j, err := json.Marshal(&a)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func patchEquipmentAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	ai := vars["AID"]
+	aid, err := strconv.Atoi(ai)
+	if err != nil {
+		apierror(w, r, "Error converting Attribute ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	a := db100.Attribute{AttributeID: aid}
+	err = a.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Attribute", err)
+		return
+	}
+	err = mergePatch(r, &a)
+	if err != nil {
+		patcherror(w, r, "Error patching Attribute", err)
+		return
+	}
+	a.AttributeID = aid
+	err = a.Update(r.Context())
+	if err != nil {
+		dberror(w, r, "Error updating Attribute", err)
+		return
+	}
+	j, err := json.Marshal(&a)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func deleteEquipmentAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	ai := vars["AID"]
+	aid, err := strconv.Atoi(ai)
+	if err != nil {
+		apierror(w, r, "Error converting Attribute ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	a := db100.Attribute{AttributeID: aid}
+	err = a.Delete(r.Context())
+	if err != nil {
+		dberror(w, r, "Error deleting Attribute", err)
+		return
+	}
+}
+
+func getItemAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	it := db100.Item{ItemID: id}
+	ia, err := it.GetAttributes(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Item Attributes", err)
+		return
+	}
+	j, err := json.Marshal(&ia)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func putItemAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var values map[string]string
+	err = decoder.Decode(&values)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	it := db100.Item{ItemID: id}
+	ia, err := it.SetAttributes(r.Context(), values)
+	if err != nil {
+		dberror(w, r, "Error setting Item Attributes", err)
+		return
+	}
+	j, err := json.Marshal(&ia)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
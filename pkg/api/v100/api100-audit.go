@@ -0,0 +1,259 @@
+package api100
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/carbocation/interpose"
+	"github.com/gorilla/mux"
+)
+
+func getAuditRouter(prefix string) *interpose.Middleware {
+	r, m := GetNewSubrouter(prefix)
+	r.HandleFunc("/", postAuditHandler).Methods("POST")
+	r.HandleFunc("/list", listAuditsHandler).Methods("GET")
+	r.HandleFunc("/{ID}", getAuditHandler).Methods("GET")
+	r.HandleFunc("/{ID}", deleteAuditHandler).Methods("DELETE")
+	r.HandleFunc("/{ID}/scan/{Code}", scanAuditHandler).Methods("POST")
+	r.HandleFunc("/{ID}/close", closeAuditHandler).Methods("POST")
+	r.HandleFunc("/{ID}/result", getAuditResultHandler).Methods("GET")
+	r.HandleFunc("/{ID}/apply", applyAuditHandler).Methods("POST")
+	return m
+}
+
+func postAuditHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var a db100.Audit
+	err = decoder.Decode(&a)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	err = a.Insert(r.Context())
+	if err != nil {
+		dberror(w, r, "Error starting Audit", err)
+		return
+	}
+	j, err := json.Marshal(&a)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func listAuditsHandler(w http.ResponseWriter, r *http.Request) {
+	lq, err := getListQuery(r)
+	if err != nil {
+		dberror(w, r, "Error fetching Audits", err)
+		return
+	}
+	aa, p, err := db100.GetAuditsPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Audits", err)
+		return
+	}
+	j, err := json.Marshal(&aa)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	setListPage(w, p)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getAuditHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	a := db100.Audit{AuditID: id}
+	err = a.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Audit", err)
+		return
+	}
+	j, err := json.Marshal(&a)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func deleteAuditHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	a := db100.Audit{AuditID: id}
+	err = a.Delete(r.Context())
+	if err != nil {
+		dberror(w, r, "Error deleting Audit", err)
+		return
+	}
+}
+
+func scanAuditHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	c := vars["Code"]
+	code, err := strconv.Atoi(c)
+	if err != nil {
+		apierror(w, r, "Error converting Code: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	boxcode := 0
+	bc := r.URL.Query().Get("box")
+	if bc != "" {
+		boxcode, err = strconv.Atoi(bc)
+		if err != nil {
+			apierror(w, r, "Error converting Box Code: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+	}
+	a := db100.Audit{AuditID: id}
+	as, err := a.Scan(r.Context(), code, boxcode)
+	if err != nil {
+		dberror(w, r, "Error scanning Audit", err)
+		return
+	}
+	j, err := json.Marshal(&as)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func closeAuditHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	a := db100.Audit{AuditID: id}
+	ar, err := a.Close(r.Context())
+	if err != nil {
+		dberror(w, r, "Error closing Audit", err)
+		return
+	}
+	j, err := json.Marshal(&ar)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getAuditResultHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	a := db100.Audit{AuditID: id}
+	ar, err := a.GetResult(r.Context())
+	if err != nil {
+		dberror(w, r, "Error getting Audit result", err)
+		return
+	}
+	j, err := json.Marshal(&ar)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func applyAuditHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	var cc []db100.AuditCorrection
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		err = decoder.Decode(&cc)
+		if err != nil {
+			apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+			return
+		}
+	}
+	a := db100.Audit{AuditID: id}
+	cc, err = a.Apply(r.Context(), cc)
+	if err != nil {
+		dberror(w, r, "Error applying Audit corrections", err)
+		return
+	}
+	j, err := json.Marshal(&cc)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
@@ -10,25 +10,38 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func getBoxRouter(prefix string) *interpose.Middleware {
+// boxHandlers serve the box endpoints from the repositories the router was built with.
+type boxHandlers struct {
+	repo db100.Repositories
+}
+
+func getBoxRouter(prefix string, repo db100.Repositories) *interpose.Middleware {
+	h := boxHandlers{repo}
 	r, m := GetNewSubrouter(prefix)
-	r.HandleFunc("/", postBoxHandler).Methods("POST")
-	r.HandleFunc("/list", listBoxesHandler).Methods("GET")
-	r.HandleFunc("/{ID}", getBoxHandler).Methods("GET")
-	r.HandleFunc("/{ID}", patchBoxHandler).Methods("PATCH")
-	r.HandleFunc("/{ID}", deleteBoxHandler).Methods("DELETE")
-	r.HandleFunc("/{ID}/items", getBoxItemsHandler).Methods("GET")
-	r.HandleFunc("/{ID}/items/{IID}", addItemtoBoxHandler).Methods("POST")
-	r.HandleFunc("/{ID}/items/{IID}", removeItemfromBoxHandler).Methods("DELETE")
+	r.HandleFunc("/", h.postBoxHandler).Methods("POST")
+	r.HandleFunc("/list", h.listBoxesHandler).Methods("GET")
+	r.HandleFunc("/{ID}", h.getBoxHandler).Methods("GET")
+	r.HandleFunc("/{ID}", h.patchBoxHandler).Methods("PATCH")
+	r.HandleFunc("/{ID}", h.deleteBoxHandler).Methods("DELETE")
+	r.HandleFunc("/{ID}/items", h.getBoxItemsHandler).Methods("GET")
+	r.HandleFunc("/{ID}/location", getBoxLocationHandler).Methods("GET")
+	r.HandleFunc("/{ID}/location/{LID}", putAwayBoxHandler).Methods("POST")
+	r.HandleFunc("/{ID}/items/{IID}", h.addItemtoBoxHandler).Methods("POST")
+	r.HandleFunc("/{ID}/items/{IID}", h.removeItemfromBoxHandler).Methods("DELETE")
 	return m
 }
 
 func convertBoxListEntryinBoxResponse(b db100.BoxlistEntry) boxResponse {
 	var br boxResponse
 	br.Box.BoxID = b.BoxID
+	br.Box.Version = b.Version
 	br.Box.Code = b.Code
 	br.Box.Description = b.Description
 	br.Box.Weight = b.Weight
+	br.Box.Length = b.Length
+	br.Box.Width = b.Width
+	br.Box.Height = b.Height
+	br.Box.LocationID = b.LocationID
 	br.Store.StoreID = b.StoreID
 	br.Store.Adress = b.Adress
 	br.Store.ManagerID = b.ManagerID
@@ -49,7 +62,7 @@ func convertBoxListinBoxResponseList(bb []db100.BoxlistEntry) []boxResponse {
 	return res
 }
 
-func postBoxHandler(w http.ResponseWriter, r *http.Request) {
+func (h boxHandlers) postBoxHandler(w http.ResponseWriter, r *http.Request) {
 	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
 	if err != nil {
 		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
@@ -62,9 +75,10 @@ func postBoxHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
 		return
 	}
-	err = b.Insert()
+	// The posted items are inserted together with the new box
+	err = h.repo.Boxes.Insert(r.Context(), &b)
 	if err != nil {
-		apierror(w, r, "Error Inserting Box: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error Inserting Box", err)
 		return
 	}
 	j, err := json.Marshal(&b)
@@ -77,10 +91,15 @@ func postBoxHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(j)
 }
 
-func listBoxesHandler(w http.ResponseWriter, r *http.Request) {
-	bb, err := db100.GetBoxesJoined()
+func (h boxHandlers) listBoxesHandler(w http.ResponseWriter, r *http.Request) {
+	lq, err := getListQuery(r)
+	if err != nil {
+		dberror(w, r, "Error fetching Boxes", err)
+		return
+	}
+	bb, p, err := h.repo.Boxes.List(r.Context(), lq)
 	if err != nil {
-		apierror(w, r, "Error fetching Boxes: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Boxes", err)
 		return
 	}
 	res := convertBoxListinBoxResponseList(bb)
@@ -90,11 +109,12 @@ func listBoxesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setListPage(w, p)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(j)
 }
 
-func getBoxHandler(w http.ResponseWriter, r *http.Request) {
+func (h boxHandlers) getBoxHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	i := vars["ID"]
 	id, err := strconv.Atoi(i)
@@ -102,11 +122,9 @@ func getBoxHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	var b db100.Box
-	b.BoxID = id
-	ble, err := b.GetFullDetails()
+	ble, err := h.repo.Boxes.GetFull(r.Context(), id)
 	if err != nil {
-		apierror(w, r, "Error fetching Box: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Box", err)
 		return
 	}
 	br := convertBoxListEntryinBoxResponse(ble)
@@ -116,11 +134,10 @@ func getBoxHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, br.Box.Version, j)
 }
 
-func patchBoxHandler(w http.ResponseWriter, r *http.Request) {
+func (h boxHandlers) patchBoxHandler(w http.ResponseWriter, r *http.Request) {
 	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
 	if err != nil {
 		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
@@ -133,17 +150,25 @@ func patchBoxHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	decoder := json.NewDecoder(r.Body)
-	var b db100.Box
-	err = decoder.Decode(&b)
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	b, err := h.repo.Boxes.Get(r.Context(), id)
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		dberror(w, r, "Error fetching Box", err)
+		return
+	}
+	err = mergePatch(r, &b)
+	if err != nil {
+		patcherror(w, r, "Error patching Box", err)
 		return
 	}
 	b.BoxID = id
-	err = b.Update()
+	b.Version = v
+	err = h.repo.Boxes.Update(r.Context(), &b)
 	if err != nil {
-		apierror(w, r, "Error updating Equipment: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error updating Equipment", err)
 		return
 	}
 	j, err := json.Marshal(&b)
@@ -152,11 +177,10 @@ func patchBoxHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, b.Version, j)
 }
 
-func deleteBoxHandler(w http.ResponseWriter, r *http.Request) {
+func (h boxHandlers) deleteBoxHandler(w http.ResponseWriter, r *http.Request) {
 	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
 	if err != nil {
 		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
@@ -169,15 +193,22 @@ func deleteBoxHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	b := db100.Box{BoxID: id}
-	err = b.Delete()
+	cur, err := h.repo.Boxes.Get(r.Context(), id)
 	if err != nil {
-		apierror(w, r, "Error deleting StoreItem: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Box", err)
+		return
+	}
+	if !matchVersion(w, r, "Box", id, cur.Version) {
+		return
+	}
+	err = h.repo.Boxes.Delete(r.Context(), id)
+	if err != nil {
+		dberror(w, r, "Error deleting StoreItem", err)
 		return
 	}
 }
 
-func getBoxItemsHandler(w http.ResponseWriter, r *http.Request) {
+func (h boxHandlers) getBoxItemsHandler(w http.ResponseWriter, r *http.Request) {
 	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
 	if err != nil {
 		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
@@ -190,12 +221,9 @@ func getBoxItemsHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	var b db100.Box
-	b.BoxID = id
-
-	ile, err := b.GetBoxItemsJoined()
+	ile, err := h.repo.Boxes.Items(r.Context(), id)
 	if err != nil {
-		apierror(w, r, "Error getting Box Items: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error getting Box Items", err)
 		return
 	}
 	ir := convertItemListinItemResponseList(ile)
@@ -208,7 +236,7 @@ func getBoxItemsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(j)
 }
 
-func addItemtoBoxHandler(w http.ResponseWriter, r *http.Request) {
+func (h boxHandlers) addItemtoBoxHandler(w http.ResponseWriter, r *http.Request) {
 	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
 	if err != nil {
 		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
@@ -227,15 +255,14 @@ func addItemtoBoxHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting Item ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	it := db100.Item{ItemID: iid}
-	err = it.SetBox(id)
+	err = h.repo.Items.SetBox(r.Context(), iid, id)
 	if err != nil {
-		apierror(w, r, "Error updating Item: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		dberror(w, r, "Error updating Item", err)
 		return
 	}
 }
 
-func removeItemfromBoxHandler(w http.ResponseWriter, r *http.Request) {
+func (h boxHandlers) removeItemfromBoxHandler(w http.ResponseWriter, r *http.Request) {
 	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
 	if err != nil {
 		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
@@ -248,10 +275,61 @@ func removeItemfromBoxHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting Item ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	it := db100.Item{ItemID: iid}
-	err = it.SetBox(0)
+	err = h.repo.Items.SetBox(r.Context(), iid, 0)
+	if err != nil {
+		dberror(w, r, "Error updating Item", err)
+		return
+	}
+}
+
+func getBoxLocationHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	b := db100.Box{BoxID: id}
+	bl, err := b.GetLocation(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Box Location", err)
+		return
+	}
+	j, err := json.Marshal(&bl)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func putAwayBoxHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting Box ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	li := vars["LID"]
+	lid, err := strconv.Atoi(li)
+	if err != nil {
+		apierror(w, r, "Error converting Location ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	b := db100.Box{BoxID: id}
+	l := db100.Location{LocationID: lid}
+	err = b.PutAway(r.Context(), l)
 	if err != nil {
-		apierror(w, r, "Error updating Item: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		dberror(w, r, "Error putting away Box", err)
 		return
 	}
 }
@@ -0,0 +1,217 @@
+package api100
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/carbocation/interpose"
+	"github.com/gorilla/mux"
+)
+
+func getCategoryRouter(prefix string) *interpose.Middleware {
+	r, m := GetNewSubrouter(prefix)
+	r.HandleFunc("/", postCategoryHandler).Methods("POST")
+	r.HandleFunc("/list", listCategoriesHandler).Methods("GET")
+	r.HandleFunc("/tree", getCategoryTreeHandler).Methods("GET")
+	r.HandleFunc("/{ID}", getCategoryHandler).Methods("GET")
+	r.HandleFunc("/{ID}", deleteCategoryHandler).Methods("DELETE")
+	r.HandleFunc("/{ID}", patchCategoryHandler).Methods("PATCH")
+	r.HandleFunc("/{ID}/equipment", getCategoryEquipmentHandler).Methods("GET")
+
+	return m
+}
+
+func postCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var c db100.Category
+	err = decoder.Decode(&c)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	err = c.Insert(r.Context())
+	if err != nil {
+		dberror(w, r, "Error Inserting Category", err)
+		return
+	}
+	j, err := json.Marshal(&c)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func listCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	lq, err := getListQuery(r)
+	if err != nil {
+		dberror(w, r, "Error fetching Categories", err)
+		return
+	}
+	cc, p, err := db100.GetCategoriesPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Categories", err)
+		return
+	}
+	j, err := json.Marshal(&cc)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+	setListPage(w, p)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	c := db100.Category{CategoryID: id}
+	err = c.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Category", err)
+		return
+	}
+	j, err := json.Marshal(&c)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	writeVersioned(w, r, c.Version, j)
+}
+
+func patchCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	ca := db100.Category{CategoryID: id}
+	err = ca.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Category", err)
+		return
+	}
+	err = mergePatch(r, &ca)
+	if err != nil {
+		patcherror(w, r, "Error patching Category", err)
+		return
+	}
+	ca.CategoryID = id
+	ca.Version = v
+	err = ca.Update(r.Context())
+	if err != nil {
+		dberror(w, r, "Error updating Category", err)
+		return
+	}
+	j, err := json.Marshal(&ca)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	writeVersioned(w, r, ca.Version, j)
+}
+
+func deleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	if !checkIfMatch(w, r, &db100.Category{}, id) {
+		return
+	}
+	c := db100.Category{CategoryID: id}
+	err = c.Delete(r.Context())
+	if err != nil {
+		dberror(w, r, "Error deleting Category", err)
+		return
+	}
+}
+
+func getCategoryTreeHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	cn, err := db100.GetCategoryTree(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Category tree", err)
+		return
+	}
+	j, err := json.Marshal(&cn)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getCategoryEquipmentHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	c := db100.Category{CategoryID: id}
+	ee, err := c.GetCategoryEquipment(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Category Equipment", err)
+		return
+	}
+	j, err := json.Marshal(&ee)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
@@ -0,0 +1,210 @@
+package api100
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/carbocation/interpose"
+	"github.com/gorilla/mux"
+)
+
+func getConsumableRouter(prefix string) *interpose.Middleware {
+	r, m := GetNewSubrouter(prefix)
+	r.HandleFunc("/stock", putStockHandler).Methods("PUT")
+	r.HandleFunc("/stock/{Type:equipment|box|store}/{ID}", getStockHandler).Methods("GET")
+	r.HandleFunc("/consumption", postConsumptionHandler).Methods("POST")
+	r.HandleFunc("/consumption/list", listConsumptionsHandler).Methods("GET")
+	r.HandleFunc("/lowstock", getLowStockHandler).Methods("GET")
+	r.HandleFunc("/procurement", getProcurementWishlistHandler).Methods("GET")
+	return m
+}
+
+func putStockHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var s db100.Stock
+	err = decoder.Decode(&s)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	s.StockID = 0
+	s, err = db100.SetStock(r.Context(), s)
+	if err != nil {
+		dberror(w, r, "Error setting Stock", err)
+		return
+	}
+	j, err := json.Marshal(&s)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getStockHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	var ss []db100.Stock
+	switch vars["Type"] {
+	case "equipment":
+		e := db100.Equipment{EquipmentID: id}
+		ss, err = e.GetStock(r.Context())
+	case "box":
+		b := db100.Box{BoxID: id}
+		ss, err = b.GetBoxStock(r.Context())
+	case "store":
+		s := db100.Store{StoreID: id}
+		ss, err = s.GetStoreStock(r.Context())
+	}
+	if err != nil {
+		dberror(w, r, "Error fetching Stock", err)
+		return
+	}
+	j, err := json.Marshal(&ss)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func postConsumptionHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var c db100.Consumption
+	err = decoder.Decode(&c)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	c.ConsumptionID = 0
+	err = c.Insert(r.Context())
+	if err != nil {
+		dberror(w, r, "Error recording Consumption", err)
+		return
+	}
+	j, err := json.Marshal(&c)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func listConsumptionsHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	var eid, pid int
+	e := r.URL.Query().Get("event")
+	if e != "" {
+		eid, err = strconv.Atoi(e)
+		if err != nil {
+			apierror(w, r, "Error converting Event ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+	}
+	p := r.URL.Query().Get("packinglist")
+	if p != "" {
+		pid, err = strconv.Atoi(p)
+		if err != nil {
+			apierror(w, r, "Error converting Packinglist ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+	}
+	cc, err := db100.GetConsumptions(r.Context(), eid, pid)
+	if err != nil {
+		dberror(w, r, "Error fetching Consumptions", err)
+		return
+	}
+	j, err := json.Marshal(&cc)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getLowStockHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	ls, err := db100.GetLowStock(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching low Stock", err)
+		return
+	}
+	j, err := json.Marshal(&ls)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getProcurementWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	wl, err := db100.GetProcurementWishlist(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching procurement Wishlist", err)
+		return
+	}
+	var wcr wishlistContentResponse
+	wcr.Equipment, err = wl.GetWishlistItems(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Wishlist Equipment", err)
+		return
+	}
+	wcr.Categories, err = wl.GetWishlistCategories(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Wishlist Categories", err)
+		return
+	}
+	j, err := json.Marshal(&wcr)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
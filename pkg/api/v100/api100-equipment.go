@@ -17,6 +17,10 @@ func getEquipmentRouter(prefix string) *interpose.Middleware {
 	r.HandleFunc("/{ID}", getEquipmentHandler).Methods("GET")
 	r.HandleFunc("/{ID}", deleteEquipmentHandler).Methods("DELETE")
 	r.HandleFunc("/{ID}", patchEquipmentHandler).Methods("PATCH")
+	r.HandleFunc("/{ID}/attributes", getEquipmentAttributesHandler).Methods("GET")
+	r.HandleFunc("/{ID}/attributes", postEquipmentAttributeHandler).Methods("POST")
+	r.HandleFunc("/{ID}/attributes/{AID}", patchEquipmentAttributeHandler).Methods("PATCH")
+	r.HandleFunc("/{ID}/attributes/{AID}", deleteEquipmentAttributeHandler).Methods("DELETE")
 
 	return m
 }
@@ -34,9 +38,9 @@ func postEquipmentHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
 		return
 	}
-	err = e.Insert()
+	err = e.Insert(r.Context())
 	if err != nil {
-		apierror(w, r, "Error Inserting Equipment: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error Inserting Equipment", err)
 		return
 	}
 	j, err := json.Marshal(&e)
@@ -55,9 +59,23 @@ func listEquipmentHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
 		return
 	}
-	ee, err := db100.GetEquipment()
+	var cid int
+	ca := r.URL.Query().Get("category")
+	if ca != "" {
+		cid, err = strconv.Atoi(ca)
+		if err != nil {
+			apierror(w, r, "Error converting Category ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+	}
+	lq, err := getListQuery(r, "category")
 	if err != nil {
-		apierror(w, r, "Error fetching Equipment: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Equipment", err)
+		return
+	}
+	ee, p, err := db100.GetEquipmentPage(r.Context(), cid, lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Equipment", err)
 		return
 	}
 	j, err := json.Marshal(&ee)
@@ -65,6 +83,7 @@ func listEquipmentHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
 		return
 	}
+	setListPage(w, p)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(j)
 }
@@ -78,9 +97,9 @@ func getEquipmentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	e := db100.Equipment{EquipmentID: id}
-	err = e.GetDetails()
+	err = e.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, "Error fetching Equipment: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Equipment", err)
 		return
 	}
 	j, err := json.Marshal(&e)
@@ -89,8 +108,7 @@ func getEquipmentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, e.Version, j)
 }
 
 func patchEquipmentHandler(w http.ResponseWriter, r *http.Request) {
@@ -106,17 +124,26 @@ func patchEquipmentHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	decoder := json.NewDecoder(r.Body)
-	var equ db100.Equipment
-	err = decoder.Decode(&equ)
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	equ := db100.Equipment{EquipmentID: id}
+	err = equ.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		dberror(w, r, "Error fetching Equipment", err)
+		return
+	}
+	err = mergePatch(r, &equ)
+	if err != nil {
+		patcherror(w, r, "Error patching Equipment", err)
 		return
 	}
 	equ.EquipmentID = id
-	err = equ.Update()
+	equ.Version = v
+	err = equ.Update(r.Context())
 	if err != nil {
-		apierror(w, r, "Error updating Equipment: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error updating Equipment", err)
 		return
 	}
 	j, err := json.Marshal(&equ)
@@ -125,8 +152,7 @@ func patchEquipmentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, equ.Version, j)
 }
 
 func deleteEquipmentHandler(w http.ResponseWriter, r *http.Request) {
@@ -142,10 +168,13 @@ func deleteEquipmentHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
+	if !checkIfMatch(w, r, &db100.Equipment{}, id) {
+		return
+	}
 	e := db100.Equipment{EquipmentID: id}
-	err = e.Delete()
+	err = e.Delete(r.Context())
 	if err != nil {
-		apierror(w, r, "Error deleting Equipment: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error deleting Equipment", err)
 		return
 	}
 }
@@ -1,9 +1,20 @@
 package api100
 
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+)
+
+// ErrorResponse is the body of every error. Details lists the refused fields of the request.
 type ErrorResponse struct {
-	Httpstatus   string `json:"httpstatus"`
-	Errorcode    string `json:"errorcode"`
-	Errormessage string `json:"errormessage"`
+	Httpstatus   int          `json:"httpstatus"`
+	Errorcode    APIErrorcode `json:"errorcode"`
+	Errormessage string       `json:"errormessage"`
+	RequestID    string       `json:"requestid"`
+	Details      []FieldError `json:"details,omitempty"`
 }
 
 type APIErrorcode int
@@ -20,33 +31,89 @@ const (
 	ERROR_USERNOTAUTHORIZED
 	ERROR_INVALIDPARAMETER
 	ERROR_NOTFOUND
+	ERROR_TIMEOUT
+	ERROR_PRECONDITIONREQUIRED
+	ERROR_VERSIONCONFLICT
+	ERROR_VALIDATION
+	ERROR_CONFLICT
+	ERROR_CONSTRAINT
 )
 
+// ErrorDefinition documents an error code with the HTTP status it is usually answered with.
+type ErrorDefinition struct {
+	Code       APIErrorcode `json:"code"`
+	Name       string       `json:"name"`
+	Message    string       `json:"message"`
+	Httpstatus int          `json:"httpstatus"`
+}
+
+// apiErrors is the catalogue of the error codes, served by GET /errors.
+var apiErrors = []ErrorDefinition{
+	{ERROR_WRONGCREDENTIALS, "WRONGCREDENTIALS", "Wrong Username or Password", http.StatusUnauthorized},
+	{ERROR_DBQUERYFAILED, "DBQUERYFAILED", "Database Query failed", http.StatusInternalServerError},
+	{ERROR_MALFORMEDAUTH, "MALFORMEDAUTH", "Authorization request is malformed", http.StatusUnauthorized},
+	{ERROR_NOHASH, "NOHASH", "Could not generate Hash from Password", http.StatusInternalServerError},
+	{ERROR_NOTOKEN, "NOTOKEN", "Could not generate Token", http.StatusInternalServerError},
+	{ERROR_JSONERROR, "JSONERROR", "JSON Marshal error", http.StatusBadRequest},
+	{ERROR_FILEERROR, "FILEERROR", "file read/write error", http.StatusBadRequest},
+	{ERROR_FILEHASH, "FILEHASH", "file md5-hash incorrect, file possibly corrupted", http.StatusBadRequest},
+	{ERROR_USERNOTAUTHORIZED, "USERNOTAUTHORIZED", "User not authorized", http.StatusUnauthorized},
+	{ERROR_INVALIDPARAMETER, "INVALIDPARAMETER", "Invalid parameter", http.StatusBadRequest},
+	{ERROR_NOTFOUND, "NOTFOUND", "Resource not found", http.StatusNotFound},
+	{ERROR_TIMEOUT, "TIMEOUT", "Request timed out", http.StatusServiceUnavailable},
+	{ERROR_PRECONDITIONREQUIRED, "PRECONDITIONREQUIRED", "If-Match header required", http.StatusPreconditionRequired},
+	{ERROR_VERSIONCONFLICT, "VERSIONCONFLICT", "Resource was changed", http.StatusPreconditionFailed},
+	{ERROR_VALIDATION, "VALIDATION", "Validation failed", http.StatusUnprocessableEntity},
+	{ERROR_CONFLICT, "CONFLICT", "Conflict with the current state of the resource", http.StatusConflict},
+	{ERROR_CONSTRAINT, "CONSTRAINT", "Constraint violated", http.StatusUnprocessableEntity},
+}
+
 func (e *APIErrorcode) String() string {
-	switch *e {
-	case ERROR_WRONGCREDENTIALS:
-		return "Wrong Username or Password"
-	case ERROR_DBQUERYFAILED:
-		return "Database Query failed"
-	case ERROR_MALFORMEDAUTH:
-		return "Authorization request is malformed"
-	case ERROR_NOHASH:
-		return "Could not generate Hash from Password"
-	case ERROR_NOTOKEN:
-		return "Could not generate Token"
-	case ERROR_JSONERROR:
-		return "JSON Marshal error"
-	case ERROR_FILEERROR:
-		return "file read/write error"
-	case ERROR_FILEHASH:
-		return "file md5-hash incorrect, file possibly corrupted"
-	case ERROR_USERNOTAUTHORIZED:
-		return "User not authorized"
-	case ERROR_INVALIDPARAMETER:
-		return "Invalid parameter"
-	case ERROR_NOTFOUND:
-		return "Resource not found"
+	for _, d := range apiErrors {
+		if d.Code == *e {
+			return d.Message
+		}
+	}
+	return "unknown error"
+}
+
+// listErrorsHandler serves the catalogue of the error codes.
+func listErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	j, err := json.Marshal(&apiErrors)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+// dberror answers the error of a db100 call with the status of its kind. Errors that are not
+// of a known kind are failed queries.
+func dberror(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	msg += ": " + err.Error()
+	var lqe *db100.ListQueryError
+	var vc *db100.VersionConflict
+	var ve *db100.ValidationError
+	switch {
+	case errors.As(err, &lqe):
+		apierror(w, r, msg, http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+	case errors.As(err, &vc):
+		apierror(w, r, msg, http.StatusPreconditionFailed, ERROR_VERSIONCONFLICT)
+	case errors.As(err, &ve):
+		var fe []FieldError
+		for _, f := range ve.Fields {
+			fe = append(fe, FieldError{Field: f.Field, Code: f.Code, Message: f.Message})
+		}
+		apifielderror(w, r, msg, http.StatusUnprocessableEntity, ERROR_VALIDATION, fe)
+	case errors.Is(err, db100.ErrNotFound):
+		apierror(w, r, msg, http.StatusNotFound, ERROR_NOTFOUND)
+	case errors.Is(err, db100.ErrConflict):
+		apierror(w, r, msg, http.StatusConflict, ERROR_CONFLICT)
+	case errors.Is(err, db100.ErrConstraint):
+		apierror(w, r, msg, http.StatusUnprocessableEntity, ERROR_CONSTRAINT)
 	default:
-		return "unknown error"
+		apierror(w, r, msg, http.StatusInternalServerError, ERROR_DBQUERYFAILED)
 	}
 }
@@ -38,9 +38,9 @@ func postEventHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
 		return
 	}
-	err = e.Insert()
+	err = e.Insert(r.Context())
 	if err != nil {
-		apierror(w, r, "Error Inserting Event: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error Inserting Event", err)
 		return
 	}
 	j, err := json.Marshal(&e)
@@ -54,9 +54,14 @@ func postEventHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func listEventsHandler(w http.ResponseWriter, r *http.Request) {
-	ee, err := db100.GetEvents()
+	lq, err := getListQuery(r)
 	if err != nil {
-		apierror(w, r, "Error fetching Events: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Events", err)
+		return
+	}
+	ee, p, err := db100.GetEventsPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Events", err)
 		return
 	}
 	j, err := json.Marshal(&ee)
@@ -65,6 +70,7 @@ func listEventsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setListPage(w, p)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(j)
 }
@@ -78,9 +84,9 @@ func getEventHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	e := db100.Event{EventID: id}
-	err = e.GetDetails()
+	err = e.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, "Error fetching Event: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Event", err)
 		return
 	}
 	j, err := json.Marshal(&e)
@@ -89,8 +95,7 @@ func getEventHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, e.Version, j)
 }
 
 func getEventParticipantsHandler(w http.ResponseWriter, r *http.Request) {
@@ -102,18 +107,18 @@ func getEventParticipantsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	e := db100.Event{EventID: id}
-	pp, err := e.GetParticipants()
+	pp, err := e.GetParticipants(r.Context())
 	if err != nil {
-		apierror(w, r, "Error fetching Event Participiants: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Event Participiants", err)
 		return
 	}
 
 	var result []eventParticipiantsResponse
 	for _, p := range pp {
 		u := db100.User{UserID: p.UserID}
-		err := u.GetDetails()
+		err := u.GetDetails(r.Context())
 		if err != nil {
-			apierror(w, r, "Error fetching User: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+			dberror(w, r, "Error fetching User", err)
 			return
 		}
 		u.Password = ""
@@ -142,7 +147,7 @@ func postEventParticipantHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ou, err := getUserfromToken(token)
+	ou, err := getUserfromToken(r.Context(), token)
 	if err != nil {
 		apierror(w, r, "Auth Request malformed", 401, ERROR_MALFORMEDAUTH)
 		return
@@ -172,9 +177,9 @@ func postEventParticipantHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	p.EventID = id
-	err = p.Insert()
+	err = p.Insert(r.Context())
 	if err != nil {
-		apierror(w, r, "Error adding Event Participiants: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error adding Event Participiants", err)
 		return
 	}
 }
@@ -186,7 +191,7 @@ func deleteEventParticipantHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ou, err := getUserfromToken(token)
+	ou, err := getUserfromToken(r.Context(), token)
 	if err != nil {
 		apierror(w, r, "Auth Request malformed", 401, ERROR_MALFORMEDAUTH)
 		return
@@ -216,9 +221,9 @@ func deleteEventParticipantHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	p.EventID = id
-	err = p.Delete()
+	err = p.Delete(r.Context())
 	if err != nil {
-		apierror(w, r, "Error remove Event Participiants: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error remove Event Participiants", err)
 		return
 	}
 }
@@ -232,9 +237,9 @@ func getEventPackinglists(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	e := db100.Event{EventID: id}
-	pp, err := e.GetPackinglists()
+	pp, err := e.GetPackinglists(r.Context())
 	if err != nil {
-		apierror(w, r, "Error fetching Event Packinglists: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Event Packinglists", err)
 		return
 	}
 	j, err := json.Marshal(&pp)
@@ -248,9 +253,9 @@ func getEventPackinglists(w http.ResponseWriter, r *http.Request) {
 }
 
 func getNextEventHandler(w http.ResponseWriter, r *http.Request) {
-	e, err := db100.GetNextEvent()
+	e, err := db100.GetNextEvent(r.Context())
 	if err != nil {
-		apierror(w, r, "Error fetching Event: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Event", err)
 		return
 	}
 	j, err := json.Marshal(&e)
@@ -276,17 +281,26 @@ func patchEventHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	decoder := json.NewDecoder(r.Body)
-	var event db100.Event
-	err = decoder.Decode(&event)
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	event := db100.Event{EventID: id}
+	err = event.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		dberror(w, r, "Error fetching Event", err)
+		return
+	}
+	err = mergePatch(r, &event)
+	if err != nil {
+		patcherror(w, r, "Error patching Event", err)
 		return
 	}
 	event.EventID = id
-	err = event.Update()
+	event.Version = v
+	err = event.Update(r.Context())
 	if err != nil {
-		apierror(w, r, "Error updating Event: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error updating Event", err)
 		return
 	}
 	j, err := json.Marshal(&event)
@@ -295,8 +309,7 @@ func patchEventHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, event.Version, j)
 }
 
 func deleteEventHandler(w http.ResponseWriter, r *http.Request) {
@@ -312,10 +325,13 @@ func deleteEventHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
+	if !checkIfMatch(w, r, &db100.Event{}, id) {
+		return
+	}
 	e := db100.Event{EventID: id}
-	err = e.Delete()
+	err = e.Delete(r.Context())
 	if err != nil {
-		apierror(w, r, "Error deleting Event: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error deleting Event", err)
 		return
 	}
 }
@@ -14,9 +14,15 @@ func getFaultRouter(prefix string) *interpose.Middleware {
 	r, m := GetNewSubrouter(prefix)
 	r.HandleFunc("/", postFaultHandler).Methods("POST")
 	r.HandleFunc("/list", listFaultsHandler).Methods("GET")
+	r.HandleFunc("/spend", getRepairSpendHandler).Methods("GET")
 	r.HandleFunc("/{ID}", getFaultHandler).Methods("GET")
 	r.HandleFunc("/{ID}", patchFaultHandler).Methods("PATCH")
 	r.HandleFunc("/{ID}", deleteFaultHandler).Methods("DELETE")
+	r.HandleFunc("/{ID}/comments", getFaultCommentsHandler).Methods("GET")
+	r.HandleFunc("/{ID}/comments", postFaultCommentHandler).Methods("POST")
+	r.HandleFunc("/{ID}/parts", getFaultPartsHandler).Methods("GET")
+	r.HandleFunc("/{ID}/parts", postFaultPartHandler).Methods("POST")
+	r.HandleFunc("/{ID}/parts/{PID}", deleteFaultPartHandler).Methods("DELETE")
 	return m
 }
 
@@ -37,10 +43,14 @@ func postFaultHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "FaultStatus out of bound", http.StatusBadRequest, ERROR_JSONERROR)
 		return
 	}
-
-	err = f.Insert()
+	u, err := getUserfromRequest(r)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	err = f.InsertBy(r.Context(), u.UserID)
 	if err != nil {
-		apierror(w, r, "Error Inserting Fault: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error Inserting Fault", err)
 		return
 	}
 	j, err := json.Marshal(&f)
@@ -54,9 +64,14 @@ func postFaultHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func listFaultsHandler(w http.ResponseWriter, r *http.Request) {
-	ff, err := db100.GetFaults()
+	lq, err := getListQuery(r)
 	if err != nil {
-		apierror(w, r, "Error fetching Faults: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Faults", err)
+		return
+	}
+	ff, p, err := db100.GetFaultsPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Faults", err)
 		return
 	}
 	var res []faultResponse
@@ -65,17 +80,17 @@ func listFaultsHandler(w http.ResponseWriter, r *http.Request) {
 		fr.Fault = f
 		var it db100.Item
 		it.ItemID = f.ItemID
-		err = it.GetDetails()
+		err = it.GetDetails(r.Context())
 		if err != nil {
-			apierror(w, r, "Error fetching Fault StoreItem: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+			dberror(w, r, "Error fetching Fault StoreItem", err)
 			return
 		}
 		fr.Code = it.Code
 		var eq db100.Equipment
 		eq.EquipmentID = it.EquipmentID
-		err = eq.GetDetails()
+		err = eq.GetDetails(r.Context())
 		if err != nil {
-			apierror(w, r, "Error fetching Fault Equipment: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+			dberror(w, r, "Error fetching Fault Equipment", err)
 			return
 		}
 		fr.Name = eq.Name
@@ -87,6 +102,7 @@ func listFaultsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setListPage(w, p)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(j)
 }
@@ -100,9 +116,9 @@ func getFaultHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	f := db100.Fault{FaultID: id}
-	err = f.GetDetails()
+	err = f.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, "Error fetching Fault: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Fault", err)
 		return
 	}
 	j, err := json.Marshal(&f)
@@ -111,8 +127,7 @@ func getFaultHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, f.Version, j)
 }
 
 func patchFaultHandler(w http.ResponseWriter, r *http.Request) {
@@ -128,17 +143,32 @@ func patchFaultHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	decoder := json.NewDecoder(r.Body)
-	var fa db100.Fault
-	err = decoder.Decode(&fa)
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	fp := faultPatchRequest{Fault: db100.Fault{FaultID: id}}
+	err = fp.Fault.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		dberror(w, r, "Error fetching Fault", err)
+		return
+	}
+	err = mergePatch(r, &fp)
+	if err != nil {
+		patcherror(w, r, "Error patching Fault", err)
+		return
+	}
+	u, err := getUserfromRequest(r)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
 		return
 	}
+	fa := fp.Fault
 	fa.FaultID = id
-	err = fa.Update()
+	fa.Version = v
+	err = fa.UpdateBy(r.Context(), u.UserID, fp.Note)
 	if err != nil {
-		apierror(w, r, "Error updating Fault: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error updating Fault", err)
 		return
 	}
 	j, err := json.Marshal(&fa)
@@ -147,8 +177,7 @@ func patchFaultHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, fa.Version, j)
 }
 
 func deleteFaultHandler(w http.ResponseWriter, r *http.Request) {
@@ -164,10 +193,83 @@ func deleteFaultHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
+	if !checkIfMatch(w, r, &db100.Fault{}, id) {
+		return
+	}
+	f := db100.Fault{FaultID: id}
+	err = f.Delete(r.Context())
+	if err != nil {
+		dberror(w, r, "Error deleting Fault", err)
+		return
+	}
+}
+
+func getFaultCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	f := db100.Fault{FaultID: id}
+	fc, err := f.GetComments(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Fault comments", err)
+		return
+	}
+	j, err := json.Marshal(&fc)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func postFaultCommentHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var fcr faultCommentRequest
+	err = decoder.Decode(&fcr)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	u, err := getUserfromRequest(r)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
 	f := db100.Fault{FaultID: id}
-	err = f.Delete()
+	fc, err := f.AddComment(r.Context(), u.UserID, fcr.Comment)
+	if err != nil {
+		dberror(w, r, "Error adding Fault comment", err)
+		return
+	}
+	j, err := json.Marshal(&fc)
 	if err != nil {
-		apierror(w, r, "Error deleting Fault: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
 }
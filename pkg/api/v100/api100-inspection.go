@@ -0,0 +1,315 @@
+package api100
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/carbocation/interpose"
+	"github.com/gorilla/mux"
+)
+
+func getInspectionRouter(prefix string) *interpose.Middleware {
+	r, m := GetNewSubrouter(prefix)
+	r.HandleFunc("/", postInspectionHandler).Methods("POST")
+	r.HandleFunc("/due", getDueInspectionsHandler).Methods("GET")
+	r.HandleFunc("/type", postInspectionTypeHandler).Methods("POST")
+	r.HandleFunc("/type/list", listInspectionTypesHandler).Methods("GET")
+	r.HandleFunc("/type/{ID}", getInspectionTypeHandler).Methods("GET")
+	r.HandleFunc("/type/{ID}", patchInspectionTypeHandler).Methods("PATCH")
+	r.HandleFunc("/type/{ID}", deleteInspectionTypeHandler).Methods("DELETE")
+	r.HandleFunc("/{ID}", getInspectionHandler).Methods("GET")
+	return m
+}
+
+func postInspectionHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var in db100.Inspection
+	err = decoder.Decode(&in)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	u, err := getUserfromRequest(r)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	in.InspectionID = 0
+	in.UserID = u.UserID
+	for n := range in.Values {
+		in.Values[n].InspectionValueID = 0
+	}
+	err = in.Insert(r.Context())
+	if err != nil {
+		dberror(w, r, "Error recording Inspection", err)
+		return
+	}
+	j, err := json.Marshal(&in)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getInspectionHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	in := db100.Inspection{InspectionID: id}
+	err = in.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Inspection", err)
+		return
+	}
+	j, err := json.Marshal(&in)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+// getDueInspectionsHandler lists the inspections due until ?until=YYYY-MM-DD (default now)
+// for the items in ?store=, all stores if omitted.
+func getDueInspectionsHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	var sid int
+	s := r.URL.Query().Get("store")
+	if s != "" {
+		sid, err = strconv.Atoi(s)
+		if err != nil {
+			apierror(w, r, "Error converting Store ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+	}
+	until := time.Now()
+	u := r.URL.Query().Get("until")
+	if u != "" {
+		until, err = time.Parse("2006-01-02", u)
+		if err != nil {
+			apierror(w, r, "Error converting date: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+		until = until.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	dd, err := db100.GetDueInspections(r.Context(), sid, until)
+	if err != nil {
+		dberror(w, r, "Error fetching due Inspections", err)
+		return
+	}
+	j, err := json.Marshal(&dd)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func postInspectionTypeHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var t db100.InspectionType
+	err = decoder.Decode(&t)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	t.InspectionTypeID = 0
+	err = t.Insert(r.Context())
+	if err != nil {
+		dberror(w, r, "Error Inserting Inspection type", err)
+		return
+	}
+	j, err := json.Marshal(&t)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func listInspectionTypesHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	lq, err := getListQuery(r)
+	if err != nil {
+		dberror(w, r, "Error fetching Inspection types", err)
+		return
+	}
+	tt, p, err := db100.GetInspectionTypesPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Inspection types", err)
+		return
+	}
+	j, err := json.Marshal(&tt)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	setListPage(w, p)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getInspectionTypeHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	t := db100.InspectionType{InspectionTypeID: id}
+	err = t.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Inspection type", err)
+		return
+	}
+	j, err := json.Marshal(&t)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	writeVersioned(w, r, t.Version, j)
+}
+
+func patchInspectionTypeHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	t := db100.InspectionType{InspectionTypeID: id}
+	err = t.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Inspection Type", err)
+		return
+	}
+	err = mergePatch(r, &t)
+	if err != nil {
+		patcherror(w, r, "Error patching Inspection Type", err)
+		return
+	}
+	t.InspectionTypeID = id
+	t.Version = v
+	err = t.Update(r.Context())
+	if err != nil {
+		dberror(w, r, "Error updating Inspection type", err)
+		return
+	}
+	j, err := json.Marshal(&t)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	writeVersioned(w, r, t.Version, j)
+}
+
+func deleteInspectionTypeHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	if !checkIfMatch(w, r, &db100.InspectionType{}, id) {
+		return
+	}
+	t := db100.InspectionType{InspectionTypeID: id}
+	err = t.Delete(r.Context())
+	if err != nil {
+		dberror(w, r, "Error deleting Inspection type", err)
+		return
+	}
+}
+
+func getItemInspectionsHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	it := db100.Item{ItemID: id}
+	ii, err := it.GetInspections(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Inspections", err)
+		return
+	}
+	j, err := json.Marshal(&ii)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
@@ -13,9 +13,11 @@ import (
 func convertItemListEntryinItemResponse(s db100.ItemslistEntry) itemResponse {
 	var sir itemResponse
 	sir.Item.ItemID = s.ItemID
+	sir.Item.Version = s.ItemVersion
 	sir.Item.Code = s.ItemCode
 	sir.Item.Description = s.ItemDescription
 	sir.Item.EquipmentID = s.EquipmentID
+	sir.Item.ItemAsset = s.ItemAsset
 	sir.Box.BoxID = s.BoxID
 	sir.Box.Code = s.BoxCode
 	sir.Box.Description = s.BoxDescription
@@ -37,19 +39,33 @@ func convertItemListinItemResponseList(ss []db100.ItemslistEntry) []itemResponse
 	return res
 }
 
-func getItemRouter(prefix string) *interpose.Middleware {
+// itemHandlers serve the item endpoints from the repositories the router was built with. The
+// faults, attributes and inspections of an item are entities of their own and are served from
+// the package database whatever the repositories are.
+type itemHandlers struct {
+	repo db100.Repositories
+}
+
+func getItemRouter(prefix string, repo db100.Repositories) *interpose.Middleware {
+	h := itemHandlers{repo}
 	r, m := GetNewSubrouter(prefix)
-	r.HandleFunc("/", postItemHandler).Methods("POST")
-	r.HandleFunc("/list", listItemsHandler).Methods("GET")
-	r.HandleFunc("/storeless", listStorelessItemsHandler).Methods("GET")
-	r.HandleFunc("/{ID}", getItemHandler).Methods("GET")
-	r.HandleFunc("/{ID}", patchItemHandler).Methods("PATCH")
-	r.HandleFunc("/{ID}", deleteItemHandler).Methods("DELETE")
+	r.HandleFunc("/", h.postItemHandler).Methods("POST")
+	r.HandleFunc("/list", h.listItemsHandler).Methods("GET")
+	r.HandleFunc("/storeless", h.listStorelessItemsHandler).Methods("GET")
+	r.HandleFunc("/retired", h.listRetiredItemsHandler).Methods("GET")
+	r.HandleFunc("/{ID}", h.getItemHandler).Methods("GET")
+	r.HandleFunc("/{ID}", h.patchItemHandler).Methods("PATCH")
+	r.HandleFunc("/{ID}", h.deleteItemHandler).Methods("DELETE")
 	r.HandleFunc("/{ID}/fault", getItemFaultsHandler).Methods("GET")
+	r.HandleFunc("/{ID}/attributes", getItemAttributesHandler).Methods("GET")
+	r.HandleFunc("/{ID}/attributes", putItemAttributesHandler).Methods("PUT")
+	r.HandleFunc("/{ID}/inspections", getItemInspectionsHandler).Methods("GET")
+	r.HandleFunc("/{ID}/retire", h.retireItemHandler).Methods("POST")
+	r.HandleFunc("/{ID}/reinstate", h.reinstateItemHandler).Methods("POST")
 	return m
 }
 
-func postItemHandler(w http.ResponseWriter, r *http.Request) {
+func (h itemHandlers) postItemHandler(w http.ResponseWriter, r *http.Request) {
 	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
 	if err != nil {
 		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
@@ -62,9 +78,9 @@ func postItemHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
 		return
 	}
-	err = i.Insert()
+	err = h.repo.Items.Insert(r.Context(), &i)
 	if err != nil {
-		apierror(w, r, "Error Inserting Item: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error Inserting Item", err)
 		return
 	}
 	j, err := json.Marshal(&i)
@@ -77,10 +93,20 @@ func postItemHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(j)
 }
 
-func listItemsHandler(w http.ResponseWriter, r *http.Request) {
-	ss, err := db100.GetItemsJoined(false)
+func (h itemHandlers) listItemsHandler(w http.ResponseWriter, r *http.Request) {
+	ff, err := parseAttributeFilters(r.URL.Query())
+	if err != nil {
+		apierror(w, r, "Error parsing Attribute filter: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	lq, err := getListQuery(r)
+	if err != nil {
+		dberror(w, r, "Error fetching Items", err)
+		return
+	}
+	ss, p, err := h.repo.Items.List(r.Context(), false, ff, lq)
 	if err != nil {
-		apierror(w, r, "Error fetching Items: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Items", err)
 		return
 	}
 	res := convertItemListinItemResponseList(ss)
@@ -90,14 +116,20 @@ func listItemsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setListPage(w, p)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(j)
 }
 
-func listStorelessItemsHandler(w http.ResponseWriter, r *http.Request) {
-	ss, err := db100.GetItemsJoined(true)
+func (h itemHandlers) listStorelessItemsHandler(w http.ResponseWriter, r *http.Request) {
+	lq, err := getListQuery(r)
+	if err != nil {
+		dberror(w, r, "Error fetching Items", err)
+		return
+	}
+	ss, p, err := h.repo.Items.List(r.Context(), true, nil, lq)
 	if err != nil {
-		apierror(w, r, "Error fetching Items: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Items", err)
 		return
 	}
 	res := convertItemListinItemResponseList(ss)
@@ -107,11 +139,12 @@ func listStorelessItemsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setListPage(w, p)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(j)
 }
 
-func getItemHandler(w http.ResponseWriter, r *http.Request) {
+func (h itemHandlers) getItemHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	i := vars["ID"]
 	id, err := strconv.Atoi(i)
@@ -119,11 +152,9 @@ func getItemHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	var it db100.Item
-	it.ItemID = id
-	ile, err := it.GetFullDetails()
+	ile, err := h.repo.Items.GetFull(r.Context(), id)
 	if err != nil {
-		apierror(w, r, "Error fetching Item: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Item", err)
 		return
 	}
 	sir := convertItemListEntryinItemResponse(ile)
@@ -133,11 +164,10 @@ func getItemHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, sir.Item.Version, j)
 }
 
-func patchItemHandler(w http.ResponseWriter, r *http.Request) {
+func (h itemHandlers) patchItemHandler(w http.ResponseWriter, r *http.Request) {
 	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
 	if err != nil {
 		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
@@ -150,17 +180,25 @@ func patchItemHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	decoder := json.NewDecoder(r.Body)
-	var si db100.Item
-	err = decoder.Decode(&si)
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	si, err := h.repo.Items.Get(r.Context(), id)
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		dberror(w, r, "Error fetching Item", err)
+		return
+	}
+	err = mergePatch(r, &si)
+	if err != nil {
+		patcherror(w, r, "Error patching Item", err)
 		return
 	}
 	si.ItemID = id
-	err = si.Update()
+	si.Version = v
+	err = h.repo.Items.Update(r.Context(), &si)
 	if err != nil {
-		apierror(w, r, "Error updating Equipment: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error updating Equipment", err)
 		return
 	}
 	j, err := json.Marshal(&si)
@@ -169,11 +207,10 @@ func patchItemHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, si.Version, j)
 }
 
-func deleteItemHandler(w http.ResponseWriter, r *http.Request) {
+func (h itemHandlers) deleteItemHandler(w http.ResponseWriter, r *http.Request) {
 	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
 	if err != nil {
 		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
@@ -186,10 +223,17 @@ func deleteItemHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	s := db100.Item{ItemID: id}
-	err = s.Delete()
+	cur, err := h.repo.Items.Get(r.Context(), id)
+	if err != nil {
+		dberror(w, r, "Error fetching Item", err)
+		return
+	}
+	if !matchVersion(w, r, "Item", id, cur.Version) {
+		return
+	}
+	err = h.repo.Items.Delete(r.Context(), id)
 	if err != nil {
-		apierror(w, r, "Error deleting Item: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error deleting Item", err)
 		return
 	}
 }
@@ -208,9 +252,9 @@ func getItemFaultsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	s := db100.Item{ItemID: id}
-	ff, err := s.GetFaults()
+	ff, err := s.GetFaults(r.Context())
 	if err != nil {
-		apierror(w, r, "Error getting Faults for Item: "+err.Error(), http.StatusBadRequest, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error getting Faults for Item", err)
 		return
 	}
 	j, err := json.Marshal(&ff)
@@ -0,0 +1,55 @@
+package api100
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+)
+
+// getListQuery reads the paging parameters ?limit=&cursor=&sort= of a list request. All other
+// parameters are field filters, except the ones named in skip and the attribute filters.
+func getListQuery(r *http.Request, skip ...string) (db100.ListQuery, error) {
+	var lq db100.ListQuery
+	q := r.URL.Query()
+	l := q.Get("limit")
+	if l != "" {
+		var err error
+		lq.Limit, err = strconv.Atoi(l)
+		if err != nil {
+			return lq, &db100.ListQueryError{Param: "limit", Reason: "expected a number"}
+		}
+	}
+	lq.Cursor = q.Get("cursor")
+	lq.Sort = q["sort"]
+	lq.Filters = make(map[string][]string)
+	for k, vv := range q {
+		switch {
+		case k == "limit" || k == "cursor" || k == "sort":
+		case strings.HasPrefix(k, attributeFilterPrefix):
+		case contains(skip, k):
+		default:
+			lq.Filters[k] = vv
+		}
+	}
+	return lq, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// setListPage reports the total count and the cursor of the next page in the response headers,
+// the body stays the plain list.
+func setListPage(w http.ResponseWriter, p db100.ListPage) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(p.Total))
+	if p.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", p.NextCursor)
+	}
+}
@@ -0,0 +1,242 @@
+package api100
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/carbocation/interpose"
+	"github.com/gorilla/mux"
+)
+
+func getLocationRouter(prefix string) *interpose.Middleware {
+	r, m := GetNewSubrouter(prefix)
+	r.HandleFunc("/", postLocationHandler).Methods("POST")
+	r.HandleFunc("/list", listLocationsHandler).Methods("GET")
+	r.HandleFunc("/code/{Code}", getLocationtoCodeHandler).Methods("GET")
+	r.HandleFunc("/{ID}", getLocationHandler).Methods("GET")
+	r.HandleFunc("/{ID}", deleteLocationHandler).Methods("DELETE")
+	r.HandleFunc("/{ID}", patchLocationHandler).Methods("PATCH")
+	r.HandleFunc("/{ID}/children", getLocationChildrenHandler).Methods("GET")
+	r.HandleFunc("/{ID}/boxes", getLocationBoxesHandler).Methods("GET")
+
+	return m
+}
+
+func postLocationHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var l db100.Location
+	err = decoder.Decode(&l)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	err = l.Insert(r.Context())
+	if err != nil {
+		dberror(w, r, "Error Inserting Location", err)
+		return
+	}
+	j, err := json.Marshal(&l)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func listLocationsHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	lq, err := getListQuery(r)
+	if err != nil {
+		dberror(w, r, "Error fetching Locations", err)
+		return
+	}
+	ll, p, err := db100.GetLocationsPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Locations", err)
+		return
+	}
+	j, err := json.Marshal(&ll)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+	setListPage(w, p)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getLocationHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	l := db100.Location{LocationID: id}
+	err = l.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Location", err)
+		return
+	}
+	j, err := json.Marshal(&l)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	writeVersioned(w, r, l.Version, j)
+}
+
+func patchLocationHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	lo := db100.Location{LocationID: id}
+	err = lo.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Location", err)
+		return
+	}
+	err = mergePatch(r, &lo)
+	if err != nil {
+		patcherror(w, r, "Error patching Location", err)
+		return
+	}
+	lo.LocationID = id
+	lo.Version = v
+	err = lo.Update(r.Context())
+	if err != nil {
+		dberror(w, r, "Error updating Location", err)
+		return
+	}
+	j, err := json.Marshal(&lo)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	writeVersioned(w, r, lo.Version, j)
+}
+
+func deleteLocationHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	if !checkIfMatch(w, r, &db100.Location{}, id) {
+		return
+	}
+	l := db100.Location{LocationID: id}
+	err = l.Delete(r.Context())
+	if err != nil {
+		dberror(w, r, "Error deleting Location", err)
+		return
+	}
+}
+
+func getLocationtoCodeHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	c := vars["Code"]
+	code, err := strconv.Atoi(c)
+	if err != nil {
+		apierror(w, r, "Error converting Code: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	l := db100.Location{Code: code}
+	err = l.GetDetailstoCode(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Location", err)
+		return
+	}
+	j, err := json.Marshal(&l)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getLocationChildrenHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	l := db100.Location{LocationID: id}
+	ll, err := l.GetChildren(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Location children", err)
+		return
+	}
+	j, err := json.Marshal(&ll)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getLocationBoxesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	l := db100.Location{LocationID: id}
+	bb, err := l.GetLocationBoxes(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Location Boxes", err)
+		return
+	}
+	j, err := json.Marshal(&bb)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
@@ -2,8 +2,11 @@ package api100
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"text/tabwriter"
 
 	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
 	"github.com/carbocation/interpose"
@@ -21,6 +24,9 @@ func getPackinglistRouter(prefix string) *interpose.Middleware {
 	r.HandleFunc("/{ID}/boxes", getPackinglistBoxes).Methods("GET")
 	r.HandleFunc("/{ID}/boxes/{BID}", addBoxtoPackinglistHandler).Methods("POST")
 	r.HandleFunc("/{ID}/boxes/{BID}", removeBoxfromPackinglistHandler).Methods("DELETE")
+	r.HandleFunc("/{ID}/picklist", getPackinglistPicklistHandler).Methods("GET")
+	r.HandleFunc("/{ID}/loadplan", getPackinglistLoadplanHandler).Methods("GET")
+	r.HandleFunc("/{ID}/loadplan/manifest", getPackinglistManifestHandler).Methods("GET")
 	return m
 }
 
@@ -37,9 +43,24 @@ func postPackinglistHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
 		return
 	}
-	err = p.Insert()
+	// The posted boxes are packed together with the new packinglist, a refused box leaves no packinglist behind
+	bb := p.Boxes
+	p.Boxes = nil
+	err = db100.TransactionContext(r.Context(), func(u *db100.UnitOfWork) error {
+		err := u.InsertPackinglist(&p)
+		if err != nil {
+			return err
+		}
+		for _, b := range bb {
+			err = u.AddPackinglistBox(&p, db100.Box{BoxID: b.BoxID})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		apierror(w, r, "Error Inserting Packinglist: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error Inserting Packinglist", err)
 		return
 	}
 	j, err := json.Marshal(&p)
@@ -53,9 +74,14 @@ func postPackinglistHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func listPackinglistsHandler(w http.ResponseWriter, r *http.Request) {
-	pp, err := db100.GetPackinglists()
+	lq, err := getListQuery(r)
 	if err != nil {
-		apierror(w, r, "Error fetching Packinglists: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Packinglists", err)
+		return
+	}
+	pp, p, err := db100.GetPackinglistsPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Packinglists", err)
 		return
 	}
 	j, err := json.Marshal(&pp)
@@ -64,6 +90,7 @@ func listPackinglistsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setListPage(w, p)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(j)
 }
@@ -77,9 +104,9 @@ func getPackinglistHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	p := db100.Packinglist{PackinglistID: id}
-	err = p.GetDetails()
+	err = p.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, "Error fetching Packinglist: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Packinglist", err)
 		return
 	}
 	j, err := json.Marshal(&p)
@@ -88,8 +115,7 @@ func getPackinglistHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, p.Version, j)
 }
 
 func patchPackinglistHandler(w http.ResponseWriter, r *http.Request) {
@@ -105,17 +131,26 @@ func patchPackinglistHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	decoder := json.NewDecoder(r.Body)
-	var pl db100.Packinglist
-	err = decoder.Decode(&pl)
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	pl := db100.Packinglist{PackinglistID: id}
+	err = pl.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		dberror(w, r, "Error fetching Packinglist", err)
+		return
+	}
+	err = mergePatch(r, &pl)
+	if err != nil {
+		patcherror(w, r, "Error patching Packinglist", err)
 		return
 	}
 	pl.PackinglistID = id
-	err = pl.Update()
+	pl.Version = v
+	err = pl.Update(r.Context())
 	if err != nil {
-		apierror(w, r, "Error updating Packinglist: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error updating Packinglist", err)
 		return
 	}
 	j, err := json.Marshal(&pl)
@@ -124,8 +159,7 @@ func patchPackinglistHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, pl.Version, j)
 }
 
 func deletePackinglistHandler(w http.ResponseWriter, r *http.Request) {
@@ -141,10 +175,13 @@ func deletePackinglistHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
+	if !checkIfMatch(w, r, &db100.Packinglist{}, id) {
+		return
+	}
 	p := db100.Packinglist{PackinglistID: id}
-	err = p.Delete()
+	err = p.Delete(r.Context())
 	if err != nil {
-		apierror(w, r, "Error deleting Packinglist: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error deleting Packinglist", err)
 		return
 	}
 }
@@ -162,10 +199,19 @@ func getSuitablePackinglistBoxesHandler(w http.ResponseWriter, r *http.Request)
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
+	hide := false
+	switch r.URL.Query().Get("faulty") {
+	case "", "rank":
+	case "hide":
+		hide = true
+	default:
+		apierror(w, r, "Unknown faulty mode, use rank or hide", http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
 	p := db100.Packinglist{PackinglistID: id}
-	bb, err := p.FindSuitableBoxes()
+	bb, err := p.GetSuitableBoxes(r.Context(), hide)
 	if err != nil {
-		apierror(w, r, "Error finding suitable Boxes: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error finding suitable Boxes", err)
 		return
 	}
 	j, err := json.Marshal(&bb)
@@ -199,9 +245,9 @@ func addBoxtoPackinglistHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	b := db100.Box{BoxID: bid}
-	err = p.AddPackinglistBox(b)
+	err = p.AddPackinglistBox(r.Context(), b)
 	if err != nil {
-		apierror(w, r, "Error Adding box to packinglist: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error Adding box to packinglist", err)
 		return
 	}
 }
@@ -227,9 +273,9 @@ func removeBoxfromPackinglistHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	b := db100.Box{BoxID: bid}
-	err = p.RemovePackinglistBox(b)
+	err = p.RemovePackinglistBox(r.Context(), b)
 	if err != nil {
-		apierror(w, r, "Error Adding box to packinglist: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error Adding box to packinglist", err)
 		return
 	}
 }
@@ -248,9 +294,9 @@ func getPackinglistBoxes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	p := db100.Packinglist{PackinglistID: id}
-	bb, err := p.GetPackinglistBoxes()
+	bb, err := p.GetPackinglistBoxes(r.Context())
 	if err != nil {
-		apierror(w, r, "Error getting Packinglist Boxes: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error getting Packinglist Boxes", err)
 		return
 	}
 	j, err := json.Marshal(&bb)
@@ -262,3 +308,139 @@ func getPackinglistBoxes(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(j)
 }
+
+func getLoadplanVehicles(r *http.Request) ([]db100.Vehicle, error) {
+	vids := r.URL.Query()["vehicle"]
+	if len(vids) == 0 {
+		return db100.GetVehicles(r.Context())
+	}
+	var ids []int
+	for _, v := range vids {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return db100.GetVehiclesByID(r.Context(), ids)
+}
+
+func getPackinglistLoadplanHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting Packinglist ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	vv, err := getLoadplanVehicles(r)
+	if err != nil {
+		apierror(w, r, "Error getting Vehicles: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	p := db100.Packinglist{PackinglistID: id}
+	lp, err := p.PlanLoad(r.Context(), vv)
+	if err != nil {
+		dberror(w, r, "Error planning Packinglist load", err)
+		return
+	}
+	j, err := json.Marshal(&lp)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getPackinglistManifestHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting Packinglist ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	vv, err := getLoadplanVehicles(r)
+	if err != nil {
+		apierror(w, r, "Error getting Vehicles: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	p := db100.Packinglist{PackinglistID: id}
+	lp, err := p.PlanLoad(r.Context(), vv)
+	if err != nil {
+		dberror(w, r, "Error planning Packinglist load", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writeLoadplanManifest(w, p, lp)
+}
+
+func writeLoadplanManifest(w io.Writer, p db100.Packinglist, lp db100.LoadPlan) {
+	fmt.Fprintf(w, "Packinglist: %v\n", p.Name)
+	fmt.Fprintf(w, "Event: %v (%v - %v)\n", p.Event.Name, p.Event.Start.Format("2006-01-02"), p.Event.End.Format("2006-01-02"))
+	for _, vl := range lp.Vehicles {
+		fmt.Fprintf(w, "\n== %v %v ==\n", vl.Vehicle.Name, vl.Vehicle.Plate)
+		fmt.Fprintf(w, "Load: %v / %v", vl.Weight, vl.Vehicle.Payload)
+		if vl.Overweight {
+			fmt.Fprint(w, " OVERWEIGHT")
+		}
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "Code\tDescription\tWeight\tL x W x H\t")
+		for _, b := range vl.Boxes {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v x %v x %v\t\n", b.Code, b.Description, b.Weight, b.Length, b.Width, b.Height)
+		}
+		tw.Flush()
+	}
+	if len(lp.Unassigned) > 0 {
+		fmt.Fprint(w, "\n== Not loaded ==\n")
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "Code\tDescription\tWeight\tL x W x H\t")
+		for _, b := range lp.Unassigned {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v x %v x %v\t\n", b.Code, b.Description, b.Weight, b.Length, b.Width, b.Height)
+		}
+		tw.Flush()
+	}
+}
+
+func getPackinglistPicklistHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting Packinglist ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	p := db100.Packinglist{PackinglistID: id}
+	pl, err := p.GetPicklist(r.Context())
+	if err != nil {
+		dberror(w, r, "Error getting Packinglist picklist", err)
+		return
+	}
+	j, err := json.Marshal(&pl)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
@@ -0,0 +1,173 @@
+package api100
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// mergePatchContentType is the media type of JSON merge patches, PATCH also accepts application/json.
+const mergePatchContentType = "application/merge-patch+json"
+
+// FieldError describes why the value of a single field of a request was refused.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Codes of the field errors of a merge patch, validation errors use the codes of db100.
+const (
+	patchUnknownField = "unknown"
+	patchWrongType    = "type"
+	patchReadOnly     = "readonly"
+)
+
+// readOnlyFields are kept by the server and can not be changed by a patch, like primary keys.
+// Soft deletes only go through DELETE, which checks for references first.
+var readOnlyFields = map[string]bool{
+	"DeletedAt": true,
+	"Version":   true,
+	"Code":      true,
+}
+
+// PatchError is returned when fields of a merge patch can not be applied.
+type PatchError struct {
+	Fields []FieldError
+}
+
+func (p *PatchError) Error() string {
+	var ss []string
+	for _, f := range p.Fields {
+		ss = append(ss, f.Field+": "+f.Message)
+	}
+	return strings.Join(ss, ", ")
+}
+
+// mergePatch applies the JSON merge patch (RFC 7396) in the request body to the entity target
+// points to. Fields missing in the patch are kept, null resets a field to its zero value and
+// objects are merged into nested structs field by field. Fields the entity does not have, values
+// of the wrong type and changes of read-only fields are reported per field in a PatchError.
+// Read-only fields may be sent with their current value, so entities can be patched as fetched.
+func mergePatch(r *http.Request, target interface{}) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	patch, ok := patchObject(body)
+	if !ok {
+		return errors.New("Merge patch must be a JSON object")
+	}
+	fe := applyMergePatch(reflect.ValueOf(target).Elem(), patch, "")
+	if len(fe) > 0 {
+		sort.Slice(fe, func(a, b int) bool {
+			return fe[a].Field < fe[b].Field
+		})
+		return &PatchError{fe}
+	}
+	return nil
+}
+
+func patchObject(raw []byte) (map[string]json.RawMessage, bool) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '{' {
+		return nil, false
+	}
+	var patch map[string]json.RawMessage
+	err := json.Unmarshal(raw, &patch)
+	return patch, err == nil
+}
+
+func applyMergePatch(v reflect.Value, patch map[string]json.RawMessage, prefix string) []FieldError {
+	var fe []FieldError
+	for name, raw := range patch {
+		path := prefix + name
+		f, sf, ok := jsonField(v, name)
+		if !ok {
+			fe = append(fe, FieldError{path, patchUnknownField, "unknown field"})
+			continue
+		}
+		nv := reflect.New(f.Type())
+		if string(bytes.TrimSpace(raw)) == "null" {
+			nv.Elem().Set(reflect.Zero(f.Type()))
+		} else if sub, ok := patchObject(raw); ok && f.Kind() == reflect.Struct && !unmarshalsItself(f) {
+			nv.Elem().Set(f)
+			sfe := applyMergePatch(nv.Elem(), sub, path+".")
+			if len(sfe) > 0 {
+				fe = append(fe, sfe...)
+				continue
+			}
+		} else {
+			err := json.Unmarshal(raw, nv.Interface())
+			if err != nil {
+				fe = append(fe, FieldError{path, patchWrongType, fieldErrorMessage(err)})
+				continue
+			}
+		}
+		if readOnly(sf) && !reflect.DeepEqual(f.Interface(), nv.Elem().Interface()) {
+			fe = append(fe, FieldError{path, patchReadOnly, "field can not be changed"})
+			continue
+		}
+		f.Set(nv.Elem())
+	}
+	return fe
+}
+
+// jsonField returns the field of the struct v that encoding/json would decode the key name into.
+func jsonField(v reflect.Value, name string) (reflect.Value, reflect.StructField, bool) {
+	t := v.Type()
+	for n := 0; n < t.NumField(); n++ {
+		sf := t.Field(n)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if sf.Anonymous && tag == "" && sf.Type.Kind() == reflect.Struct {
+			if f, sf, ok := jsonField(v.Field(n), name); ok {
+				return f, sf, true
+			}
+			continue
+		}
+		if tag == "" {
+			tag = sf.Name
+		}
+		if strings.EqualFold(tag, name) {
+			return v.Field(n), sf, true
+		}
+	}
+	return reflect.Value{}, reflect.StructField{}, false
+}
+
+func readOnly(sf reflect.StructField) bool {
+	return readOnlyFields[sf.Name] || strings.Contains(sf.Tag.Get("gorm"), "primary_key")
+}
+
+func unmarshalsItself(f reflect.Value) bool {
+	_, ok := f.Addr().Interface().(json.Unmarshaler)
+	return ok
+}
+
+func fieldErrorMessage(err error) string {
+	if te, ok := err.(*json.UnmarshalTypeError); ok {
+		return "expected " + te.Type.String() + " but got " + te.Value
+	}
+	return err.Error()
+}
+
+// patcherror answers a merge patch that could not be applied with 400 Bad Request, listing the
+// refused fields for a PatchError.
+func patcherror(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	if pe, ok := err.(*PatchError); ok {
+		apifielderror(w, r, msg+": "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER, pe.Fields)
+		return
+	}
+	apierror(w, r, msg+": "+err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+}
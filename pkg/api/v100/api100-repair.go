@@ -0,0 +1,144 @@
+package api100
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/gorilla/mux"
+)
+
+func getFaultPartsHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	f := db100.Fault{FaultID: id}
+	pp, err := f.GetParts(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Fault parts", err)
+		return
+	}
+	j, err := json.Marshal(&pp)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func postFaultPartHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var p db100.FaultPart
+	err = decoder.Decode(&p)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	f := db100.Fault{FaultID: id}
+	p, err = f.AddPart(r.Context(), p)
+	if err != nil {
+		dberror(w, r, "Error adding Fault part", err)
+		return
+	}
+	j, err := json.Marshal(&p)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func deleteFaultPartHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	pi := vars["PID"]
+	pid, err := strconv.Atoi(pi)
+	if err != nil {
+		apierror(w, r, "Error converting Part ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	f := db100.Fault{FaultID: id}
+	err = f.RemovePart(r.Context(), pid)
+	if err != nil {
+		dberror(w, r, "Error removing Fault part", err)
+		return
+	}
+}
+
+// getRepairSpendHandler reports the repair spend per equipment for faults reported
+// between ?from= and ?to= (YYYY-MM-DD, both optional).
+func getRepairSpendHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	var from, to time.Time
+	f := r.URL.Query().Get("from")
+	if f != "" {
+		from, err = time.Parse("2006-01-02", f)
+		if err != nil {
+			apierror(w, r, "Error converting from date: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+	}
+	t := r.URL.Query().Get("to")
+	if t != "" {
+		to, err = time.Parse("2006-01-02", t)
+		if err != nil {
+			apierror(w, r, "Error converting to date: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+		to = to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	rs, err := db100.GetRepairSpend(r.Context(), from, to)
+	if err != nil {
+		dberror(w, r, "Error fetching repair spend", err)
+		return
+	}
+	j, err := json.Marshal(&rs)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
@@ -45,6 +45,11 @@ type wishlistItemsResponse struct {
 	Count     int
 }
 
+type wishlistContentResponse struct {
+	Equipment  []db100.Equipment
+	Categories []db100.Category
+}
+
 type packinglistItemsResponse struct {
 	StoreItemID int
 	Equipment   db100.Equipment
@@ -56,3 +61,13 @@ type faultResponse struct {
 	Code  int
 	Name  string
 }
+
+// faultPatchRequest is a fault with an optional Note that is added to the comment thread.
+type faultPatchRequest struct {
+	db100.Fault
+	Note string
+}
+
+type faultCommentRequest struct {
+	Comment string
+}
@@ -0,0 +1,194 @@
+package api100
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/gorilla/mux"
+)
+
+type itemReinstateRequest struct {
+	BoxID int
+}
+
+// getYear reads ?year=, defaulting to the current year.
+func getYear(r *http.Request) (int, error) {
+	y := r.URL.Query().Get("year")
+	if y == "" {
+		return time.Now().Year(), nil
+	}
+	year, err := strconv.Atoi(y)
+	if err != nil {
+		return 0, errors.New("Error converting year: " + err.Error())
+	}
+	return year, nil
+}
+
+func (h itemHandlers) retireItemHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var ir db100.ItemRetirement
+	err = decoder.Decode(&ir)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	it, err := h.repo.Items.Retire(r.Context(), id, ir)
+	if err != nil {
+		dberror(w, r, "Error retiring Item", err)
+		return
+	}
+	j, err := json.Marshal(&it)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func (h itemHandlers) reinstateItemHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var irr itemReinstateRequest
+	err = decoder.Decode(&irr)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	it, err := h.repo.Items.Reinstate(r.Context(), id, irr.BoxID)
+	if err != nil {
+		dberror(w, r, "Error reinstating Item", err)
+		return
+	}
+	j, err := json.Marshal(&it)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+// listRetiredItemsHandler lists the items retired in ?year=, all retired items if omitted.
+func (h itemHandlers) listRetiredItemsHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	var year int
+	if r.URL.Query().Get("year") != "" {
+		year, err = getYear(r)
+		if err != nil {
+			apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+	}
+	ii, err := h.repo.Items.Retired(r.Context(), year)
+	if err != nil {
+		dberror(w, r, "Error fetching retired Items", err)
+		return
+	}
+	j, err := json.Marshal(&ii)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getDisposalReportHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	year, err := getYear(r)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	dr, err := db100.GetDisposalReport(r.Context(), year)
+	if err != nil {
+		dberror(w, r, "Error creating Disposal report", err)
+		return
+	}
+	j, err := json.Marshal(&dr)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getDisposalReportCSVHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	year, err := getYear(r)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	dr, err := db100.GetDisposalReport(r.Context(), year)
+	if err != nil {
+		dberror(w, r, "Error creating Disposal report", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"disposals-"+strconv.Itoa(year)+".csv\"")
+	err = writeDisposalReportCSV(w, dr)
+	if err != nil {
+		apierror(w, r, "Error writing CSV: "+err.Error(), http.StatusInternalServerError, ERROR_FILEERROR)
+		return
+	}
+}
+
+func writeDisposalReportCSV(w io.Writer, dr db100.DisposalReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Code", "Equipment", "Serial", "Retirement", "Date", "Reason", "PurchasePrice", "BookValue", "Proceeds"})
+	for _, d := range dr.Items {
+		cw.Write([]string{strconv.Itoa(d.Item.Code), d.EquipmentName, d.Item.Serial, d.Item.Retirement.String(), d.Item.RetiredDate.Format("2006-01-02"), d.Item.RetiredReason, formatCents(d.Item.PurchasePrice), formatCents(d.BookValue), formatCents(d.Item.Proceeds)})
+	}
+	cw.Write([]string{"Total", "", "", "", "", "", formatCents(dr.PurchaseValue), formatCents(dr.BookValue), formatCents(dr.Proceeds)})
+	cw.Flush()
+	return cw.Error()
+}
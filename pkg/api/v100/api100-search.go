@@ -0,0 +1,48 @@
+package api100
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/carbocation/interpose"
+)
+
+func getSearchRouter(prefix string) *interpose.Middleware {
+	r, m := GetNewSubrouter(prefix)
+	r.HandleFunc("/", searchHandler).Methods("GET")
+	return m
+}
+
+// searchHandler searches equipment, items, boxes, stores, faults and events for ?q=.
+// ?kind= limits the search to one kind, ?limit= the number of results.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	var limit int
+	l := r.URL.Query().Get("limit")
+	if l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			apierror(w, r, "Error converting limit: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+	}
+	rr, err := db100.Search(r.Context(), r.URL.Query().Get("q"), r.URL.Query().Get("kind"), limit)
+	if err != nil {
+		dberror(w, r, "Error searching", err)
+		return
+	}
+	j, err := json.Marshal(&rr)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
@@ -17,6 +17,8 @@ func getStoreRouter(prefix string) *interpose.Middleware {
 	r.HandleFunc("/list", listStoresHandler).Methods("GET")
 	r.HandleFunc("/{ID}", getStoreHandler).Methods("GET")
 	r.HandleFunc("/{ID}/Manager", getStoreManagerHandler).Methods("GET")
+	r.HandleFunc("/{ID}/boxes", getStoreBoxesHandler).Methods("GET")
+	r.HandleFunc("/{ID}/intransit", getStoreInTransitHandler).Methods("GET")
 	r.HandleFunc("/{ID}", patchStoreHandler).Methods("PATCH")
 	r.HandleFunc("/{ID}", deleteStoreHandler).Methods("DELETE")
 
@@ -36,9 +38,9 @@ func postStoreHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
 		return
 	}
-	err = s.Insert()
+	err = s.Insert(r.Context())
 	if err != nil {
-		apierror(w, r, "Error Inserting Store: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error Inserting Store", err)
 		return
 	}
 	j, err := json.Marshal(&s)
@@ -52,9 +54,14 @@ func postStoreHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func listStoresHandler(w http.ResponseWriter, r *http.Request) {
-	ss, err := db100.GetStores()
+	lq, err := getListQuery(r)
 	if err != nil {
-		apierror(w, r, "Error fetching Stores: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Stores", err)
+		return
+	}
+	ss, p, err := db100.GetStoresPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Stores", err)
 		return
 	}
 	j, err := json.Marshal(&ss)
@@ -63,6 +70,7 @@ func listStoresHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setListPage(w, p)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(j)
 }
@@ -76,9 +84,9 @@ func getStoreHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	s := db100.Store{StoreID: id}
-	err = s.GetDetails()
+	err = s.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, "Error fetching Store: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Store", err)
 		return
 	}
 	j, err := json.Marshal(&s)
@@ -87,8 +95,7 @@ func getStoreHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, s.Version, j)
 }
 
 func getStoreManagerHandler(w http.ResponseWriter, r *http.Request) {
@@ -100,14 +107,14 @@ func getStoreManagerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	s := db100.Store{StoreID: id}
-	err = s.GetDetails()
+	err = s.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, "Error getting Store Detail: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error getting Store Detail", err)
 		return
 	}
-	u, err := s.GetManager()
+	u, err := s.GetManager(r.Context())
 	if err != nil {
-		apierror(w, r, "Error fetching Store Manager: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Store Manager", err)
 		return
 	}
 	j, err := json.Marshal(&u)
@@ -133,17 +140,26 @@ func patchStoreHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	decoder := json.NewDecoder(r.Body)
-	var st db100.Store
-	err = decoder.Decode(&st)
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	st := db100.Store{StoreID: id}
+	err = st.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		dberror(w, r, "Error fetching Store", err)
+		return
+	}
+	err = mergePatch(r, &st)
+	if err != nil {
+		patcherror(w, r, "Error patching Store", err)
 		return
 	}
 	st.StoreID = id
-	err = st.Update()
+	st.Version = v
+	err = st.Update(r.Context())
 	if err != nil {
-		apierror(w, r, "Error updating Store: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error updating Store", err)
 		return
 	}
 	j, err := json.Marshal(&st)
@@ -152,8 +168,7 @@ func patchStoreHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, st.Version, j)
 }
 
 func deleteStoreHandler(w http.ResponseWriter, r *http.Request) {
@@ -162,6 +177,38 @@ func deleteStoreHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
 		return
 	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	if !checkIfMatch(w, r, &db100.Store{}, id) {
+		return
+	}
+	s := db100.Store{StoreID: id}
+	q := r.URL.Query()
+	switch {
+	case q.Get("reassign") != "":
+		to, err2 := strconv.Atoi(q.Get("reassign"))
+		if err2 != nil {
+			apierror(w, r, "Error converting reassign Store ID: "+err2.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+		err = s.DeleteReassign(r.Context(), to)
+	case q.Get("cascade") == "true":
+		err = s.DeleteCascade(r.Context())
+	default:
+		err = s.Delete(r.Context())
+	}
+	if err != nil {
+		dberror(w, r, "Error deleting Store", err)
+		return
+	}
+}
+
+func getStoreBoxesHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	i := vars["ID"]
 	id, err := strconv.Atoi(i)
@@ -170,9 +217,40 @@ func deleteStoreHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	s := db100.Store{StoreID: id}
-	err = s.Delete()
+	bb, err := s.GetStoreBoxes(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Store Boxes", err)
+		return
+	}
+	j, err := json.Marshal(&bb)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getStoreInTransitHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	tt, err := db100.GetTransfersInTransit(r.Context(), id)
 	if err != nil {
-		apierror(w, r, "Error deleting Store: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Transfers in transit", err)
 		return
 	}
+	j, err := json.Marshal(&tt)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
 }
@@ -0,0 +1,430 @@
+package api100
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/carbocation/interpose"
+	"github.com/gorilla/mux"
+)
+
+func getTransferRouter(prefix string) *interpose.Middleware {
+	r, m := GetNewSubrouter(prefix)
+	r.HandleFunc("/", postTransferHandler).Methods("POST")
+	r.HandleFunc("/list", listTransfersHandler).Methods("GET")
+	r.HandleFunc("/intransit", listTransfersInTransitHandler).Methods("GET")
+	r.HandleFunc("/{ID}", getTransferHandler).Methods("GET")
+	r.HandleFunc("/{ID}", patchTransferHandler).Methods("PATCH")
+	r.HandleFunc("/{ID}", deleteTransferHandler).Methods("DELETE")
+	r.HandleFunc("/{ID}/boxes/{BID}", addBoxtoTransferHandler).Methods("POST")
+	r.HandleFunc("/{ID}/boxes/{BID}", removeBoxfromTransferHandler).Methods("DELETE")
+	r.HandleFunc("/{ID}/items/{IID}", addItemtoTransferHandler).Methods("POST")
+	r.HandleFunc("/{ID}/items/{IID}", removeItemfromTransferHandler).Methods("DELETE")
+	r.HandleFunc("/{ID}/ship", shipTransferHandler).Methods("POST")
+	r.HandleFunc("/{ID}/scan/{Code}", scanTransferHandler).Methods("POST")
+	r.HandleFunc("/{ID}/receive", receiveTransferHandler).Methods("POST")
+	r.HandleFunc("/{ID}/report", getTransferReportHandler).Methods("GET")
+	return m
+}
+
+func postTransferHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var t db100.Transfer
+	err = decoder.Decode(&t)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	err = t.Insert(r.Context())
+	if err != nil {
+		dberror(w, r, "Error Inserting Transfer", err)
+		return
+	}
+	j, err := json.Marshal(&t)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func listTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	lq, err := getListQuery(r)
+	if err != nil {
+		dberror(w, r, "Error fetching Transfers", err)
+		return
+	}
+	tt, p, err := db100.GetTransfersPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Transfers", err)
+		return
+	}
+	j, err := json.Marshal(&tt)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	setListPage(w, p)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func listTransfersInTransitHandler(w http.ResponseWriter, r *http.Request) {
+	tt, err := db100.GetTransfersInTransit(r.Context(), 0)
+	if err != nil {
+		dberror(w, r, "Error fetching Transfers", err)
+		return
+	}
+	j, err := json.Marshal(&tt)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getTransferHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	t := db100.Transfer{TransferID: id}
+	err = t.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Transfer", err)
+		return
+	}
+	j, err := json.Marshal(&t)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	writeVersioned(w, r, t.Version, j)
+}
+
+func patchTransferHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	t := db100.Transfer{TransferID: id}
+	err = t.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Transfer", err)
+		return
+	}
+	err = mergePatch(r, &t)
+	if err != nil {
+		patcherror(w, r, "Error patching Transfer", err)
+		return
+	}
+	t.TransferID = id
+	t.Version = v
+	err = t.Update(r.Context())
+	if err != nil {
+		dberror(w, r, "Error updating Transfer", err)
+		return
+	}
+	j, err := json.Marshal(&t)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	writeVersioned(w, r, t.Version, j)
+}
+
+func deleteTransferHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	if !checkIfMatch(w, r, &db100.Transfer{}, id) {
+		return
+	}
+	t := db100.Transfer{TransferID: id}
+	err = t.Delete(r.Context())
+	if err != nil {
+		dberror(w, r, "Error deleting Transfer", err)
+		return
+	}
+}
+
+func addBoxtoTransferHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting Transfer ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	bids := vars["BID"]
+	bid, err := strconv.Atoi(bids)
+	if err != nil {
+		apierror(w, r, "Error converting Box ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	t := db100.Transfer{TransferID: id}
+	b := db100.Box{BoxID: bid}
+	err = t.AddTransferBox(r.Context(), b)
+	if err != nil {
+		dberror(w, r, "Error adding Box to Transfer", err)
+		return
+	}
+}
+
+func removeBoxfromTransferHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting Transfer ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	bids := vars["BID"]
+	bid, err := strconv.Atoi(bids)
+	if err != nil {
+		apierror(w, r, "Error converting Box ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	t := db100.Transfer{TransferID: id}
+	b := db100.Box{BoxID: bid}
+	err = t.RemoveTransferBox(r.Context(), b)
+	if err != nil {
+		dberror(w, r, "Error removing Box from Transfer", err)
+		return
+	}
+}
+
+func addItemtoTransferHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting Transfer ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	ii := vars["IID"]
+	iid, err := strconv.Atoi(ii)
+	if err != nil {
+		apierror(w, r, "Error converting Item ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	tbid := 0
+	tb := r.URL.Query().Get("box")
+	if tb != "" {
+		tbid, err = strconv.Atoi(tb)
+		if err != nil {
+			apierror(w, r, "Error converting target Box ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+	}
+	t := db100.Transfer{TransferID: id}
+	it := db100.Item{ItemID: iid}
+	err = t.AddTransferItem(r.Context(), it, tbid)
+	if err != nil {
+		dberror(w, r, "Error adding Item to Transfer", err)
+		return
+	}
+}
+
+func removeItemfromTransferHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting Transfer ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	ii := vars["IID"]
+	iid, err := strconv.Atoi(ii)
+	if err != nil {
+		apierror(w, r, "Error converting Item ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	t := db100.Transfer{TransferID: id}
+	it := db100.Item{ItemID: iid}
+	err = t.RemoveTransferItem(r.Context(), it)
+	if err != nil {
+		dberror(w, r, "Error removing Item from Transfer", err)
+		return
+	}
+}
+
+func shipTransferHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	t := db100.Transfer{TransferID: id}
+	err = t.Ship(r.Context())
+	if err != nil {
+		dberror(w, r, "Error shipping Transfer", err)
+		return
+	}
+	j, err := json.Marshal(&t)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func scanTransferHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	c := vars["Code"]
+	code, err := strconv.Atoi(c)
+	if err != nil {
+		apierror(w, r, "Error converting Code: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	t := db100.Transfer{TransferID: id}
+	ts, err := t.Scan(r.Context(), code)
+	if err != nil {
+		dberror(w, r, "Error scanning Transfer", err)
+		return
+	}
+	j, err := json.Marshal(&ts)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func receiveTransferHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	t := db100.Transfer{TransferID: id}
+	tr, err := t.Receive(r.Context())
+	if err != nil {
+		dberror(w, r, "Error receiving Transfer", err)
+		return
+	}
+	j, err := json.Marshal(&tr)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getTransferReportHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	t := db100.Transfer{TransferID: id}
+	tr, err := t.GetReport(r.Context())
+	if err != nil {
+		dberror(w, r, "Error getting Transfer report", err)
+		return
+	}
+	j, err := json.Marshal(&tr)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
@@ -0,0 +1,105 @@
+package api100
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Chaosvermittlung/funkloch-server/internal/global"
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/carbocation/interpose"
+	"github.com/gorilla/mux"
+)
+
+type trashPurgeResponse struct {
+	Purged int
+}
+
+func getTrashRouter(prefix string) *interpose.Middleware {
+	r, m := GetNewSubrouter(prefix)
+	r.HandleFunc("/list", listTrashHandler).Methods("GET")
+	r.HandleFunc("/purge", purgeTrashHandler).Methods("POST")
+	r.HandleFunc("/{Kind}/{ID}/restore", restoreTrashHandler).Methods("POST")
+	return m
+}
+
+// listTrashHandler lists the deleted rows, ?kind= limits the list to one kind like box or store.
+func listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	lq, err := getListQuery(r)
+	if err != nil {
+		dberror(w, r, "Error fetching Trash", err)
+		return
+	}
+	tt, p, err := db100.GetTrashPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Trash", err)
+		return
+	}
+	j, err := json.Marshal(&tt)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	setListPage(w, p)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func restoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	err = db100.Restore(r.Context(), vars["Kind"], id)
+	if err != nil {
+		dberror(w, r, "Error restoring "+vars["Kind"], err)
+		return
+	}
+}
+
+// purgeTrashHandler purges rows deleted more than ?days= ago, defaulting to the configured retention.
+func purgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	days := global.Conf.Trash.RetentionDays
+	d := r.URL.Query().Get("days")
+	if d != "" {
+		days, err = strconv.Atoi(d)
+		if err != nil || days < 0 {
+			apierror(w, r, "Error converting days: "+d, http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+			return
+		}
+	}
+	var tpr trashPurgeResponse
+	tpr.Purged, err = db100.PurgeTrash(r.Context(), time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		dberror(w, r, "Error purging Trash", err)
+		return
+	}
+	j, err := json.Marshal(&tpr)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
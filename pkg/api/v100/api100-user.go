@@ -30,7 +30,7 @@ func getCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	un, err := getUserfromToken(token)
+	un, err := getUserfromToken(r.Context(), token)
 	if err != nil {
 		apierror(w, r, "Auth Request malformed", 401, ERROR_MALFORMEDAUTH)
 		return
@@ -42,8 +42,7 @@ func getCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, un.Version, j)
 }
 
 func patchCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -53,23 +52,29 @@ func patchCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ou, err := getUserfromToken(token)
+	ou, err := getUserfromToken(r.Context(), token)
 	if err != nil {
 		apierror(w, r, "Auth Request malformed", 401, ERROR_MALFORMEDAUTH)
 	}
 
 	contenttype := r.Header.Get("Content-Type")
-	if contenttype != "application/json" {
-		apierror(w, r, "Wrong contenttype. Expected: application/json Got: "+contenttype, http.StatusBadRequest, ERROR_FILEERROR)
+	if contenttype != "application/json" && contenttype != mergePatchContentType {
+		apierror(w, r, "Wrong contenttype. Expected: application/json or "+mergePatchContentType+" Got: "+contenttype, http.StatusBadRequest, ERROR_FILEERROR)
 		return
 	}
 
-	u := db100.User{}
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
 
-	decoder := json.NewDecoder(r.Body)
-	err = decoder.Decode(&u)
+	u := ou
+	err = mergePatch(r, &u)
+	if err == nil {
+		err = checkUserPatch(u)
+	}
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		patcherror(w, r, "Error patching User", err)
 		return
 	}
 
@@ -78,10 +83,15 @@ func patchCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ou.Patch(u)
-	err = ou.Update()
+	err = ou.Patch(u)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_NOHASH)
+		return
+	}
+	ou.Version = v
+	err = ou.Update(r.Context())
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error updating User", err)
 	}
 
 	j, err := json.Marshal(&ou)
@@ -90,8 +100,7 @@ func patchCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, ou.Version, j)
 }
 
 func postUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -133,9 +142,9 @@ func postUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	u.Password = pw
 
-	err = u.Insert()
+	err = u.Insert(r.Context())
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error Inserting User", err)
 		return
 	}
 
@@ -156,7 +165,7 @@ func getUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ou, err := getUserfromToken(token)
+	ou, err := getUserfromToken(r.Context(), token)
 	if err != nil {
 		apierror(w, r, "Auth Request malformed", 401, ERROR_MALFORMEDAUTH)
 		return
@@ -165,9 +174,9 @@ func getUserHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	n := vars["name"]
 	u := db100.User{Username: n}
-	err = u.GetDetailstoUsername()
+	err = u.GetDetailstoUsername(r.Context())
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching User", err)
 		return
 	}
 
@@ -182,14 +191,18 @@ func getUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, u.Version, j)
 }
 
 func listUsersHandler(w http.ResponseWriter, r *http.Request) {
-	uu, err := db100.GetUsers()
+	lq, err := getListQuery(r)
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Users", err)
+		return
+	}
+	uu, p, err := db100.GetUsersPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Users", err)
 		return
 	}
 	for i := range uu {
@@ -201,6 +214,7 @@ func listUsersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setListPage(w, p)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(j)
 }
@@ -213,33 +227,44 @@ func patchUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	contenttype := r.Header.Get("Content-Type")
-	if contenttype != "application/json" {
-		apierror(w, r, "Wrong contenttype. Expected: application/json Got: "+contenttype, http.StatusBadRequest, ERROR_FILEERROR)
+	if contenttype != "application/json" && contenttype != mergePatchContentType {
+		apierror(w, r, "Wrong contenttype. Expected: application/json or "+mergePatchContentType+" Got: "+contenttype, http.StatusBadRequest, ERROR_FILEERROR)
 		return
 	}
 
 	vars := mux.Vars(r)
 	n := vars["name"]
 	ou := db100.User{Username: n}
-	err = ou.GetDetailstoUsername()
+	err = ou.GetDetailstoUsername(r.Context())
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching User", err)
 		return
 	}
 
-	u := db100.User{}
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
 
-	decoder := json.NewDecoder(r.Body)
-	err = decoder.Decode(&u)
+	u := ou
+	err = mergePatch(r, &u)
+	if err == nil {
+		err = checkUserPatch(u)
+	}
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		patcherror(w, r, "Error patching User", err)
 		return
 	}
 
-	ou.Patch(u)
-	err = ou.Update()
+	err = ou.Patch(u)
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_NOHASH)
+		return
+	}
+	ou.Version = v
+	err = ou.Update(r.Context())
+	if err != nil {
+		dberror(w, r, "Error updating User", err)
 		return
 	}
 
@@ -249,8 +274,7 @@ func patchUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, ou.Version, j)
 }
 
 func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -263,14 +287,32 @@ func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	n := vars["name"]
 	u := db100.User{Username: n}
-	err = u.GetDetailstoUsername()
+	err = u.GetDetailstoUsername(r.Context())
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching User", err)
+		return
+	}
+	if !checkIfMatch(w, r, &db100.User{}, u.UserID) {
 		return
 	}
-	err = db100.DeleteUser(u.UserID)
+	err = db100.DeleteUser(r.Context(), u.UserID)
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error deleting User", err)
 		return
 	}
 }
+
+// checkUserPatch refuses patches that would leave a user without name or password.
+func checkUserPatch(u db100.User) error {
+	var fe []FieldError
+	if u.Username == "" {
+		fe = append(fe, FieldError{"username", db100.ViolationRequired, "must not be empty"})
+	}
+	if u.Password == "" {
+		fe = append(fe, FieldError{"password", db100.ViolationRequired, "must not be empty"})
+	}
+	if len(fe) > 0 {
+		return &PatchError{fe}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package api100
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/carbocation/interpose"
+	"github.com/gorilla/mux"
+)
+
+func getVehicleRouter(prefix string) *interpose.Middleware {
+	r, m := GetNewSubrouter(prefix)
+	r.HandleFunc("/", postVehicleHandler).Methods("POST")
+	r.HandleFunc("/list", listVehiclesHandler).Methods("GET")
+	r.HandleFunc("/{ID}", getVehicleHandler).Methods("GET")
+	r.HandleFunc("/{ID}", deleteVehicleHandler).Methods("DELETE")
+	r.HandleFunc("/{ID}", patchVehicleHandler).Methods("PATCH")
+
+	return m
+}
+
+func postVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var v db100.Vehicle
+	err = decoder.Decode(&v)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		return
+	}
+	err = v.Insert(r.Context())
+	if err != nil {
+		dberror(w, r, "Error Inserting Vehicle", err)
+		return
+	}
+	j, err := json.Marshal(&v)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func listVehiclesHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	lq, err := getListQuery(r)
+	if err != nil {
+		dberror(w, r, "Error fetching Vehicles", err)
+		return
+	}
+	vv, p, err := db100.GetVehiclesPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Vehicles", err)
+		return
+	}
+	j, err := json.Marshal(&vv)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+	setListPage(w, p)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(j)
+}
+
+func getVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	v := db100.Vehicle{VehicleID: id}
+	err = v.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Vehicle", err)
+		return
+	}
+	j, err := json.Marshal(&v)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	writeVersioned(w, r, v.Version, j)
+}
+
+func patchVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	ve := db100.Vehicle{VehicleID: id}
+	err = ve.GetDetails(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Vehicle", err)
+		return
+	}
+	err = mergePatch(r, &ve)
+	if err != nil {
+		patcherror(w, r, "Error patching Vehicle", err)
+		return
+	}
+	ve.VehicleID = id
+	ve.Version = v
+	err = ve.Update(r.Context())
+	if err != nil {
+		dberror(w, r, "Error updating Vehicle", err)
+		return
+	}
+	j, err := json.Marshal(&ve)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
+	writeVersioned(w, r, ve.Version, j)
+}
+
+func deleteVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_ADMIN)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	if !checkIfMatch(w, r, &db100.Vehicle{}, id) {
+		return
+	}
+	v := db100.Vehicle{VehicleID: id}
+	err = v.Delete(r.Context())
+	if err != nil {
+		dberror(w, r, "Error deleting Vehicle", err)
+		return
+	}
+}
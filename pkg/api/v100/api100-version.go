@@ -0,0 +1,89 @@
+package api100
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+)
+
+// etag returns the entity tag of a response: the version of the row, which changes are based on
+// with If-Match, and a hash of the body, so conditional GETs also notice changes of included rows.
+func etag(version int, body []byte) string {
+	h := sha1.Sum(body)
+	return `"` + strconv.Itoa(version) + "-" + hex.EncodeToString(h[:4]) + `"`
+}
+
+// writeVersioned writes the json body with its ETag. A GET for a tag the client already has
+// in If-None-Match is answered with 304 Not Modified and no body.
+func writeVersioned(w http.ResponseWriter, r *http.Request, version int, body []byte) {
+	t := etag(version, body)
+	w.Header().Set("ETag", t)
+	if r.Method == "GET" && matchesETag(r.Header.Get("If-None-Match"), t) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func matchesETag(header string, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// getIfMatch returns the version a change is based on from the ETag in If-Match. Changes without
+// If-Match are answered with 428 Precondition Required, If-Match: * changes any version.
+func getIfMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	h := strings.TrimPrefix(strings.TrimSpace(r.Header.Get("If-Match")), "W/")
+	switch h {
+	case "":
+		apierror(w, r, "Changes require the ETag of the resource in If-Match", http.StatusPreconditionRequired, ERROR_PRECONDITIONREQUIRED)
+		return 0, false
+	case "*":
+		return 0, true
+	}
+	v, err := strconv.Atoi(strings.SplitN(strings.Trim(h, `"`), "-", 2)[0])
+	if err != nil || v <= 0 {
+		apierror(w, r, "If-Match is not an ETag of this server: "+h, http.StatusPreconditionFailed, ERROR_VERSIONCONFLICT)
+		return 0, false
+	}
+	return v, true
+}
+
+// checkIfMatch answers with 412 Precondition Failed unless the row of the model with the id is
+// still at the version in If-Match. It returns false if the response is complete.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, model interface{}, id int) bool {
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return false
+	}
+	err := db100.CheckVersion(r.Context(), model, id, v)
+	if err != nil {
+		dberror(w, r, "Error checking version", err)
+		return false
+	}
+	return true
+}
+
+// matchVersion answers with 412 Precondition Failed unless the current version of the entity
+// with the id matches If-Match. It returns false if the response is complete.
+func matchVersion(w http.ResponseWriter, r *http.Request, entity string, id int, current int) bool {
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return false
+	}
+	if v != 0 && v != current {
+		dberror(w, r, "Error checking version", &db100.VersionConflict{Entity: entity, ID: id, Version: v})
+		return false
+	}
+	return true
+}
@@ -20,6 +20,11 @@ func getWishlistRouter(prefix string) *interpose.Middleware {
 	/*r.HandleFunc("/{ID}/Items", getWishlistItemsHandler).Methods("GET")
 	r.HandleFunc("/{ID}/Item/{IID}/{Count}", addWishlistItemHandler).Methods("POST")
 	r.HandleFunc("/{ID}/Item/{IID}", removeWishlistItemHandler).Methods("DELETE")*/
+	r.HandleFunc("/{ID}/items", getWishlistContentHandler).Methods("GET")
+	r.HandleFunc("/{ID}/equipment/{EID}", addWishlistEquipmentHandler).Methods("POST")
+	r.HandleFunc("/{ID}/equipment/{EID}", removeWishlistEquipmentHandler).Methods("DELETE")
+	r.HandleFunc("/{ID}/category/{CID}", addWishlistCategoryHandler).Methods("POST")
+	r.HandleFunc("/{ID}/category/{CID}", removeWishlistCategoryHandler).Methods("DELETE")
 	return m
 }
 
@@ -36,9 +41,9 @@ func postWishlistHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
 		return
 	}
-	err = wi.Insert()
+	err = wi.Insert(r.Context())
 	if err != nil {
-		apierror(w, r, "Error Inserting Wishlist: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error Inserting Wishlist", err)
 		return
 	}
 	j, err := json.Marshal(&wi)
@@ -52,9 +57,14 @@ func postWishlistHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func listWishlistsHandler(w http.ResponseWriter, r *http.Request) {
-	ww, err := db100.GetWishlists()
+	lq, err := getListQuery(r)
 	if err != nil {
-		apierror(w, r, "Error fetching Wishinglists: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Wishinglists", err)
+		return
+	}
+	ww, p, err := db100.GetWishlistsPage(r.Context(), lq)
+	if err != nil {
+		dberror(w, r, "Error fetching Wishinglists", err)
 		return
 	}
 	j, err := json.Marshal(&ww)
@@ -63,6 +73,7 @@ func listWishlistsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setListPage(w, p)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(j)
 }
@@ -76,9 +87,9 @@ func getWishlistHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	wi := db100.Wishlist{WishlistID: id}
-	err = wi.GetDetails()
+	err = wi.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, "Error fetching Wishlist: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Wishlist", err)
 		return
 	}
 	j, err := json.Marshal(&wi)
@@ -87,8 +98,7 @@ func getWishlistHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(j)
+	writeVersioned(w, r, wi.Version, j)
 }
 
 func patchWishlistHandler(w http.ResponseWriter, r *http.Request) {
@@ -104,17 +114,26 @@ func patchWishlistHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
-	decoder := json.NewDecoder(r.Body)
-	var wi db100.Wishlist
-	err = decoder.Decode(&wi)
+	v, ok := getIfMatch(w, r)
+	if !ok {
+		return
+	}
+	wi := db100.Wishlist{WishlistID: id}
+	err = wi.GetDetails(r.Context())
 	if err != nil {
-		apierror(w, r, err.Error(), http.StatusBadRequest, ERROR_JSONERROR)
+		dberror(w, r, "Error fetching Wishlist", err)
+		return
+	}
+	err = mergePatch(r, &wi)
+	if err != nil {
+		patcherror(w, r, "Error patching Wishlist", err)
 		return
 	}
 	wi.WishlistID = id
-	err = wi.Update()
+	wi.Version = v
+	err = wi.Update(r.Context())
 	if err != nil {
-		apierror(w, r, "Error updating Wishlist: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error updating Wishlist", err)
 		return
 	}
 	j, err := json.Marshal(&wi)
@@ -123,11 +142,118 @@ func patchWishlistHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	writeVersioned(w, r, wi.Version, j)
+}
+
+func deleteWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	if !checkIfMatch(w, r, &db100.Wishlist{}, id) {
+		return
+	}
+	wi := db100.Wishlist{WishlistID: id}
+	err = wi.Delete(r.Context())
+	if err != nil {
+		dberror(w, r, "Error deleting Wishlist", err)
+		return
+	}
+}
+
+func getWishlistContentHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	wi := db100.Wishlist{WishlistID: id}
+	var wcr wishlistContentResponse
+	wcr.Equipment, err = wi.GetWishlistItems(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Wishlist Equipment", err)
+		return
+	}
+	wcr.Categories, err = wi.GetWishlistCategories(r.Context())
+	if err != nil {
+		dberror(w, r, "Error fetching Wishlist Categories", err)
+		return
+	}
+	j, err := json.Marshal(&wcr)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusInternalServerError, ERROR_JSONERROR)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(j)
 }
 
-func deleteWishlistHandler(w http.ResponseWriter, r *http.Request) {
+func addWishlistEquipmentHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	ei := vars["EID"]
+	eid, err := strconv.Atoi(ei)
+	if err != nil {
+		apierror(w, r, "Error converting Equipment ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	wi := db100.Wishlist{WishlistID: id}
+	err = wi.AddWishlistItem(r.Context(), db100.Equipment{EquipmentID: eid})
+	if err != nil {
+		dberror(w, r, "Error adding Equipment to Wishlist", err)
+		return
+	}
+}
+
+func removeWishlistEquipmentHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	ei := vars["EID"]
+	eid, err := strconv.Atoi(ei)
+	if err != nil {
+		apierror(w, r, "Error converting Equipment ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	wi := db100.Wishlist{WishlistID: id}
+	err = wi.RemoveWishlistItem(r.Context(), db100.Equipment{EquipmentID: eid})
+	if err != nil {
+		dberror(w, r, "Error removing Equipment from Wishlist", err)
+		return
+	}
+}
+
+func addWishlistCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
 	if err != nil {
 		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
@@ -140,10 +266,43 @@ func deleteWishlistHandler(w http.ResponseWriter, r *http.Request) {
 		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
 		return
 	}
+	ci := vars["CID"]
+	cid, err := strconv.Atoi(ci)
+	if err != nil {
+		apierror(w, r, "Error converting Category ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	wi := db100.Wishlist{WishlistID: id}
+	err = wi.AddWishlistCategory(r.Context(), db100.Category{CategoryID: cid})
+	if err != nil {
+		dberror(w, r, "Error adding Category to Wishlist", err)
+		return
+	}
+}
+
+func removeWishlistCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	err := userhasrRight(r, db100.USERRIGHT_MEMBER)
+	if err != nil {
+		apierror(w, r, err.Error(), http.StatusUnauthorized, ERROR_USERNOTAUTHORIZED)
+		return
+	}
+	vars := mux.Vars(r)
+	i := vars["ID"]
+	id, err := strconv.Atoi(i)
+	if err != nil {
+		apierror(w, r, "Error converting ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
+	ci := vars["CID"]
+	cid, err := strconv.Atoi(ci)
+	if err != nil {
+		apierror(w, r, "Error converting Category ID: "+err.Error(), http.StatusBadRequest, ERROR_INVALIDPARAMETER)
+		return
+	}
 	wi := db100.Wishlist{WishlistID: id}
-	err = wi.Delete()
+	err = wi.RemoveWishlistCategory(r.Context(), db100.Category{CategoryID: cid})
 	if err != nil {
-		apierror(w, r, "Error deleting Wishlist: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error removing Category from Wishlist", err)
 		return
 	}
 }
@@ -178,7 +337,7 @@ func addWishlistItemHandler(w http.ResponseWriter, r *http.Request) {
 
 	err = wli.Insert()
 	if err != nil {
-		apierror(w, r, "Error inserting Item to Wishlist: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error inserting Item to Wishlist", err)
 		return
 	}
 
@@ -207,7 +366,7 @@ func removeWishlistItemHandler(w http.ResponseWriter, r *http.Request) {
 
 	err = wli.Delete()
 	if err != nil {
-		apierror(w, r, "Error deleting Item from Wishlist: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error deleting Item from Wishlist", err)
 		return
 	}
 
@@ -224,7 +383,7 @@ func getWishlistItemsHandler(w http.ResponseWriter, r *http.Request) {
 	wi := db100.Wishlist{WishlistID: id}
 	ee, err := wi.GetWishlistItems()
 	if err != nil {
-		apierror(w, r, "Error fetching Wishlistitems: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching Wishlistitems", err)
 		return
 	}
 	var wir []wishlistItemsResponse
@@ -232,7 +391,7 @@ func getWishlistItemsHandler(w http.ResponseWriter, r *http.Request) {
 		wli := db100.Wishlistitem{WishlistID: wi.WishlistID, EquipmentID: e.EquipmentID}
 		err := wli.GetDetails()
 		if err != nil {
-			apierror(w, r, "Error fetching Wishlistitem Details: "+err.Error(), http.StatusInternalServerError, ERROR_DBQUERYFAILED)
+			dberror(w, r, "Error fetching Wishlistitem Details", err)
 			return
 		}
 		w := wishlistItemsResponse{Equipment: e, Count: wli.Count}
@@ -1,10 +1,14 @@
 package api100
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -18,21 +22,25 @@ import (
 	jwt "gopkg.in/dgrijalva/jwt-go.v2"
 )
 
-func GetSubrouter(prefix string) *interpose.Middleware {
+// GetSubrouter returns the api routes. Items and boxes are served from repo.
+func GetSubrouter(prefix string, repo db100.Repositories) *interpose.Middleware {
 	middle100 := interpose.New()
 	//middle800.Use(apiglobal.LoggerMiddleware())
+	middle100.Use(requestIDMiddleware())
+	middle100.Use(timeoutMiddleware())
 
 	a100 := mux.NewRouter().PathPrefix(prefix).Subrouter()
 	a100 = a100.StrictSlash(true)
 	a100.HandleFunc("/auth", authHandler).Methods("GET")
 	a100.HandleFunc("/auth-refesh", authRefreshHandler).Methods("GET")
+	a100.HandleFunc("/errors", listErrorsHandler).Methods("GET")
 	a100user := getUserRouter(prefix + "/user")
 	a100.PathPrefix("/user").Handler(a100user)
 
-	a100item := getItemRouter(prefix + "/item")
+	a100item := getItemRouter(prefix+"/item", repo)
 	a100.PathPrefix("/item").Handler(a100item)
 
-	a100box := getBoxRouter(prefix + "/box")
+	a100box := getBoxRouter(prefix+"/box", repo)
 	a100.PathPrefix("/box").Handler(a100box)
 
 	a100store := getStoreRouter(prefix + "/store")
@@ -53,6 +61,39 @@ func GetSubrouter(prefix string) *interpose.Middleware {
 	a100wishlist := getWishlistRouter(prefix + "/wishlist")
 	a100.PathPrefix("/wishlist").Handler(a100wishlist)
 
+	a100vehicle := getVehicleRouter(prefix + "/vehicle")
+	a100.PathPrefix("/vehicle").Handler(a100vehicle)
+
+	a100transfer := getTransferRouter(prefix + "/transfer")
+	a100.PathPrefix("/transfer").Handler(a100transfer)
+
+	a100location := getLocationRouter(prefix + "/location")
+	a100.PathPrefix("/location").Handler(a100location)
+
+	a100audit := getAuditRouter(prefix + "/audit")
+	a100.PathPrefix("/audit").Handler(a100audit)
+
+	a100category := getCategoryRouter(prefix + "/category")
+	a100.PathPrefix("/category").Handler(a100category)
+
+	a100asset := getAssetRouter(prefix + "/asset")
+	a100.PathPrefix("/asset").Handler(a100asset)
+
+	a100attachment := getAttachmentRouter(prefix + "/attachment")
+	a100.PathPrefix("/attachment").Handler(a100attachment)
+
+	a100consumable := getConsumableRouter(prefix + "/consumable")
+	a100.PathPrefix("/consumable").Handler(a100consumable)
+
+	a100inspection := getInspectionRouter(prefix + "/inspection")
+	a100.PathPrefix("/inspection").Handler(a100inspection)
+
+	a100trash := getTrashRouter(prefix + "/trash")
+	a100.PathPrefix("/trash").Handler(a100trash)
+
+	a100search := getSearchRouter(prefix + "/search")
+	a100.PathPrefix("/search").Handler(a100search)
+
 	middle100.UseHandler(a100)
 	return middle100
 }
@@ -105,7 +146,7 @@ func getTokenfromRequest(r *http.Request) (*jwt.Token, error) {
 	return token, err
 }
 
-func getUserfromToken(token *jwt.Token) (db100.User, error) {
+func getUserfromToken(ctx context.Context, token *jwt.Token) (db100.User, error) {
 	un := db100.User{}
 
 	ui, ok := token.Claims["user"].(float64)
@@ -115,11 +156,19 @@ func getUserfromToken(token *jwt.Token) (db100.User, error) {
 
 	uid := int(ui)
 	un.UserID = uid
-	un.GetDetails()
+	un.GetDetails(ctx)
 
 	return un, nil
 }
 
+func getUserfromRequest(r *http.Request) (db100.User, error) {
+	token, err := getTokenfromRequest(r)
+	if err != nil {
+		return db100.User{}, err
+	}
+	return getUserfromToken(r.Context(), token)
+}
+
 func GetNewSubrouter(prefix string) (*mux.Router, *interpose.Middleware) {
 	m := interpose.New()
 	//m.Use(apiglobal.LoggerMiddleware())
@@ -134,9 +183,18 @@ func GetNewSubrouter(prefix string) (*mux.Router, *interpose.Middleware) {
 }
 
 func apierror(w http.ResponseWriter, r *http.Request, err string, httpcode int, ecode APIErrorcode) {
+	apifielderror(w, r, err, httpcode, ecode, nil)
+}
+
+// apifielderror is apierror for requests with refused fields, they are listed in the response.
+func apifielderror(w http.ResponseWriter, r *http.Request, err string, httpcode int, ecode APIErrorcode, fields []FieldError) {
 	//Erzeugt einen json error Response und gibt ihn über http.Error zurück
-	log.Println(err)
-	er := ErrorResponse{strconv.Itoa(httpcode), strconv.Itoa(int(ecode)), ecode.String() + ":" + err}
+	id := getRequestID(r)
+	log.Println(id, err)
+	if httpcode >= http.StatusInternalServerError && r.Context().Err() == context.DeadlineExceeded {
+		httpcode, ecode = http.StatusServiceUnavailable, ERROR_TIMEOUT
+	}
+	er := ErrorResponse{httpcode, ecode, ecode.String() + ":" + err, id, fields}
 	j, erro := json.Marshal(&er)
 	if erro != nil {
 		return
@@ -154,6 +212,58 @@ func getAuthorization(r *http.Request) (string, string, error) {
 	return s[0], s[1], nil
 }
 
+type requestIDKey struct{}
+
+// requestIDHeader carries the id of a request. An id sent by the client is kept, so requests can
+// be traced through proxies, otherwise a random one is generated.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDMiddleware gives every request an id, it is answered in the X-Request-ID header and
+// in the body of errors.
+func requestIDMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestIDHeader)
+			if id == "" || len(id) > 64 {
+				id = newRequestID()
+			}
+			w.Header().Set(requestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+func newRequestID() string {
+	buf := make([]byte, 8)
+	_, err := io.ReadFull(rand.Reader, buf)
+	if err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func getRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// timeoutMiddleware gives every request the configured deadline. The database work of a request
+// stops at the deadline, and when the client disconnects before, as the server then cancels the
+// context of the request.
+func timeoutMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if global.Conf.Timeouts.Request <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), time.Duration(global.Conf.Timeouts.Request)*time.Second)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 func authMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -203,9 +313,9 @@ func authHandler(w http.ResponseWriter, r *http.Request) {
 
 	u, p := s[0], s[1]
 
-	b, err := db100.DoesUserExist(u)
+	b, err := db100.DoesUserExist(r.Context(), u)
 	if err != nil {
-		apierror(w, r, err.Error(), 500, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching User", err)
 		return
 	}
 	if !b {
@@ -214,9 +324,9 @@ func authHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	un := db100.User{Username: u}
-	err = un.GetDetailstoUsername()
+	err = un.GetDetailstoUsername(r.Context())
 	if err != nil {
-		apierror(w, r, err.Error(), 500, ERROR_DBQUERYFAILED)
+		dberror(w, r, "Error fetching User", err)
 		return
 	}
 
@@ -253,7 +363,7 @@ func authRefreshHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	un, err := getUserfromToken(token)
+	un, err := getUserfromToken(r.Context(), token)
 	if err != nil {
 		apierror(w, r, "Auth Request malformed", 401, ERROR_MALFORMEDAUTH)
 		return
@@ -282,7 +392,7 @@ func userhasrRight(r *http.Request, ri db100.UserRight) error {
 		return err
 	}
 
-	ou, err := getUserfromToken(token)
+	ou, err := getUserfromToken(r.Context(), token)
 	if err != nil {
 		return err
 	}
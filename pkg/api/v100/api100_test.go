@@ -0,0 +1,311 @@
+package api100
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chaosvermittlung/funkloch-server/internal/global"
+	"github.com/Chaosvermittlung/funkloch-server/internal/storage"
+	db100 "github.com/Chaosvermittlung/funkloch-server/pkg/db/v100"
+	"github.com/gorilla/mux"
+)
+
+func TestItemHandlers(t *testing.T) {
+	repo := db100.NewMemoryRepositories()
+	b := db100.Box{StoreID: 2, Description: "Funkkiste", Items: []db100.Item{{EquipmentID: 3, Description: "Handfunkgerät"}}}
+	err := repo.Boxes.Insert(context.Background(), &b)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	h := itemHandlers{repo}
+
+	r := httptest.NewRequest("GET", "/item/"+strconv.Itoa(b.Items[0].ItemID), nil)
+	r = mux.SetURLVars(r, map[string]string{"ID": strconv.Itoa(b.Items[0].ItemID)})
+	w := httptest.NewRecorder()
+	h.getItemHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 but got %v: %v", w.Code, w.Body)
+	}
+	var ir itemResponse
+	err = json.Unmarshal(w.Body.Bytes(), &ir)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if ir.Item.Description != "Handfunkgerät" || ir.Box.Description != "Funkkiste" {
+		t.Errorf("Expected Item in Funkkiste but got %v", ir)
+	}
+
+	r = httptest.NewRequest("GET", "/item/list?limit=1", nil)
+	w = httptest.NewRecorder()
+	h.listItemsHandler(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("X-Total-Count") != "1" {
+		t.Errorf("Expected one Item but got %v, %v", w.Code, w.Header())
+	}
+
+	r = httptest.NewRequest("GET", "/item/list?limit=x", nil)
+	w = httptest.NewRecorder()
+	h.listItemsHandler(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 but got %v", w.Code)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	h := itemHandlers{db100.NewMemoryRepositories()}
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	r := httptest.NewRequest("GET", "/item/list", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	h.listItemsHandler(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 but got %v", w.Code)
+	}
+}
+
+func TestItemVersions(t *testing.T) {
+	repo := db100.NewMemoryRepositories()
+	i := db100.Item{EquipmentID: 3, Description: "Akku"}
+	err := repo.Items.Insert(context.Background(), &i)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	h := itemHandlers{repo}
+	id := strconv.Itoa(i.ItemID)
+	get := func(inm string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/item/"+id, nil)
+		r = mux.SetURLVars(r, map[string]string{"ID": id})
+		if inm != "" {
+			r.Header.Set("If-None-Match", inm)
+		}
+		w := httptest.NewRecorder()
+		h.getItemHandler(w, r)
+		return w
+	}
+
+	w := get("")
+	tag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(tag, `"1-`) {
+		t.Fatalf("Expected 200 with ETag of version 1 but got %v, %v", w.Code, tag)
+	}
+	w = get(tag)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected 304 without body but got %v: %v", w.Code, w.Body)
+	}
+
+	ifMatch := func(im string) (int, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest("PATCH", "/item/"+id, nil)
+		if im != "" {
+			r.Header.Set("If-Match", im)
+		}
+		w := httptest.NewRecorder()
+		v, _ := getIfMatch(w, r)
+		return v, w
+	}
+	_, w = ifMatch("")
+	if w.Code != http.StatusPreconditionRequired {
+		t.Errorf("Expected 428 but got %v", w.Code)
+	}
+	_, w = ifMatch(`"x"`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 but got %v", w.Code)
+	}
+	v, _ := ifMatch(tag)
+	if v != 1 {
+		t.Fatalf("Expected version 1 but got %v", v)
+	}
+
+	i.Description = "Akku leer"
+	i.Version = v
+	err = repo.Items.Update(context.Background(), &i)
+	if err != nil || i.Version != 2 {
+		t.Fatalf("Expected version 2 but got %v, %v", i.Version, err)
+	}
+	i.Version = v
+	err = repo.Items.Update(context.Background(), &i)
+	w = httptest.NewRecorder()
+	dberror(w, httptest.NewRequest("PATCH", "/item/"+id, nil), "Error updating Item", err)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 but got %v, %v", w.Code, err)
+	}
+
+	w = get(tag)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("ETag"), `"2-`) {
+		t.Errorf("Expected 200 with ETag of version 2 but got %v, %v", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	b := db100.Box{BoxID: 5, StoreID: 2, Description: "Funkkiste", Weight: 12, LocationID: 4}
+	r := httptest.NewRequest("PATCH", "/box/5", strings.NewReader(`{"description": "x", "LocationID": null}`))
+	err := mergePatch(r, &b)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if b.Description != "x" || b.StoreID != 2 || b.Weight != 12 || b.LocationID != 0 {
+		t.Errorf("Expected patched Description and cleared LocationID but got %+v", b)
+	}
+
+	fp := faultPatchRequest{Fault: db100.Fault{FaultID: 1, Comment: "Antenne ab", AssigneeID: 3}}
+	r = httptest.NewRequest("PATCH", "/fault/1", strings.NewReader(`{"Note": "getauscht", "AssigneeID": 7}`))
+	err = mergePatch(r, &fp)
+	if err != nil || fp.Note != "getauscht" || fp.AssigneeID != 7 || fp.Comment != "Antenne ab" {
+		t.Errorf("Expected patched embedded Fault but got %+v, %v", fp, err)
+	}
+
+	r = httptest.NewRequest("PATCH", "/box/5", strings.NewReader(`{"Weight": "schwer", "Colour": "rot", "Description": "y"}`))
+	err = mergePatch(r, &b)
+	pe, ok := err.(*PatchError)
+	if !ok || len(pe.Fields) != 2 || pe.Fields[0].Field != "Colour" || pe.Fields[1].Field != "Weight" {
+		t.Fatalf("Expected errors for Colour and Weight but got %v", err)
+	}
+	w := httptest.NewRecorder()
+	patcherror(w, r, "Error patching Box", err)
+	var er ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &er)
+	if w.Code != http.StatusBadRequest || len(er.Details) != 2 {
+		t.Errorf("Expected 400 with two fields but got %v: %v", w.Code, w.Body)
+	}
+
+	r = httptest.NewRequest("PATCH", "/box/5", strings.NewReader(`{"BoxID": 5, "Version": 3, "DeletedAt": "2020-01-01T00:00:00Z", "Code": 7}`))
+	b.Version = 3
+	err = mergePatch(r, &b)
+	pe, ok = err.(*PatchError)
+	if !ok || len(pe.Fields) != 2 || pe.Fields[0].Field != "Code" || pe.Fields[1].Field != "DeletedAt" || pe.Fields[0].Code != patchReadOnly {
+		t.Errorf("Expected read-only errors for Code and DeletedAt but got %v", err)
+	}
+	if b.DeletedAt != nil {
+		t.Errorf("Expected DeletedAt to be kept but got %v", b.DeletedAt)
+	}
+
+	r = httptest.NewRequest("PATCH", "/box/5", strings.NewReader(`["Description"]`))
+	err = mergePatch(r, &b)
+	if err == nil {
+		t.Errorf("Expected error for patch that is no object")
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	repo := db100.NewMemoryRepositories()
+	i := db100.Item{EquipmentID: 3, BoxID: 42, ItemAsset: db100.ItemAsset{PurchasePrice: -5}}
+	err := repo.Items.Insert(context.Background(), &i)
+	w := httptest.NewRecorder()
+	dberror(w, httptest.NewRequest("POST", "/item/", nil), "Error Inserting Item", err)
+	var er ErrorResponse
+	err = json.Unmarshal(w.Body.Bytes(), &er)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if w.Code != http.StatusUnprocessableEntity || len(er.Details) != 2 || er.Details[0].Field != "BoxID" || er.Details[0].Code != db100.ViolationReference || er.Details[1].Code != db100.ViolationMin {
+		t.Errorf("Expected 422 with BoxID and PurchasePrice but got %v: %v", w.Code, w.Body)
+	}
+}
+
+func TestDBErrorStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   APIErrorcode
+	}{
+		{&db100.ListQueryError{Param: "sort", Reason: "unknown field"}, http.StatusBadRequest, ERROR_INVALIDPARAMETER},
+		{&db100.VersionConflict{Entity: "Box", ID: 1, Version: 1}, http.StatusPreconditionFailed, ERROR_VERSIONCONFLICT},
+		{&db100.ValidationError{Entity: "Box"}, http.StatusUnprocessableEntity, ERROR_VALIDATION},
+		{db100.ErrNotFound, http.StatusNotFound, ERROR_NOTFOUND},
+		{fmt.Errorf("Error getting Item Details:%w", db100.ErrNotFound), http.StatusNotFound, ERROR_NOTFOUND},
+		{&db100.ReferenceError{Entity: "Store", Referenced: "Boxes", Count: 2}, http.StatusConflict, ERROR_CONFLICT},
+		{&db100.PackingRefusal{Reasons: []string{"open faults"}}, http.StatusConflict, ERROR_CONFLICT},
+		{db100.ErrConstraint, http.StatusUnprocessableEntity, ERROR_CONSTRAINT},
+		{errors.New("database is locked"), http.StatusInternalServerError, ERROR_DBQUERYFAILED},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		dberror(w, httptest.NewRequest("GET", "/box/1", nil), "Error fetching Box", tt.err)
+		var er ErrorResponse
+		err := json.Unmarshal(w.Body.Bytes(), &er)
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		if w.Code != tt.status || er.Httpstatus != tt.status || er.Errorcode != tt.code {
+			t.Errorf("Expected %v with code %v for %v but got %v: %v", tt.status, tt.code, tt.err, w.Code, w.Body)
+		}
+	}
+}
+
+func TestErrorCatalogue(t *testing.T) {
+	w := httptest.NewRecorder()
+	listErrorsHandler(w, httptest.NewRequest("GET", "/errors", nil))
+	var dd []ErrorDefinition
+	err := json.Unmarshal(w.Body.Bytes(), &dd)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(dd) != int(ERROR_CONSTRAINT) {
+		t.Fatalf("Expected %v error codes but got %v", ERROR_CONSTRAINT, len(dd))
+	}
+	for n, d := range dd {
+		if d.Code != APIErrorcode(n+1) || d.Name == "" || d.Message == "" || d.Httpstatus == 0 {
+			t.Errorf("Expected complete definition of code %v but got %+v", n+1, d)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	h := requestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dberror(w, r, "Error fetching Box", db100.ErrNotFound)
+	}))
+	r := httptest.NewRequest("GET", "/box/1", nil)
+	r.Header.Set(requestIDHeader, "3f2a")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var er ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &er)
+	if er.RequestID != "3f2a" || w.Header().Get(requestIDHeader) != "3f2a" {
+		t.Errorf("Expected request id 3f2a but got %v, %v", er.RequestID, w.Header().Get(requestIDHeader))
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/box/1", nil))
+	json.Unmarshal(w.Body.Bytes(), &er)
+	if er.RequestID == "" || er.RequestID != w.Header().Get(requestIDHeader) {
+		t.Errorf("Expected generated request id but got %v, %v", er.RequestID, w.Header().Get(requestIDHeader))
+	}
+}
+
+func TestAttachmentDisposition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "funkloch-attachments")
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	attachmentStorage, err = storage.New(global.StorageConfig{Backend: "local", Path: dir})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	defer func() { attachmentStorage = nil }()
+	page := []byte("<html><script>alert(1)</script></html>")
+	err = attachmentStorage.Put("page", bytes.NewReader(page), int64(len(page)), "text/html")
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	writeAttachmentObject(w, httptest.NewRequest("GET", "/file", nil), "page", http.DetectContentType(page), "page.html", 0)
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment;") || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("Expected HTML as download with nosniff but got %v", w.Header())
+	}
+	w = httptest.NewRecorder()
+	writeAttachmentObject(w, httptest.NewRequest("GET", "/file", nil), "page", "image/png", "page.png", 0)
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "inline;") {
+		t.Errorf("Expected image inline but got %v", w.Header())
+	}
+}
@@ -0,0 +1,139 @@
+package db100
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ItemAsset is the asset metadata of an item. PurchasePrice is in cents.
+type ItemAsset struct {
+	Serial        string
+	Manufacturer  string
+	Supplier      string
+	PurchaseDate  time.Time
+	PurchasePrice int `gorm:"not null;default:0"`
+}
+
+type AssetEntry struct {
+	Item         ItemslistEntry
+	CurrentValue int
+}
+
+type AssetValue struct {
+	ID            int
+	Name          string
+	Count         int
+	PurchaseValue int
+	CurrentValue  int
+}
+
+// AssetReport lists the value of all items at Date. Items without a box are counted for store 0.
+type AssetReport struct {
+	Date          time.Time
+	Items         []AssetEntry
+	Stores        []AssetValue
+	Equipment     []AssetValue
+	PurchaseValue int
+	CurrentValue  int
+}
+
+func (i *Item) checkSerial(d *gorm.DB) error {
+	if i.Serial == "" {
+		return nil
+	}
+	var count int
+	err := d.Model(&Item{}).Where("equipment_id = ? and serial = ? and item_id <> ?", i.EquipmentID, i.Serial, i.ItemID).Count(&count)
+	if err.Error != nil {
+		return err.Error
+	}
+	if count > 0 {
+		return conflictError("Serial " + i.Serial + " already exists for this equipment")
+	}
+	return nil
+}
+
+// serialError returns the conflict if the write of the item failed because another item
+// took its serial since checkSerial, otherwise the error of the write.
+func (i *Item) serialError(d *gorm.DB, err error) error {
+	err2 := i.checkSerial(d)
+	if errors.Is(err2, ErrConflict) {
+		return err2
+	}
+	return err
+}
+
+// Depreciate returns the straight-line depreciated value of the asset at the given time.
+// Without a purchase date or depreciation period the purchase price is returned.
+func (a *ItemAsset) Depreciate(years int, at time.Time) int {
+	if years <= 0 || a.PurchaseDate.IsZero() || !at.After(a.PurchaseDate) {
+		return a.PurchasePrice
+	}
+	end := a.PurchaseDate.AddDate(years, 0, 0)
+	if !at.Before(end) {
+		return 0
+	}
+	life := end.Sub(a.PurchaseDate)
+	left := end.Sub(at)
+	return int(int64(a.PurchasePrice) * int64(left/time.Hour) / int64(life/time.Hour))
+}
+
+func addAssetValue(m map[int]*AssetValue, id int, name string, purchase, current int) {
+	v, ok := m[id]
+	if !ok {
+		v = &AssetValue{ID: id, Name: name}
+		m[id] = v
+	}
+	v.Count++
+	v.PurchaseValue += purchase
+	v.CurrentValue += current
+}
+
+func sortedAssetValues(m map[int]*AssetValue) []AssetValue {
+	var res []AssetValue
+	for _, v := range m {
+		res = append(res, *v)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// GetAssetReport values all items at the given time and totals them per store and per equipment.
+func GetAssetReport(ctx context.Context, at time.Time) (AssetReport, error) {
+	ar := AssetReport{Date: at}
+	var ile []ItemslistEntry
+	var ee []Equipment
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		ile, err = getItemsJoined(d, false)
+		if err != nil {
+			return err
+		}
+		return d.Find(&ee).Error
+	})
+	if err != nil {
+		return ar, err
+	}
+	years := make(map[int]int)
+	for _, e := range ee {
+		years[e.EquipmentID] = e.DepreciationYears
+	}
+	stores := make(map[int]*AssetValue)
+	equipment := make(map[int]*AssetValue)
+	for _, i := range ile {
+		cv := i.Depreciate(years[i.EquipmentID], at)
+		ar.Items = append(ar.Items, AssetEntry{Item: i, CurrentValue: cv})
+		addAssetValue(stores, i.StoreID, i.StoreName, i.PurchasePrice, cv)
+		addAssetValue(equipment, i.EquipmentID, i.EquipmentName, i.PurchasePrice, cv)
+		ar.PurchaseValue += i.PurchasePrice
+		ar.CurrentValue += cv
+	}
+	ar.Stores = sortedAssetValues(stores)
+	ar.Equipment = sortedAssetValues(equipment)
+	return ar, nil
+}
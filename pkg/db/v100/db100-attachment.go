@@ -0,0 +1,142 @@
+package db100
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Chaosvermittlung/funkloch-server/internal/storage"
+	"github.com/jinzhu/gorm"
+)
+
+type AttachmentOwner string
+
+const (
+	AttachmentOwnerItem      AttachmentOwner = "item"
+	AttachmentOwnerBox       AttachmentOwner = "box"
+	AttachmentOwnerEquipment AttachmentOwner = "equipment"
+	AttachmentOwnerFault     AttachmentOwner = "fault"
+	AttachmentOwnerEvent     AttachmentOwner = "event"
+)
+
+// Attachment is the metadata of a file stored in the attachment storage backend under StorageKey.
+// ThumbnailKey is empty if no thumbnail could be generated.
+type Attachment struct {
+	AttachmentID int             `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	OwnerType    AttachmentOwner `gorm:"not null"`
+	OwnerID      int             `gorm:"not null"`
+	Filename     string          `gorm:"not null"`
+	ContentType  string          `gorm:"not null"`
+	Size         int64           `gorm:"not null"`
+	MD5          string          `gorm:"not null"`
+	SHA256       string          `gorm:"not null"`
+	StorageKey   string          `gorm:"not null"`
+	ThumbnailKey string
+	UploaderID   int `gorm:"not null;default:0"`
+	Uploaded     time.Time
+}
+
+// CheckOwner returns an error if the owner type is unknown or the owner does not exist.
+func (a *Attachment) CheckOwner(ctx context.Context) error {
+	var err error
+	switch a.OwnerType {
+	case AttachmentOwnerItem:
+		o := Item{ItemID: a.OwnerID}
+		err = o.GetDetails(ctx)
+	case AttachmentOwnerBox:
+		o := Box{BoxID: a.OwnerID}
+		err = o.GetDetails(ctx)
+	case AttachmentOwnerEquipment:
+		o := Equipment{EquipmentID: a.OwnerID}
+		err = o.GetDetails(ctx)
+	case AttachmentOwnerFault:
+		o := Fault{FaultID: a.OwnerID}
+		err = o.GetDetails(ctx)
+	case AttachmentOwnerEvent:
+		o := Event{EventID: a.OwnerID}
+		err = o.GetDetails(ctx)
+	default:
+		return constraintError("Unknown attachment owner " + string(a.OwnerType))
+	}
+	if err != nil {
+		return fmt.Errorf("Error getting %s %d: %w", a.OwnerType, a.OwnerID, err)
+	}
+	return nil
+}
+
+func (a *Attachment) Insert(ctx context.Context) error {
+	err := a.CheckOwner(ctx)
+	if err != nil {
+		return err
+	}
+	a.Uploaded = time.Now()
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Create(&a).Error
+	})
+}
+
+func (a *Attachment) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&a, a.AttachmentID).Error
+	})
+}
+
+func (a *Attachment) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Delete(&a).Error
+	})
+}
+
+// attachmentStorage is the backend the files of attachments deleted with their owner are removed from.
+var attachmentStorage storage.Backend
+
+// SetAttachmentStorage sets the attachment storage backend.
+func SetAttachmentStorage(b storage.Backend) {
+	attachmentStorage = b
+}
+
+// deleteAttachments deletes the attachments of the owners and returns the storage keys of their files.
+// The files are removed with removeAttachmentFiles once the transaction is committed.
+func deleteAttachments(d *gorm.DB, ownerType AttachmentOwner, ownerIDs []int) ([]string, error) {
+	var aa []Attachment
+	q := d.Where("owner_type = ? and owner_id in (?)", ownerType, ownerIDs)
+	err := q.Find(&aa)
+	if err.Error != nil || len(aa) == 0 {
+		return nil, err.Error
+	}
+	var keys []string
+	for _, a := range aa {
+		keys = append(keys, a.StorageKey)
+		if a.ThumbnailKey != "" {
+			keys = append(keys, a.ThumbnailKey)
+		}
+	}
+	err = q.Delete(Attachment{})
+	return keys, err.Error
+}
+
+// removeAttachmentFiles removes the files of deleted attachments from the storage backend.
+// The attachments are already gone, so errors are only logged.
+func removeAttachmentFiles(keys []string) {
+	if attachmentStorage == nil {
+		if len(keys) > 0 {
+			log.Println("Attachment storage not configured, keeping", len(keys), "files")
+		}
+		return
+	}
+	for _, k := range keys {
+		err := attachmentStorage.Delete(k)
+		if err != nil && err != storage.ErrNotFound {
+			log.Println("Error deleting attachment file "+k+":", err)
+		}
+	}
+}
+
+func GetAttachments(ctx context.Context, ownerType AttachmentOwner, ownerID int) ([]Attachment, error) {
+	var aa []Attachment
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("owner_type = ? and owner_id = ?", ownerType, ownerID).Order("uploaded asc").Find(&aa).Error
+	})
+	return aa, err
+}
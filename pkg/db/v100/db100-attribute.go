@@ -0,0 +1,377 @@
+package db100
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type AttributeType int
+
+const (
+	AttributeTypeString AttributeType = 1 + iota
+	AttributeTypeInt
+	AttributeTypeEnum
+	AttributeTypeDate
+	AttributeTypeMAC
+)
+
+const attributeDateLayout = "2006-01-02"
+
+// Attribute is a typed field of the attribute schema of an equipment.
+// Options holds the comma separated allowed values of enum attributes.
+type Attribute struct {
+	AttributeID int           `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	EquipmentID int           `gorm:"not null"`
+	Name        string        `gorm:"not null"`
+	Type        AttributeType `gorm:"not null"`
+	Options     string
+	Required    bool `gorm:"not null;default:false"`
+}
+
+type AttributeValue struct {
+	ItemID      int    `gorm:"type:integer;primary_key;not null"`
+	AttributeID int    `gorm:"type:integer;primary_key;not null"`
+	Value       string `gorm:"not null"`
+}
+
+type ItemAttribute struct {
+	Attribute Attribute
+	Value     string
+}
+
+// AttributeFilter compares the value of the attribute Name with Value.
+// Op is one of =, !=, <, <=, > and >=.
+type AttributeFilter struct {
+	Name  string
+	Op    string
+	Value string
+}
+
+func (a *Attribute) validate(d *gorm.DB) error {
+	if a.Name == "" {
+		return constraintError("Attribute name is empty")
+	}
+	if a.Type < AttributeTypeString || a.Type > AttributeTypeMAC {
+		return constraintError("Attribute type out of bound")
+	}
+	if a.Type == AttributeTypeEnum && len(a.GetOptions()) == 0 {
+		return constraintError("Enum attribute without options")
+	}
+	var count int
+	err := d.Model(&Attribute{}).Where("equipment_id = ? and name = ? and attribute_id <> ?", a.EquipmentID, a.Name, a.AttributeID).Count(&count)
+	if err.Error != nil {
+		return err.Error
+	}
+	if count > 0 {
+		return conflictError("Attribute " + a.Name + " already exists")
+	}
+	return nil
+}
+
+func (a *Attribute) GetOptions() []string {
+	var oo []string
+	for _, o := range strings.Split(a.Options, ",") {
+		o = strings.TrimSpace(o)
+		if o != "" {
+			oo = append(oo, o)
+		}
+	}
+	return oo
+}
+
+// Normalize checks that v is a valid value of the attribute and returns it in its stored form.
+func (a *Attribute) Normalize(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	switch a.Type {
+	case AttributeTypeString:
+		return v, nil
+	case AttributeTypeInt:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return v, constraintError("Attribute " + a.Name + " is not an integer")
+		}
+		return strconv.Itoa(n), nil
+	case AttributeTypeEnum:
+		for _, o := range a.GetOptions() {
+			if o == v {
+				return v, nil
+			}
+		}
+		return v, constraintError("Attribute " + a.Name + " must be one of " + a.Options)
+	case AttributeTypeDate:
+		d, err := time.Parse(attributeDateLayout, v)
+		if err != nil {
+			return v, constraintError("Attribute " + a.Name + " is not a date (YYYY-MM-DD)")
+		}
+		return d.Format(attributeDateLayout), nil
+	case AttributeTypeMAC:
+		m, err := net.ParseMAC(v)
+		if err != nil {
+			return v, constraintError("Attribute " + a.Name + " is not a MAC address")
+		}
+		return m.String(), nil
+	}
+	return v, constraintError("Attribute type out of bound")
+}
+
+// compare returns -1, 0 or 1 depending on whether x is less, equal or greater than y.
+func (a *Attribute) compare(x, y string) int {
+	if a.Type == AttributeTypeInt {
+		nx, _ := strconv.Atoi(x)
+		ny, _ := strconv.Atoi(y)
+		switch {
+		case nx < ny:
+			return -1
+		case nx > ny:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(x, y)
+}
+
+func (a *Attribute) Insert(ctx context.Context) error {
+	e := Equipment{EquipmentID: a.EquipmentID}
+	err := e.GetDetails(ctx)
+	if err != nil {
+		return err
+	}
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := a.validate(d)
+		if err != nil {
+			return err
+		}
+		return d.Create(&a).Error
+	})
+}
+
+func (a *Attribute) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&a, a.AttributeID).Error
+	})
+}
+
+// Update changes the attribute definition. The type can not be changed once values are stored.
+func (a *Attribute) Update(ctx context.Context) error {
+	oa := Attribute{AttributeID: a.AttributeID}
+	err := oa.GetDetails(ctx)
+	if err != nil {
+		return err
+	}
+	a.EquipmentID = oa.EquipmentID
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := a.validate(d)
+		if err != nil {
+			return err
+		}
+		if a.Type != oa.Type {
+			var count int
+			err := d.Model(&AttributeValue{}).Where("attribute_id = ?", a.AttributeID).Count(&count)
+			if err.Error != nil {
+				return err.Error
+			}
+			if count > 0 {
+				return conflictError("Attribute type can not be changed while items have values")
+			}
+		}
+		return d.Save(&a).Error
+	})
+}
+
+// Delete removes the attribute together with all its stored values.
+func (a *Attribute) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.Where("attribute_id = ?", a.AttributeID).Delete(AttributeValue{})
+		if err.Error != nil {
+			return err.Error
+		}
+		return d.Delete(&a).Error
+	})
+}
+
+func (e *Equipment) GetAttributes(ctx context.Context) ([]Attribute, error) {
+	var aa []Attribute
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("equipment_id = ?", e.EquipmentID).Order("name asc").Find(&aa).Error
+	})
+	return aa, err
+}
+
+// GetAttributes returns the attribute schema of the equipment of the item with the stored values.
+func (i *Item) GetAttributes(ctx context.Context) ([]ItemAttribute, error) {
+	var ia []ItemAttribute
+	err := i.GetDetails(ctx)
+	if err != nil {
+		return ia, err
+	}
+	e := Equipment{EquipmentID: i.EquipmentID}
+	aa, err := e.GetAttributes(ctx)
+	if err != nil {
+		return ia, err
+	}
+	var vv []AttributeValue
+	err = inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("item_id = ?", i.ItemID).Find(&vv).Error
+	})
+	if err != nil {
+		return ia, err
+	}
+	values := make(map[int]string)
+	for _, v := range vv {
+		values[v.AttributeID] = v.Value
+	}
+	for _, a := range aa {
+		ia = append(ia, ItemAttribute{Attribute: a, Value: values[a.AttributeID]})
+	}
+	return ia, nil
+}
+
+// SetAttributes stores the given values by attribute name. An empty value removes the stored value.
+// All values are validated before anything is written and required attributes must keep a value.
+func (i *Item) SetAttributes(ctx context.Context, values map[string]string) ([]ItemAttribute, error) {
+	ia, err := i.GetAttributes(ctx)
+	if err != nil {
+		return ia, err
+	}
+	known := make(map[string]bool)
+	for n := range ia {
+		a := &ia[n].Attribute
+		known[a.Name] = true
+		v, ok := values[a.Name]
+		if !ok {
+			continue
+		}
+		if v != "" {
+			v, err = a.Normalize(v)
+			if err != nil {
+				return ia, err
+			}
+		}
+		ia[n].Value = v
+	}
+	for name := range values {
+		if !known[name] {
+			return ia, constraintError("Unknown attribute " + name)
+		}
+	}
+	for _, a := range ia {
+		if a.Attribute.Required && a.Value == "" {
+			return ia, constraintError("Attribute " + a.Attribute.Name + " is required")
+		}
+	}
+	err = inContext(ctx, db, func(d *gorm.DB) error {
+		for _, a := range ia {
+			if _, ok := values[a.Attribute.Name]; !ok {
+				continue
+			}
+			err := d.Where("item_id = ? and attribute_id = ?", i.ItemID, a.Attribute.AttributeID).Delete(AttributeValue{})
+			if err.Error == nil && a.Value != "" {
+				err = d.Create(&AttributeValue{ItemID: i.ItemID, AttributeID: a.Attribute.AttributeID, Value: a.Value})
+			}
+			if err.Error != nil {
+				return err.Error
+			}
+		}
+		return nil
+	})
+	return ia, err
+}
+
+func (f *AttributeFilter) matches(a Attribute, v string) (bool, error) {
+	fv, err := a.Normalize(f.Value)
+	if err != nil {
+		return false, err
+	}
+	c := a.compare(v, fv)
+	switch f.Op {
+	case "=":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return false, constraintError("Unknown attribute operator " + f.Op)
+}
+
+type attributeValueRow struct {
+	ItemID      int
+	AttributeID int
+	Value       string
+}
+
+// getItemsMatchingAttributes returns the IDs of the items that match all filters.
+// Items without a value for a filtered attribute never match.
+func getItemsMatchingAttributes(d *gorm.DB, ff []AttributeFilter) ([]int, error) {
+	var ids []int
+	matching := make(map[int]int)
+	for _, f := range ff {
+		var aa []Attribute
+		err := d.Where("name = ?", f.Name).Find(&aa)
+		if err.Error != nil {
+			return ids, err.Error
+		}
+		attributes := make(map[int]Attribute)
+		var aids []int
+		for _, a := range aa {
+			attributes[a.AttributeID] = a
+			aids = append(aids, a.AttributeID)
+		}
+		if len(aids) == 0 {
+			continue
+		}
+		var rows []attributeValueRow
+		err = d.Table("attribute_values").Where("attribute_id in (?)", aids).Scan(&rows)
+		if err.Error != nil {
+			return ids, err.Error
+		}
+		for _, r := range rows {
+			ok, err := f.matches(attributes[r.AttributeID], r.Value)
+			if err != nil {
+				return ids, err
+			}
+			if ok {
+				matching[r.ItemID]++
+			}
+		}
+	}
+	for id, n := range matching {
+		if n == len(ff) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// FilterItemsByAttributes returns the items that match all filters.
+func FilterItemsByAttributes(ile []ItemslistEntry, ff []AttributeFilter) ([]ItemslistEntry, error) {
+	if len(ff) == 0 {
+		return ile, nil
+	}
+	var res []ItemslistEntry
+	ids, err := getItemsMatchingAttributes(db, ff)
+	if err != nil {
+		return res, err
+	}
+	matching := make(map[int]bool)
+	for _, id := range ids {
+		matching[id] = true
+	}
+	for _, i := range ile {
+		if matching[i.ItemID] {
+			res = append(res, i)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,449 @@
+package db100
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type AuditStatus int
+
+const (
+	AuditStatusOpen AuditStatus = 0 + iota
+	AuditStatusClosed
+	AuditStatusApplied
+)
+
+type AuditCorrectionType int
+
+const (
+	AuditCorrectionMoveItem AuditCorrectionType = 1 + iota
+	AuditCorrectionLostItem
+	AuditCorrectionMoveBox
+)
+
+// Audit is a stocktaking of one store. When it is started the expected boxes
+// and items are snapshotted as AuditEntries and compared to the scans on close.
+type Audit struct {
+	AuditID int         `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	StoreID int         `gorm:"not null"`
+	Status  AuditStatus `gorm:"not null;default:0"`
+	Comment string
+	Started time.Time
+	Closed  time.Time
+}
+
+// AuditEntry is an expected box (ItemID = 0) or an expected item in BoxID.
+type AuditEntry struct {
+	AuditEntryID int `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	AuditID      int `gorm:"not null"`
+	BoxID        int `gorm:"not null;default:0"`
+	ItemID       int `gorm:"not null;default:0"`
+	Code         int `gorm:"type:integer(13);not null"`
+}
+
+// AuditScan is a scanned code. BoxCode is the box the code was found in, 0 if it was scanned loose.
+type AuditScan struct {
+	AuditScanID int       `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	AuditID     int       `gorm:"not null"`
+	Code        int       `gorm:"type:integer(13);not null"`
+	BoxCode     int       `gorm:"type:integer(13);not null;default:0"`
+	Scanned     time.Time `gorm:"not null"`
+}
+
+type AuditCorrection struct {
+	AuditCorrectionID int                 `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	AuditID           int                 `gorm:"not null"`
+	Type              AuditCorrectionType `gorm:"not null"`
+	BoxID             int                 `gorm:"not null;default:0"`
+	ItemID            int                 `gorm:"not null;default:0"`
+	ToBoxID           int                 `gorm:"not null;default:0"`
+}
+
+type AuditItem struct {
+	Item          Item
+	ExpectedBoxID int
+	ScannedBoxID  int
+}
+
+// AuditResult compares the snapshot of an audit with its scans. Boxes and items of the snapshot
+// that were moved to the trash while the audit was open are only listed as trashed.
+type AuditResult struct {
+	AuditID         int
+	Status          AuditStatus
+	FoundBoxes      []Box
+	MissingBoxes    []Box
+	UnexpectedBoxes []Box
+	FoundItems      []AuditItem
+	MissingItems    []Item
+	UnexpectedItems []AuditItem
+	UnknownCodes    []int
+	TrashedBoxes    []Box
+	TrashedItems    []Item
+	Corrections     []AuditCorrection
+}
+
+// Insert starts a new audit and snapshots the boxes and items currently booked on the store.
+func (a *Audit) Insert(ctx context.Context) error {
+	s := Store{StoreID: a.StoreID}
+	err := s.GetDetails(ctx)
+	if err != nil {
+		return err
+	}
+	bb, err := s.GetStoreBoxes(ctx)
+	if err != nil {
+		return err
+	}
+	a.Status = AuditStatusOpen
+	a.Started = time.Now()
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.Create(&a)
+		if err.Error != nil {
+			return err.Error
+		}
+		for _, b := range bb {
+			be := AuditEntry{AuditID: a.AuditID, BoxID: b.BoxID, Code: b.Code}
+			err = d.Create(&be)
+			if err.Error != nil {
+				return err.Error
+			}
+			var ii []Item
+			err = itemsNotInTransit(d.Where("box_id = ?", b.BoxID)).Find(&ii)
+			if err.Error != nil {
+				return err.Error
+			}
+			for _, i := range ii {
+				ie := AuditEntry{AuditID: a.AuditID, BoxID: b.BoxID, ItemID: i.ItemID, Code: i.Code}
+				err = d.Create(&ie)
+				if err.Error != nil {
+					return err.Error
+				}
+			}
+		}
+		return nil
+	})
+}
+
+var auditListFields = listFields{
+	"audit_id": {"audit_id", fieldInt},
+	"store_id": {"store_id", fieldInt},
+	"status":   {"status", fieldInt},
+	"started":  {"started", fieldDate},
+	"closed":   {"closed", fieldDate},
+}
+
+func GetAuditsPage(ctx context.Context, lq ListQuery) ([]Audit, ListPage, error) {
+	var a []Audit
+	p, err := getPage(ctx, db.Model(&Audit{}), &a, lq, auditListFields, "audit_id asc")
+	return a, p, err
+}
+
+func (a *Audit) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&a, a.AuditID).Error
+	})
+}
+
+func (a *Audit) GetEntries(ctx context.Context) ([]AuditEntry, error) {
+	var ae []AuditEntry
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("audit_id = ?", a.AuditID).Find(&ae).Error
+	})
+	return ae, err
+}
+
+func (a *Audit) GetScans(ctx context.Context) ([]AuditScan, error) {
+	var as []AuditScan
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("audit_id = ?", a.AuditID).Order("scanned asc").Find(&as).Error
+	})
+	return as, err
+}
+
+func (a *Audit) GetCorrections(ctx context.Context) ([]AuditCorrection, error) {
+	var ac []AuditCorrection
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("audit_id = ?", a.AuditID).Find(&ac).Error
+	})
+	return ac, err
+}
+
+// Delete drops an audit that is still open together with its snapshot and scans.
+func (a *Audit) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.First(&a, a.AuditID)
+		if err.Error != nil {
+			return err.Error
+		}
+		if a.Status != AuditStatusOpen {
+			return conflictError("Only open audits can be deleted")
+		}
+		err = d.Where("audit_id = ?", a.AuditID).Delete(AuditEntry{})
+		if err.Error != nil {
+			return err.Error
+		}
+		err = d.Where("audit_id = ?", a.AuditID).Delete(AuditScan{})
+		if err.Error != nil {
+			return err.Error
+		}
+		return d.Delete(&a).Error
+	})
+}
+
+func (a *Audit) Scan(ctx context.Context, code, boxCode int) (AuditScan, error) {
+	as := AuditScan{AuditID: a.AuditID, Code: code, BoxCode: boxCode, Scanned: time.Now()}
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.First(&a, a.AuditID)
+		if err.Error != nil {
+			return err.Error
+		}
+		if a.Status != AuditStatusOpen {
+			return conflictError("Audit is not open anymore")
+		}
+		return d.Create(&as).Error
+	})
+	return as, err
+}
+
+// Close ends the scanning phase and returns the result of the audit.
+func (a *Audit) Close(ctx context.Context) (AuditResult, error) {
+	var ar AuditResult
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.First(&a, a.AuditID)
+		if err.Error != nil {
+			return err.Error
+		}
+		if a.Status != AuditStatusOpen {
+			return conflictError("Audit is not open anymore")
+		}
+		a.Status = AuditStatusClosed
+		a.Closed = time.Now()
+		err = d.Model(&a).Updates(map[string]interface{}{"status": a.Status, "closed": a.Closed})
+		if err.Error != nil {
+			return err.Error
+		}
+		var err2 error
+		ar, err2 = a.getResult(d)
+		return err2
+	})
+	return ar, err
+}
+
+// GetResult compares the snapshot with the scans. It lists found, missing and unexpected
+// boxes and items and suggests corrections to bring the database in line with the scans.
+func (a *Audit) GetResult(ctx context.Context) (AuditResult, error) {
+	var ar AuditResult
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		ar, err = a.getResult(d)
+		return err
+	})
+	return ar, err
+}
+
+func (a *Audit) getResult(d *gorm.DB) (AuditResult, error) {
+	var ar AuditResult
+	err := d.First(&a, a.AuditID).Error
+	if err != nil {
+		return ar, err
+	}
+	ar.AuditID = a.AuditID
+	ar.Status = a.Status
+	var ee []AuditEntry
+	err = d.Where("audit_id = ?", a.AuditID).Find(&ee).Error
+	if err != nil {
+		return ar, err
+	}
+	var ss []AuditScan
+	err = d.Where("audit_id = ?", a.AuditID).Order("scanned asc").Find(&ss).Error
+	if err != nil {
+		return ar, err
+	}
+	boxes := make(map[int]Box)
+	boxtoCode := func(code int) (Box, error) {
+		if b, ok := boxes[code]; ok {
+			return b, nil
+		}
+		var b Box
+		err := d.Where("code = ?", code).Find(&b)
+		if err.Error != nil && !err.RecordNotFound() {
+			return b, err.Error
+		}
+		boxes[code] = b
+		return b, nil
+	}
+	scanned := make(map[int]AuditScan)
+	for _, s := range ss {
+		scanned[s.Code] = s
+	}
+	expected := make(map[int]bool)
+	for _, e := range ee {
+		expected[e.Code] = true
+		s, found := scanned[e.Code]
+		if e.ItemID == 0 {
+			var b Box
+			err := d.Unscoped().First(&b, e.BoxID).Error
+			if err != nil {
+				return ar, err
+			}
+			if b.DeletedAt != nil {
+				ar.TrashedBoxes = append(ar.TrashedBoxes, b)
+				continue
+			}
+			if found {
+				ar.FoundBoxes = append(ar.FoundBoxes, b)
+			} else {
+				ar.MissingBoxes = append(ar.MissingBoxes, b)
+			}
+			continue
+		}
+		var i Item
+		err := d.Unscoped().First(&i, e.ItemID).Error
+		if err != nil {
+			return ar, err
+		}
+		if i.DeletedAt != nil {
+			ar.TrashedItems = append(ar.TrashedItems, i)
+			continue
+		}
+		if !found {
+			ar.MissingItems = append(ar.MissingItems, i)
+			if !i.Retired() {
+				ar.Corrections = append(ar.Corrections, AuditCorrection{AuditID: a.AuditID, Type: AuditCorrectionLostItem, ItemID: i.ItemID})
+			}
+			continue
+		}
+		ai := AuditItem{Item: i, ExpectedBoxID: e.BoxID, ScannedBoxID: e.BoxID}
+		if s.BoxCode != 0 {
+			b, err := boxtoCode(s.BoxCode)
+			if err != nil {
+				return ar, err
+			}
+			ai.ScannedBoxID = b.BoxID
+		}
+		ar.FoundItems = append(ar.FoundItems, ai)
+		if ai.ScannedBoxID != 0 && ai.ScannedBoxID != i.BoxID && !i.Retired() {
+			ar.Corrections = append(ar.Corrections, AuditCorrection{AuditID: a.AuditID, Type: AuditCorrectionMoveItem, ItemID: i.ItemID, ToBoxID: ai.ScannedBoxID})
+		}
+	}
+	for _, s := range ss {
+		if expected[s.Code] {
+			continue
+		}
+		expected[s.Code] = true
+		b, err := boxtoCode(s.Code)
+		if err != nil {
+			return ar, err
+		}
+		if b.BoxID != 0 {
+			ar.UnexpectedBoxes = append(ar.UnexpectedBoxes, b)
+			if b.StoreID != a.StoreID {
+				ar.Corrections = append(ar.Corrections, AuditCorrection{AuditID: a.AuditID, Type: AuditCorrectionMoveBox, BoxID: b.BoxID})
+			}
+			continue
+		}
+		var i Item
+		err2 := d.Where("code = ?", s.Code).Find(&i)
+		if err2.Error != nil && !err2.RecordNotFound() {
+			return ar, err2.Error
+		}
+		if i.ItemID == 0 {
+			ar.UnknownCodes = append(ar.UnknownCodes, s.Code)
+			continue
+		}
+		ai := AuditItem{Item: i, ExpectedBoxID: i.BoxID}
+		if s.BoxCode != 0 {
+			sb, err := boxtoCode(s.BoxCode)
+			if err != nil {
+				return ar, err
+			}
+			ai.ScannedBoxID = sb.BoxID
+		}
+		ar.UnexpectedItems = append(ar.UnexpectedItems, ai)
+		if ai.ScannedBoxID != 0 && ai.ScannedBoxID != i.BoxID && !i.Retired() {
+			ar.Corrections = append(ar.Corrections, AuditCorrection{AuditID: a.AuditID, Type: AuditCorrectionMoveItem, ItemID: i.ItemID, ToBoxID: ai.ScannedBoxID})
+		}
+	}
+	if a.Status == AuditStatusApplied {
+		ar.Corrections = nil
+		err = d.Where("audit_id = ?", a.AuditID).Find(&ar.Corrections).Error
+	}
+	return ar, err
+}
+
+type auditCorrectionKey struct {
+	Type    AuditCorrectionType
+	BoxID   int
+	ItemID  int
+	ToBoxID int
+}
+
+// Apply books the corrections of a closed audit in one transaction. Only corrections the audit
+// result suggests can be applied, without corrections all suggested corrections are applied.
+func (a *Audit) Apply(ctx context.Context, cc []AuditCorrection) ([]AuditCorrection, error) {
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		ar, err := a.getResult(d)
+		if err != nil {
+			return err
+		}
+		if a.Status != AuditStatusClosed {
+			return conflictError("Only closed audits can be applied")
+		}
+		if len(cc) == 0 {
+			cc = ar.Corrections
+		}
+		suggested := make(map[auditCorrectionKey]bool)
+		for _, c := range ar.Corrections {
+			suggested[auditCorrectionKey{c.Type, c.BoxID, c.ItemID, c.ToBoxID}] = true
+		}
+		for _, c := range cc {
+			if !suggested[auditCorrectionKey{c.Type, c.BoxID, c.ItemID, c.ToBoxID}] {
+				return constraintError("Correction of item " + strconv.Itoa(c.ItemID) + " and box " + strconv.Itoa(c.BoxID) + " is not suggested by the audit")
+			}
+		}
+		for i := range cc {
+			c := &cc[i]
+			c.AuditCorrectionID = 0
+			c.AuditID = a.AuditID
+			switch c.Type {
+			case AuditCorrectionMoveItem:
+				err = checkItemInTransit(d, Item{ItemID: c.ItemID})
+				if err != nil {
+					return err
+				}
+				err = checkBoxInTransit(d, c.ToBoxID)
+				if err != nil {
+					return err
+				}
+				res := d.Model(&Item{}).Where("item_id = ? and retirement = ?", c.ItemID, RetirementNone).Updates(map[string]interface{}{"box_id": c.ToBoxID, "version": gorm.Expr("version + 1")})
+				err = res.Error
+				if err == nil && res.RowsAffected == 0 {
+					err = conflictError("Item " + strconv.Itoa(c.ItemID) + " is not in the active inventory")
+				}
+			case AuditCorrectionLostItem:
+				r := ItemRetirement{Retirement: RetirementLost, RetiredReason: "Missing in audit " + strconv.Itoa(a.AuditID)}
+				err = retireItem(d, c.ItemID, r)
+			case AuditCorrectionMoveBox:
+				err = checkBoxInTransit(d, c.BoxID)
+				if err != nil {
+					return err
+				}
+				err = d.Model(&Box{}).Where("box_id = ?", c.BoxID).Updates(map[string]interface{}{"store_id": a.StoreID, "location_id": 0, "version": gorm.Expr("version + 1")}).Error
+			default:
+				return constraintError("Audit correction type out of bound")
+			}
+			if err != nil {
+				return err
+			}
+			err = d.Create(c).Error
+			if err != nil {
+				return err
+			}
+		}
+		a.Status = AuditStatusApplied
+		return d.Model(&a).Update("status", a.Status).Error
+	})
+	return cc, err
+}
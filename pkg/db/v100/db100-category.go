@@ -0,0 +1,202 @@
+package db100
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Category groups equipment into a tree. Top level categories have ParentID 0.
+type Category struct {
+	CategoryID int    `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	ParentID   int    `gorm:"not null;default:0"`
+	Name       string `gorm:"not null"`
+	Versioned
+}
+
+// CategoryNode is a category with its subcategories. The counts include all subcategories.
+type CategoryNode struct {
+	Category       Category
+	EquipmentCount int
+	ItemCount      int
+	Children       []CategoryNode
+}
+
+func (c *Category) checkParent(d *gorm.DB) error {
+	id := c.ParentID
+	for id != 0 {
+		if id == c.CategoryID {
+			return constraintError("Category can not be its own parent")
+		}
+		var p Category
+		err := d.First(&p, id).Error
+		if err != nil {
+			return lookupError("Error getting parent Category:", err)
+		}
+		id = p.ParentID
+	}
+	return nil
+}
+
+func (c *Category) Insert(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := c.checkParent(d)
+		if err != nil {
+			return err
+		}
+		return d.Create(&c).Error
+	})
+}
+
+func getCategories(d *gorm.DB) ([]Category, error) {
+	var c []Category
+	err := d.Order("name asc").Find(&c)
+	return c, err.Error
+}
+
+var categoryListFields = listFields{
+	"category_id": {"category_id", fieldInt},
+	"parent_id":   {"parent_id", fieldInt},
+	"name":        {"name", fieldString},
+}
+
+func GetCategoriesPage(ctx context.Context, lq ListQuery) ([]Category, ListPage, error) {
+	var c []Category
+	p, err := getPage(ctx, db.Model(&Category{}), &c, lq, categoryListFields, "name asc, category_id asc")
+	return c, p, err
+}
+
+func (c *Category) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&c, c.CategoryID).Error
+	})
+}
+
+func (c *Category) Update(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := c.checkParent(d)
+		if err != nil {
+			return err
+		}
+		return d.Save(&c).Error
+	})
+}
+
+// Delete removes an empty category. Categories with subcategories or equipment can not be deleted.
+func (c *Category) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		var count int
+		err := d.Model(&Category{}).Where("parent_id = ?", c.CategoryID).Count(&count)
+		if err.Error != nil {
+			return err.Error
+		}
+		if count > 0 {
+			return conflictError("Category still has subcategories")
+		}
+		err = d.Model(&Equipment{}).Where("category_id = ?", c.CategoryID).Count(&count)
+		if err.Error != nil {
+			return err.Error
+		}
+		if count > 0 {
+			return conflictError("Category still has equipment")
+		}
+		return d.Delete(&c).Error
+	})
+}
+
+// GetSubtreeIDs returns the id of the category and of all its subcategories.
+func (c *Category) GetSubtreeIDs(ctx context.Context) ([]int, error) {
+	var ids []int
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		ids, err = c.getSubtreeIDs(d)
+		return err
+	})
+	return ids, err
+}
+
+func (c *Category) getSubtreeIDs(d *gorm.DB) ([]int, error) {
+	cc, err := getCategories(d)
+	if err != nil {
+		return nil, err
+	}
+	children := make(map[int][]int)
+	for _, ca := range cc {
+		children[ca.ParentID] = append(children[ca.ParentID], ca.CategoryID)
+	}
+	ids := []int{c.CategoryID}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids, nil
+}
+
+// GetCategoryEquipment returns the equipment of the category and all its subcategories.
+func (c *Category) GetCategoryEquipment(ctx context.Context) ([]Equipment, error) {
+	var e []Equipment
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		ids, err := c.getSubtreeIDs(d)
+		if err != nil {
+			return err
+		}
+		return d.Where("category_id in (?)", ids).Find(&e).Error
+	})
+	return e, err
+}
+
+type equipmentItemCount struct {
+	EquipmentID int
+	Count       int
+}
+
+// GetCategoryTree returns all categories as a tree with aggregated equipment and item counts.
+func GetCategoryTree(ctx context.Context) ([]CategoryNode, error) {
+	var cc []Category
+	var ee []Equipment
+	var eic []equipmentItemCount
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		cc, err = getCategories(d)
+		if err != nil {
+			return err
+		}
+		err = d.Find(&ee).Error
+		if err != nil {
+			return err
+		}
+		return d.Table("items").Select("equipment_id, count(*) as count").Where("retirement = ? and deleted_at is null", RetirementNone).Group("equipment_id").Scan(&eic).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	itemcount := make(map[int]int)
+	for _, c := range eic {
+		itemcount[c.EquipmentID] = c.Count
+	}
+	parent := make(map[int]int)
+	for _, c := range cc {
+		parent[c.CategoryID] = c.ParentID
+	}
+	equipmentcount := make(map[int]int)
+	itemsum := make(map[int]int)
+	for _, e := range ee {
+		for id := e.CategoryID; id != 0; id = parent[id] {
+			equipmentcount[id]++
+			itemsum[id] += itemcount[e.EquipmentID]
+		}
+	}
+	var build func(pid int) []CategoryNode
+	build = func(pid int) []CategoryNode {
+		var res []CategoryNode
+		for _, c := range cc {
+			if c.ParentID != pid {
+				continue
+			}
+			n := CategoryNode{Category: c, EquipmentCount: equipmentcount[c.CategoryID], ItemCount: itemsum[c.CategoryID]}
+			n.Children = build(c.CategoryID)
+			res = append(res, n)
+		}
+		return res
+	}
+	return build(0), nil
+}
@@ -0,0 +1,327 @@
+package db100
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const procurementWishlistName = "Procurement"
+
+// Stock is the quantity of a consumable either in a box (StoreID = 0) or loose in a store (BoxID = 0).
+type Stock struct {
+	StockID     int `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	EquipmentID int `gorm:"not null"`
+	BoxID       int `gorm:"not null;default:0"`
+	StoreID     int `gorm:"not null;default:0"`
+	Quantity    int `gorm:"not null;default:0"`
+}
+
+// Consumption records consumables used up at an event. The quantity is taken from the stock
+// in BoxID or, if BoxID is 0, from the loose stock in StoreID.
+type Consumption struct {
+	ConsumptionID int `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	EquipmentID   int `gorm:"not null"`
+	BoxID         int `gorm:"not null;default:0"`
+	StoreID       int `gorm:"not null;default:0"`
+	EventID       int `gorm:"not null;default:0"`
+	PackinglistID int `gorm:"not null;default:0"`
+	Quantity      int `gorm:"not null"`
+	Comment       string
+	Recorded      time.Time
+}
+
+type LowStockEntry struct {
+	Equipment    Equipment
+	Quantity     int
+	ReorderLevel int
+	Shortfall    int
+}
+
+func checkConsumable(d *gorm.DB, id int) (Equipment, error) {
+	var e Equipment
+	err := d.First(&e, id).Error
+	if err != nil {
+		return e, err
+	}
+	if !e.Consumable {
+		return e, constraintError("Equipment " + e.Name + " is not a consumable")
+	}
+	return e, nil
+}
+
+func checkStockLocation(d *gorm.DB, boxID, storeID int) error {
+	if (boxID == 0) == (storeID == 0) {
+		return constraintError("Stock needs either a box or a store")
+	}
+	if boxID != 0 {
+		return d.First(&Box{}, boxID).Error
+	}
+	return d.First(&Store{}, storeID).Error
+}
+
+func (e *Equipment) GetStock(ctx context.Context) ([]Stock, error) {
+	var ss []Stock
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("equipment_id = ?", e.EquipmentID).Find(&ss).Error
+	})
+	return ss, err
+}
+
+func (b *Box) GetBoxStock(ctx context.Context) ([]Stock, error) {
+	var ss []Stock
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("box_id = ?", b.BoxID).Find(&ss).Error
+	})
+	return ss, err
+}
+
+// GetStoreStock returns the loose stock of the store and the stock in boxes of the store.
+func (s *Store) GetStoreStock(ctx context.Context) ([]Stock, error) {
+	var ss []Stock
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("store_id = ? or box_id in (select box_id from boxes where store_id = ?)", s.StoreID, s.StoreID).Find(&ss).Error
+	})
+	return ss, err
+}
+
+// SetStock sets the quantity of a consumable in a box or store, for example after a recount or delivery.
+func SetStock(ctx context.Context, s Stock) (Stock, error) {
+	if s.Quantity < 0 {
+		return s, constraintError("Stock quantity can not be negative")
+	}
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		_, err := checkConsumable(d, s.EquipmentID)
+		if err != nil {
+			return err
+		}
+		err = checkStockLocation(d, s.BoxID, s.StoreID)
+		if err != nil {
+			return err
+		}
+		q := s.Quantity
+		err = d.Where("equipment_id = ? and box_id = ? and store_id = ?", s.EquipmentID, s.BoxID, s.StoreID).FirstOrInit(&s).Error
+		if err != nil {
+			return err
+		}
+		s.Quantity = q
+		err = d.Save(&s).Error
+		if err != nil {
+			return err
+		}
+		return syncProcurementWishlist(d)
+	})
+	return s, err
+}
+
+// Insert books the consumption and takes the quantity from the stock.
+// A consumption against a packinglist is also booked against the event of the packinglist.
+func (c *Consumption) Insert(ctx context.Context) error {
+	if c.Quantity <= 0 {
+		return constraintError("Consumed quantity has to be positive")
+	}
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		_, err := checkConsumable(d, c.EquipmentID)
+		if err != nil {
+			return err
+		}
+		if c.PackinglistID != 0 {
+			var p Packinglist
+			err = d.First(&p, c.PackinglistID).Error
+			if err != nil {
+				return err
+			}
+			c.EventID = p.EventID
+		}
+		if c.EventID == 0 {
+			return constraintError("Consumption needs an event or packinglist")
+		}
+		err = d.First(&Event{}, c.EventID).Error
+		if err != nil {
+			return err
+		}
+		if c.BoxID != 0 {
+			c.StoreID = 0
+		}
+		c.Recorded = time.Now()
+		err = takeStock(d, c.EquipmentID, c.BoxID, c.StoreID, c.Quantity)
+		if err != nil {
+			return err
+		}
+		err = d.Create(&c).Error
+		if err != nil {
+			return err
+		}
+		return syncProcurementWishlist(d)
+	})
+}
+
+// GetConsumptions returns the consumptions of an event and/or packinglist, 0 matches all.
+func GetConsumptions(ctx context.Context, eventID, packinglistID int) ([]Consumption, error) {
+	var cc []Consumption
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		q := d.Order("recorded asc")
+		if eventID != 0 {
+			q = q.Where("event_id = ?", eventID)
+		}
+		if packinglistID != 0 {
+			q = q.Where("packinglist_id = ?", packinglistID)
+		}
+		return q.Find(&cc).Error
+	})
+	return cc, err
+}
+
+// takeStock removes the quantity from the stock at the location within the transaction. The
+// stock is decreased in the database and only if enough is left, so concurrent consumptions
+// can not take the same stock twice.
+func takeStock(tx *gorm.DB, equipmentID, boxID, storeID, quantity int) error {
+	err := tx.Model(&Stock{}).Where("equipment_id = ? and box_id = ? and store_id = ? and quantity >= ?", equipmentID, boxID, storeID, quantity).
+		Update("quantity", gorm.Expr("quantity - ?", quantity))
+	if err.Error != nil {
+		return err.Error
+	}
+	if err.RowsAffected > 0 {
+		return nil
+	}
+	var count int
+	err = tx.Model(&Stock{}).Where("equipment_id = ? and box_id = ? and store_id = ?", equipmentID, boxID, storeID).Count(&count)
+	if err.Error != nil {
+		return err.Error
+	}
+	if count == 0 {
+		return conflictError("No stock of this consumable at the given location")
+	}
+	return conflictError("Not enough stock left")
+}
+
+// returnStock puts the quantity back to the stock at the location within the transaction.
+func returnStock(tx *gorm.DB, equipmentID, boxID, storeID, quantity int) error {
+	s := Stock{EquipmentID: equipmentID, BoxID: boxID, StoreID: storeID}
+	err := tx.Where("equipment_id = ? and box_id = ? and store_id = ?", equipmentID, boxID, storeID).FirstOrInit(&s)
+	if err.Error != nil {
+		return err.Error
+	}
+	s.Quantity = s.Quantity + quantity
+	err = tx.Save(&s)
+	return err.Error
+}
+
+type stockTotal struct {
+	EquipmentID int
+	Total       int
+}
+
+// GetLowStock returns all consumables whose total stock is below their reorder level.
+func GetLowStock(ctx context.Context) ([]LowStockEntry, error) {
+	var res []LowStockEntry
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		res, err = getLowStock(d)
+		return err
+	})
+	return res, err
+}
+
+func getLowStock(d *gorm.DB) ([]LowStockEntry, error) {
+	var res []LowStockEntry
+	var ee []Equipment
+	err := d.Where("consumable = ? and reorder_level > 0", true).Order("name asc").Find(&ee)
+	if err.Error != nil {
+		return res, err.Error
+	}
+	var st []stockTotal
+	err = d.Table("stocks").Select("equipment_id, sum(quantity) as total").Group("equipment_id").Scan(&st)
+	if err.Error != nil {
+		return res, err.Error
+	}
+	total := make(map[int]int)
+	for _, s := range st {
+		total[s.EquipmentID] = s.Total
+	}
+	for _, e := range ee {
+		q := total[e.EquipmentID]
+		if q < e.ReorderLevel {
+			res = append(res, LowStockEntry{Equipment: e, Quantity: q, ReorderLevel: e.ReorderLevel, Shortfall: e.ReorderLevel - q})
+		}
+	}
+	return res, nil
+}
+
+// GetProcurementWishlist returns the procurement wishlist and creates it on first use.
+func GetProcurementWishlist(ctx context.Context) (Wishlist, error) {
+	var w Wishlist
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		w, err = getProcurementWishlist(d)
+		return err
+	})
+	return w, err
+}
+
+func getProcurementWishlist(d *gorm.DB) (Wishlist, error) {
+	var w Wishlist
+	err := d.Where("procurement = ?", true).First(&w)
+	if err.RecordNotFound() {
+		w = Wishlist{Name: procurementWishlistName, Procurement: true}
+		return w, d.Create(&w).Error
+	}
+	return w, err.Error
+}
+
+// SyncProcurementWishlist puts all low stock consumables on the procurement wishlist and
+// removes everything else, like consumables that are sufficiently stocked again or equipment
+// that is no consumable anymore.
+func SyncProcurementWishlist(ctx context.Context) error {
+	return inContext(ctx, db, syncProcurementWishlist)
+}
+
+func syncProcurementWishlist(d *gorm.DB) error {
+	ls, err := getLowStock(d)
+	if err != nil {
+		return err
+	}
+	if len(ls) == 0 {
+		// Nothing to procure, the wishlist is not created before it is needed
+		var count int
+		err2 := d.Model(&Wishlist{}).Where("procurement = ?", true).Count(&count)
+		if err2.Error != nil || count == 0 {
+			return err2.Error
+		}
+	}
+	w, err := getProcurementWishlist(d)
+	if err != nil {
+		return err
+	}
+	var ee []Equipment
+	err = d.Model(&w).Association("Items").Find(&ee).Error
+	if err != nil {
+		return err
+	}
+	listed := make(map[int]bool)
+	for _, e := range ee {
+		listed[e.EquipmentID] = true
+	}
+	low := make(map[int]bool)
+	for _, l := range ls {
+		low[l.Equipment.EquipmentID] = true
+		if !listed[l.Equipment.EquipmentID] {
+			e := l.Equipment
+			err = d.Model(&w).Association("Items").Append(&e).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range ee {
+		if !low[e.EquipmentID] {
+			e := e
+			err = d.Model(&w).Association("Items").Delete(&e).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
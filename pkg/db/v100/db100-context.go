@@ -0,0 +1,46 @@
+package db100
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Chaosvermittlung/funkloch-server/internal/global"
+	"github.com/jinzhu/gorm"
+)
+
+var queryTimeout time.Duration
+
+// SetTimeouts sets how long the queries of a call may run from the configuration.
+func SetTimeouts(t global.TimeoutConfig) {
+	queryTimeout = time.Duration(t.Query) * time.Second
+}
+
+// queryContext limits ctx to the query timeout.
+func queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, queryTimeout)
+}
+
+// inContext runs fn with the query q bound to ctx, the queries fn runs on it are cancelled when
+// ctx is done or the query timeout passed. A query inside a unit of work is already bound to the
+// context of its transaction.
+func inContext(ctx context.Context, q *gorm.DB, fn func(q *gorm.DB) error) error {
+	if _, ok := q.CommonDB().(*sql.Tx); ok {
+		return fn(q)
+	}
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	tx := q.BeginTx(ctx, nil)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	err := fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
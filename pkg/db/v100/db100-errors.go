@@ -0,0 +1,56 @@
+package db100
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+// The kinds of errors of db100. Errors that are not failures of the database itself match one
+// of them with errors.Is, so callers can tell them apart without knowing every error type.
+var (
+	// ErrNotFound is returned when a row that is looked up does not exist.
+	ErrNotFound = gorm.ErrRecordNotFound
+	// ErrConflict is returned when a change conflicts with the current state of the rows, like
+	// deleting a box that still contains items or shipping a transfer twice.
+	ErrConflict = errors.New("conflict")
+	// ErrConstraint is returned when an entity breaks a rule whatever the state of the rows is,
+	// like a negative quantity or a type out of bound.
+	ErrConstraint = errors.New("constraint violated")
+)
+
+// kindError is an error of one of the kinds with its own message.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+func notFoundError(msg string) error {
+	return &kindError{ErrNotFound, msg}
+}
+
+func conflictError(msg string) error {
+	return &kindError{ErrConflict, msg}
+}
+
+func constraintError(msg string) error {
+	return &kindError{ErrConstraint, msg}
+}
+
+// lookupError describes the failed lookup of a row the entity references. A missing row breaks
+// the rules of the entity, other errors are wrapped.
+func lookupError(msg string, err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return constraintError(msg + err.Error())
+	}
+	return fmt.Errorf("%s%w", msg, err)
+}
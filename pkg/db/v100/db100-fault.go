@@ -0,0 +1,191 @@
+package db100
+
+import (
+	"context"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// faultTransitions lists the allowed status changes. Unfixable is final,
+// fixed faults can be reopened if the problem comes back.
+var faultTransitions = map[FaultStatus][]FaultStatus{
+	FaultStatusNew:       {FaultStatusInRepair, FaultStatusFixed, FaultStatusUnfixable},
+	FaultStatusInRepair:  {FaultStatusNew, FaultStatusFixed, FaultStatusUnfixable},
+	FaultStatusFixed:     {FaultStatusNew},
+	FaultStatusUnfixable: {},
+}
+
+// FaultComment is an entry of the comment thread of a fault. Every status or assignee change
+// adds an entry, FromStatus and ToStatus are equal for plain comments.
+type FaultComment struct {
+	FaultCommentID int         `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	FaultID        int         `gorm:"not null"`
+	UserID         int         `gorm:"not null;default:0"`
+	Comment        string      `gorm:"not null"`
+	FromStatus     FaultStatus `gorm:"not null"`
+	ToStatus       FaultStatus `gorm:"not null"`
+	AssigneeID     int         `gorm:"not null;default:0"`
+	Created        time.Time   `gorm:"not null"`
+}
+
+func (s FaultStatus) String() string {
+	switch s {
+	case FaultStatusNew:
+		return "New"
+	case FaultStatusInRepair:
+		return "InRepair"
+	case FaultStatusFixed:
+		return "Fixed"
+	case FaultStatusUnfixable:
+		return "Unfixable"
+	}
+	return "Unknown"
+}
+
+func (s FaultStatus) CanTransition(to FaultStatus) bool {
+	if s == to {
+		return true
+	}
+	for _, t := range faultTransitions[s] {
+		if t == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Open reports whether the fault still needs work.
+func (s FaultStatus) Open() bool {
+	return s == FaultStatusNew || s == FaultStatusInRepair
+}
+
+func checkAssignee(d *gorm.DB, id int) error {
+	if id == 0 {
+		return nil
+	}
+	err := d.First(&User{}, id).Error
+	if err != nil {
+		return lookupError("Error getting assignee: ", err)
+	}
+	return nil
+}
+
+// InsertBy reports a new fault. The description starts the comment thread.
+func (f *Fault) InsertBy(ctx context.Context, userID int) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return f.insertBy(d, userID)
+	})
+}
+
+func (f *Fault) insertBy(d *gorm.DB, userID int) error {
+	if f.Status < FaultStatusNew || f.Status > FaultStatusUnfixable {
+		return constraintError("FaultStatus out of bound")
+	}
+	err := checkAssignee(d, f.AssigneeID)
+	if err != nil {
+		return err
+	}
+	err = f.checkRepair()
+	if err != nil {
+		return err
+	}
+	f.Created = time.Now()
+	f.Updated = f.Created
+	err2 := d.Create(&f)
+	if err2.Error == nil {
+		fc := FaultComment{FaultID: f.FaultID, UserID: userID, Comment: f.Comment, FromStatus: f.Status, ToStatus: f.Status, AssigneeID: f.AssigneeID, Created: f.Created}
+		err2 = d.Create(&fc)
+	}
+	return err2.Error
+}
+
+// UpdateBy changes status, assignee and description of the fault. Status changes have to follow
+// the allowed transitions and status or assignee changes are recorded in the comment thread.
+func (f *Fault) UpdateBy(ctx context.Context, userID int, comment string) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		var of Fault
+		err := d.First(&of, f.FaultID).Error
+		if err != nil {
+			return err
+		}
+		if f.Status < FaultStatusNew || f.Status > FaultStatusUnfixable {
+			return constraintError("FaultStatus out of bound")
+		}
+		if !of.Status.CanTransition(f.Status) {
+			return conflictError("Fault can not change from " + of.Status.String() + " to " + f.Status.String())
+		}
+		err = checkAssignee(d, f.AssigneeID)
+		if err != nil {
+			return err
+		}
+		err = f.checkRepair()
+		if err != nil {
+			return err
+		}
+		f.ItemID = of.ItemID
+		f.Created = of.Created
+		f.Updated = time.Now()
+		err2 := d.Save(&f)
+		if err2.Error == nil && (of.Status != f.Status || of.AssigneeID != f.AssigneeID || comment != "") {
+			fc := FaultComment{FaultID: f.FaultID, UserID: userID, Comment: comment, FromStatus: of.Status, ToStatus: f.Status, AssigneeID: f.AssigneeID, Created: f.Updated}
+			err2 = d.Create(&fc)
+		}
+		return err2.Error
+	})
+}
+
+// AddComment adds a plain comment to the thread of the fault.
+func (f *Fault) AddComment(ctx context.Context, userID int, comment string) (FaultComment, error) {
+	fc := FaultComment{FaultID: f.FaultID, UserID: userID, Comment: comment, Created: time.Now()}
+	if comment == "" {
+		return fc, constraintError("Comment is empty")
+	}
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.First(&f, f.FaultID)
+		if err.Error != nil {
+			return err.Error
+		}
+		fc.FromStatus = f.Status
+		fc.ToStatus = f.Status
+		fc.AssigneeID = f.AssigneeID
+		err = d.Create(&fc)
+		if err.Error != nil {
+			return err.Error
+		}
+		return d.Model(&f).Update("updated", fc.Created).Error
+	})
+	return fc, err
+}
+
+func (f *Fault) GetComments(ctx context.Context) ([]FaultComment, error) {
+	var fc []FaultComment
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("fault_id = ?", f.FaultID).Order("created asc, fault_comment_id asc").Find(&fc).Error
+	})
+	return fc, err
+}
+
+// faultListFields keeps assignee, equipment and store as the names of the filters from before paging.
+var faultListFields = listFields{
+	"fault_id":     {"faults.fault_id", fieldInt},
+	"item_id":      {"faults.item_id", fieldInt},
+	"status":       {"faults.status", fieldInt},
+	"assignee_id":  {"faults.assignee_id", fieldInt},
+	"assignee":     {"faults.assignee_id", fieldInt},
+	"equipment_id": {"items.equipment_id", fieldInt},
+	"equipment":    {"items.equipment_id", fieldInt},
+	"store_id":     {"boxes.store_id", fieldInt},
+	"store":        {"boxes.store_id", fieldInt},
+	"created":      {"faults.created", fieldDate},
+	"updated":      {"faults.updated", fieldDate},
+}
+
+func GetFaultsPage(ctx context.Context, lq ListQuery) ([]Fault, ListPage, error) {
+	var f []Fault
+	q := db.Table("faults").Select("faults.*").
+		Joins("left join items on faults.item_id = items.item_id").
+		Joins("left join boxes on items.box_id = boxes.box_id")
+	p, err := getPage(ctx, q, &f, lq, faultListFields, "faults.fault_id asc")
+	return f, p, err
+}
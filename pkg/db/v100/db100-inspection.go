@@ -0,0 +1,289 @@
+package db100
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// InspectionType is a recurring inspection of an equipment, e.g. the electrical safety test.
+// Every item of the equipment has to pass it once per interval.
+type InspectionType struct {
+	InspectionTypeID int    `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	EquipmentID      int    `gorm:"not null"`
+	Name             string `gorm:"not null"`
+	IntervalDays     int    `gorm:"not null"`
+	Versioned
+}
+
+// Inspection records an inspection of an item. Tester is the person who did the test, which
+// may be an external electrician, UserID the user who recorded it. A failed inspection opens
+// the fault FaultID.
+type Inspection struct {
+	InspectionID     int               `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	ItemID           int               `gorm:"not null"`
+	InspectionTypeID int               `gorm:"not null"`
+	UserID           int               `gorm:"not null;default:0"`
+	Tester           string            `gorm:"not null"`
+	Passed           bool              `gorm:"not null"`
+	Comment          string            `gorm:"not null;default:''"`
+	Date             time.Time         `gorm:"not null"`
+	FaultID          int               `gorm:"not null;default:0"`
+	Values           []InspectionValue `gorm:"foreignkey:InspectionID;association_foreignkey:InspectionID"`
+}
+
+// InspectionValue is a value measured during an inspection, e.g. the insulation resistance.
+type InspectionValue struct {
+	InspectionValueID int    `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	InspectionID      int    `gorm:"not null"`
+	Name              string `gorm:"not null"`
+	Value             string `gorm:"not null"`
+	Unit              string
+}
+
+// DueInspection is an inspection of an item that is due. Last is the last passed inspection,
+// nil if the item never passed one.
+type DueInspection struct {
+	Item           Item
+	InspectionType InspectionType
+	Last           *time.Time
+	Due            time.Time
+	Overdue        bool
+}
+
+func (t *InspectionType) validate(d *gorm.DB) error {
+	if t.Name == "" {
+		return constraintError("Inspection type name is empty")
+	}
+	if t.IntervalDays <= 0 {
+		return constraintError("Inspection interval has to be positive")
+	}
+	return d.First(&Equipment{}, t.EquipmentID).Error
+}
+
+func (t *InspectionType) Insert(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := t.validate(d)
+		if err != nil {
+			return err
+		}
+		return d.Create(&t).Error
+	})
+}
+
+func (t *InspectionType) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&t, t.InspectionTypeID).Error
+	})
+}
+
+func (t *InspectionType) Update(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		var ot InspectionType
+		err := d.First(&ot, t.InspectionTypeID).Error
+		if err != nil {
+			return err
+		}
+		t.EquipmentID = ot.EquipmentID
+		err = t.validate(d)
+		if err != nil {
+			return err
+		}
+		return d.Save(&t).Error
+	})
+}
+
+// Delete removes the inspection type. Types with recorded inspections are kept as proof of testing.
+func (t *InspectionType) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		var count int
+		err := d.Model(&Inspection{}).Where("inspection_type_id = ?", t.InspectionTypeID).Count(&count)
+		if err.Error != nil {
+			return err.Error
+		}
+		if count > 0 {
+			return conflictError("Inspection type has " + strconv.Itoa(count) + " recorded inspections")
+		}
+		return d.Delete(&t).Error
+	})
+}
+
+// inspectionTypeListFields keeps equipment as the name of the equipment filter from before paging.
+var inspectionTypeListFields = listFields{
+	"inspection_type_id": {"inspection_type_id", fieldInt},
+	"equipment_id":       {"equipment_id", fieldInt},
+	"equipment":          {"equipment_id", fieldInt},
+	"name":               {"name", fieldString},
+	"interval_days":      {"interval_days", fieldInt},
+}
+
+func GetInspectionTypesPage(ctx context.Context, lq ListQuery) ([]InspectionType, ListPage, error) {
+	var tt []InspectionType
+	p, err := getPage(ctx, db.Model(&InspectionType{}), &tt, lq, inspectionTypeListFields, "equipment_id asc, name asc, inspection_type_id asc")
+	return tt, p, err
+}
+
+// Insert records the inspection. A failed inspection opens a new fault for the item.
+func (in *Inspection) Insert(ctx context.Context) error {
+	if in.Tester == "" {
+		return constraintError("Inspection needs a tester")
+	}
+	for _, v := range in.Values {
+		if v.Name == "" {
+			return constraintError("Measured value without name")
+		}
+	}
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		var i Item
+		err := d.First(&i, in.ItemID).Error
+		if err != nil {
+			return err
+		}
+		var t InspectionType
+		err = d.First(&t, in.InspectionTypeID).Error
+		if err != nil {
+			return err
+		}
+		if t.EquipmentID != i.EquipmentID {
+			return constraintError("Inspection type " + t.Name + " does not apply to this item")
+		}
+		if in.Date.IsZero() {
+			in.Date = time.Now()
+		}
+		in.FaultID = 0
+		if !in.Passed {
+			c := "Inspection " + t.Name + " failed"
+			if in.Comment != "" {
+				c = c + ": " + in.Comment
+			}
+			f := Fault{ItemID: in.ItemID, Status: FaultStatusNew, Comment: c}
+			err = f.insertBy(d, in.UserID)
+			if err != nil {
+				return err
+			}
+			in.FaultID = f.FaultID
+		}
+		return d.Create(&in).Error
+	})
+}
+
+func (in *Inspection) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Preload("Values").First(&in, in.InspectionID).Error
+	})
+}
+
+func (i *Item) GetInspections(ctx context.Context) ([]Inspection, error) {
+	var ii []Inspection
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Preload("Values").Where("item_id = ?", i.ItemID).Order("date desc").Find(&ii).Error
+	})
+	return ii, err
+}
+
+func deleteItemInspections(d *gorm.DB, itemID int) error {
+	err := d.Where("inspection_id in (select inspection_id from inspections where item_id = ?)", itemID).Delete(InspectionValue{})
+	if err.Error != nil {
+		return err.Error
+	}
+	err = d.Where("item_id = ?", itemID).Delete(Inspection{})
+	return err.Error
+}
+
+// getDueInspections returns the inspections of the items that are due until the given time.
+// Only passed inspections count, items that failed stay due until they pass a retest.
+func getDueInspections(d *gorm.DB, ii []Item, until time.Time) ([]DueInspection, error) {
+	var res []DueInspection
+	if len(ii) == 0 {
+		return res, nil
+	}
+	var tt []InspectionType
+	err := d.Order("name asc").Find(&tt)
+	if err.Error != nil {
+		return res, err.Error
+	}
+	types := make(map[int][]InspectionType)
+	for _, t := range tt {
+		types[t.EquipmentID] = append(types[t.EquipmentID], t)
+	}
+	var ids []int
+	for _, i := range ii {
+		ids = append(ids, i.ItemID)
+	}
+	var done []Inspection
+	err = d.Where("item_id in (?) and passed = ?", ids, true).Find(&done)
+	if err.Error != nil {
+		return res, err.Error
+	}
+	type key struct{ item, inspectionType int }
+	last := make(map[key]time.Time)
+	for _, in := range done {
+		k := key{in.ItemID, in.InspectionTypeID}
+		if in.Date.After(last[k]) {
+			last[k] = in.Date
+		}
+	}
+	now := time.Now()
+	for _, i := range ii {
+		for _, t := range types[i.EquipmentID] {
+			di := DueInspection{Item: i, InspectionType: t, Due: now, Overdue: true}
+			if l, ok := last[key{i.ItemID, t.InspectionTypeID}]; ok {
+				di.Last = &l
+				di.Due = l.AddDate(0, 0, t.IntervalDays)
+				if di.Due.After(until) {
+					continue
+				}
+				di.Overdue = !di.Due.After(now)
+			}
+			res = append(res, di)
+		}
+	}
+	return res, nil
+}
+
+// GetDueInspections returns the inspections due until the given time for the items stored in
+// the store, 0 returns the due inspections of all items. Items that never passed are due now.
+func GetDueInspections(ctx context.Context, storeID int, until time.Time) ([]DueInspection, error) {
+	var res []DueInspection
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var ii []Item
+		q := d.Where("retirement = ?", RetirementNone).Order("item_id asc")
+		if storeID != 0 {
+			q = q.Where("box_id in (select box_id from boxes where store_id = ?)", storeID)
+		}
+		err := q.Find(&ii).Error
+		if err != nil {
+			return err
+		}
+		res, err = getDueInspections(d, ii, until)
+		return err
+	})
+	return res, err
+}
+
+// getOverdueItems counts the items with overdue inspections per box, reading through d.
+func getOverdueItems(d *gorm.DB, boxIDs []int) (map[int]int, error) {
+	res := make(map[int]int)
+	if len(boxIDs) == 0 {
+		return res, nil
+	}
+	var ii []Item
+	err := d.Where("box_id in (?)", boxIDs).Find(&ii)
+	if err.Error != nil {
+		return res, err.Error
+	}
+	dd, err2 := getDueInspections(d, ii, time.Now())
+	if err2 != nil {
+		return res, err2
+	}
+	counted := make(map[int]bool)
+	for _, di := range dd {
+		if di.Overdue && !counted[di.Item.ItemID] {
+			counted[di.Item.ItemID] = true
+			res[di.Item.BoxID]++
+		}
+	}
+	return res, nil
+}
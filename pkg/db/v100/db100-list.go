@@ -0,0 +1,243 @@
+package db100
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// MaxListLimit is the largest page a list returns.
+const MaxListLimit = 1000
+
+// ListQuery selects a page of a list. Without a Limit the whole list is returned.
+// Filters map field names to the values they have to match, a field matches any of its values
+// and int fields also accept comma separated values. Int and date fields can be filtered to a
+// range with the field name suffixed by _from and _to, both inclusive.
+// Sort names the fields to order by, a leading - orders descending.
+type ListQuery struct {
+	Limit   int
+	Cursor  string
+	Sort    []string
+	Filters map[string][]string
+}
+
+// ListPage describes the returned page. Total counts the rows matching the filters,
+// NextCursor selects the following page and is empty on the last page.
+type ListPage struct {
+	Total      int
+	NextCursor string
+}
+
+// ListQueryError is returned for list parameters with unknown fields or invalid values.
+type ListQueryError struct {
+	Param  string
+	Reason string
+}
+
+func (e *ListQueryError) Error() string {
+	return "Invalid list parameter " + e.Param + ": " + e.Reason
+}
+
+type fieldType int
+
+const (
+	fieldInt fieldType = iota
+	fieldString
+	fieldDate
+	fieldBool
+)
+
+type listField struct {
+	column string
+	kind   fieldType
+}
+
+// listFields maps the field names of a list to their columns.
+type listFields map[string]listField
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(c string) (int, error) {
+	if c == "" {
+		return 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return 0, &ListQueryError{"cursor", "malformed cursor"}
+	}
+	offset, err := strconv.Atoi(string(b))
+	if err != nil || offset < 0 {
+		return 0, &ListQueryError{"cursor", "malformed cursor"}
+	}
+	return offset, nil
+}
+
+// window returns the bounds of the page within a list of total rows.
+func (lq ListQuery) window(total int) (int, int, ListPage, error) {
+	page := ListPage{Total: total}
+	if lq.Limit < 0 {
+		return 0, 0, page, &ListQueryError{"limit", "limit can not be negative"}
+	}
+	offset, err := decodeCursor(lq.Cursor)
+	if err != nil {
+		return 0, 0, page, err
+	}
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if lq.Limit > 0 {
+		limit := lq.Limit
+		if limit > MaxListLimit {
+			limit = MaxListLimit
+		}
+		if offset+limit < total {
+			end = offset + limit
+			page.NextCursor = encodeCursor(end)
+		}
+	}
+	return offset, end, page, nil
+}
+
+func parseFieldValue(param string, kind fieldType, v string) (interface{}, error) {
+	switch kind {
+	case fieldInt:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, &ListQueryError{param, "expected a number"}
+		}
+		return n, nil
+	case fieldDate:
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return nil, &ListQueryError{param, "expected a date like 2006-01-02"}
+		}
+		return t, nil
+	case fieldBool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, &ListQueryError{param, "expected true or false"}
+		}
+		return b, nil
+	}
+	return v, nil
+}
+
+// filter adds the conditions of one filter parameter to the query.
+func (fields listFields) filter(q *gorm.DB, param string, vv []string) (*gorm.DB, error) {
+	name, bound := param, ""
+	f, ok := fields[name]
+	if !ok {
+		for _, s := range []string{"_from", "_to"} {
+			if strings.HasSuffix(param, s) {
+				name, bound = strings.TrimSuffix(param, s), s
+				f, ok = fields[name]
+			}
+		}
+	}
+	if !ok {
+		return q, &ListQueryError{param, "unknown field"}
+	}
+	if bound != "" {
+		if f.kind != fieldInt && f.kind != fieldDate {
+			return q, &ListQueryError{param, "field " + name + " has no range"}
+		}
+		for _, v := range vv {
+			value, err := parseFieldValue(param, f.kind, v)
+			if err != nil {
+				return q, err
+			}
+			switch {
+			case bound == "_from":
+				q = q.Where(f.column+" >= ?", value)
+			case f.kind == fieldDate:
+				q = q.Where(f.column+" < ?", value.(time.Time).AddDate(0, 0, 1))
+			default:
+				q = q.Where(f.column+" <= ?", value)
+			}
+		}
+		return q, nil
+	}
+	var values []interface{}
+	for _, v := range vv {
+		parts := []string{v}
+		if f.kind == fieldInt {
+			parts = strings.Split(v, ",")
+		}
+		for _, p := range parts {
+			value, err := parseFieldValue(param, f.kind, p)
+			if err != nil {
+				return q, err
+			}
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return q, nil
+	}
+	return q.Where(f.column+" in (?)", values), nil
+}
+
+// order returns the order clause for the sort fields, falling back to the default order.
+func (fields listFields) order(sort []string, def string) (string, error) {
+	var oo []string
+	for _, s := range sort {
+		for _, name := range strings.Split(s, ",") {
+			dir := " asc"
+			if strings.HasPrefix(name, "-") {
+				name, dir = name[1:], " desc"
+			}
+			if name == "" {
+				continue
+			}
+			f, ok := fields[name]
+			if !ok {
+				return "", &ListQueryError{"sort", "unknown field " + name}
+			}
+			oo = append(oo, f.column+dir)
+		}
+	}
+	oo = append(oo, def)
+	return strings.Join(oo, ", "), nil
+}
+
+// getPage filters, counts and orders the query and reads the selected page into out.
+// The default order keeps pages stable and should end with the primary key.
+func getPage(ctx context.Context, q *gorm.DB, out interface{}, lq ListQuery, fields listFields, def string) (ListPage, error) {
+	var page ListPage
+	var err error
+	for param, vv := range lq.Filters {
+		q, err = fields.filter(q, param, vv)
+		if err != nil {
+			return page, err
+		}
+	}
+	order, err := fields.order(lq.Sort, def)
+	if err != nil {
+		return page, err
+	}
+	err = inContext(ctx, q, func(q *gorm.DB) error {
+		var total int
+		err := q.Count(&total)
+		if err.Error != nil {
+			return err.Error
+		}
+		offset, end, p, err2 := lq.window(total)
+		page = p
+		if err2 != nil {
+			return err2
+		}
+		q = q.Order(order)
+		if offset > 0 || lq.Limit > 0 {
+			q = q.Offset(offset).Limit(end - offset)
+		}
+		return q.Find(out).Error
+	})
+	return page, err
+}
@@ -0,0 +1,300 @@
+package db100
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/Chaosvermittlung/funkloch-server/internal/global"
+	"github.com/jinzhu/gorm"
+)
+
+type LocationType int
+
+const (
+	LocationTypeRoom LocationType = 1 + iota
+	LocationTypeShelf
+	LocationTypeSlot
+)
+
+// Location is a place inside a store. Rooms hang directly below the store,
+// shelves below rooms and slots below shelves.
+type Location struct {
+	LocationID int          `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	StoreID    int          `gorm:"not null"`
+	ParentID   int          `gorm:"not null;default:0"`
+	Type       LocationType `gorm:"not null"`
+	Name       string       `gorm:"not null"`
+	Code       int          `gorm:"type:integer(13)"`
+	Versioned
+}
+
+type BoxLocation struct {
+	Box   Box
+	Store Store
+	Path  []Location
+}
+
+func (l *Location) validate(d *gorm.DB) error {
+	if l.Type < LocationTypeRoom || l.Type > LocationTypeSlot {
+		return constraintError("Location type out of bound")
+	}
+	if l.Type == LocationTypeRoom {
+		if l.ParentID != 0 {
+			return constraintError("Rooms can not have a parent location")
+		}
+		return nil
+	}
+	var p Location
+	err := d.First(&p, l.ParentID).Error
+	if err != nil {
+		return lookupError("Error getting parent Location:", err)
+	}
+	if p.Type != l.Type-1 {
+		return constraintError("Parent location has the wrong type")
+	}
+	if p.StoreID != l.StoreID {
+		return constraintError("Parent location is in another store")
+	}
+	return nil
+}
+
+func (l *Location) Insert(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := l.validate(d)
+		if err != nil {
+			return err
+		}
+		err = d.Create(&l).Error
+		if err != nil {
+			return err
+		}
+		tmp, err := strconv.Atoi(global.CreateLocationCode(l.LocationID))
+		if err != nil {
+			return err
+		}
+		l.Code = tmp
+		return d.Save(&l).Error
+	})
+}
+
+// locationListFields keeps store as the name of the store filter from before paging.
+var locationListFields = listFields{
+	"location_id": {"location_id", fieldInt},
+	"store_id":    {"store_id", fieldInt},
+	"store":       {"store_id", fieldInt},
+	"parent_id":   {"parent_id", fieldInt},
+	"type":        {"type", fieldInt},
+	"name":        {"name", fieldString},
+	"code":        {"code", fieldInt},
+}
+
+func GetLocationsPage(ctx context.Context, lq ListQuery) ([]Location, ListPage, error) {
+	var l []Location
+	p, err := getPage(ctx, db.Model(&Location{}), &l, lq, locationListFields, "location_id asc")
+	return l, p, err
+}
+
+func (l *Location) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&l, l.LocationID).Error
+	})
+}
+
+func (l *Location) GetDetailstoCode(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("code = ?", l.Code).First(&l).Error
+	})
+}
+
+// Update saves the location. Locations that still hold other locations or boxes can not change
+// their store or type.
+func (l *Location) Update(ctx context.Context) error {
+	tmp, err := strconv.Atoi(global.CreateLocationCode(l.LocationID))
+	if err != nil {
+		return err
+	}
+	l.Code = tmp
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		var ol Location
+		err := d.First(&ol, l.LocationID).Error
+		if err != nil {
+			return err
+		}
+		if ol.StoreID != l.StoreID || ol.Type != l.Type {
+			err = l.checkEmpty(d)
+			if err != nil {
+				return err
+			}
+		}
+		err = l.validate(d)
+		if err != nil {
+			return err
+		}
+		return d.Save(&l).Error
+	})
+}
+
+// checkEmpty returns a conflict if the location still holds other locations or boxes.
+func (l *Location) checkEmpty(d *gorm.DB) error {
+	var count int
+	err := d.Model(&Location{}).Where("parent_id = ?", l.LocationID).Count(&count)
+	if err.Error != nil {
+		return err.Error
+	}
+	if count > 0 {
+		return conflictError("Location still contains other locations")
+	}
+	err = d.Model(&Box{}).Where("location_id = ?", l.LocationID).Count(&count)
+	if err.Error != nil {
+		return err.Error
+	}
+	if count > 0 {
+		return conflictError("Location still contains boxes")
+	}
+	return nil
+}
+
+// Delete removes the location. Locations that still hold other locations or boxes can not be deleted.
+func (l *Location) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := l.checkEmpty(d)
+		if err != nil {
+			return err
+		}
+		return d.Delete(&l).Error
+	})
+}
+
+func (l *Location) GetChildren(ctx context.Context) ([]Location, error) {
+	var ll []Location
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("parent_id = ?", l.LocationID).Order("name asc").Find(&ll).Error
+	})
+	return ll, err
+}
+
+func (l *Location) GetLocationBoxes(ctx context.Context) ([]Box, error) {
+	var bb []Box
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("location_id = ?", l.LocationID).Find(&bb).Error
+	})
+	return bb, err
+}
+
+// GetPath returns the location and all its parents, starting with the room.
+func (l *Location) GetPath(ctx context.Context) ([]Location, error) {
+	var path []Location
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		path, err = l.getPath(d)
+		return err
+	})
+	return path, err
+}
+
+func (l *Location) getPath(d *gorm.DB) ([]Location, error) {
+	var path []Location
+	id := l.LocationID
+	for id != 0 && len(path) < int(LocationTypeSlot) {
+		var c Location
+		err := d.First(&c, id).Error
+		if err != nil {
+			return path, err
+		}
+		path = append([]Location{c}, path...)
+		id = c.ParentID
+	}
+	return path, nil
+}
+
+// PutAway stores the box at the given location. The location has to be in the store of the box.
+func (b *Box) PutAway(ctx context.Context, l Location) error {
+	return TransactionContext(ctx, func(u *UnitOfWork) error {
+		err := u.tx.First(b, b.BoxID).Error
+		if err != nil {
+			return err
+		}
+		err = u.tx.First(&l, l.LocationID).Error
+		if err != nil {
+			return err
+		}
+		if l.StoreID != b.StoreID {
+			return constraintError("Location is not in the store of the box")
+		}
+		b.LocationID = l.LocationID
+		return u.UpdateBox(b)
+	})
+}
+
+// GetLocation answers where a box is: its store and the path to its location inside the store.
+func (b *Box) GetLocation(ctx context.Context) (BoxLocation, error) {
+	var bl BoxLocation
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		bl, err = b.getLocation(d)
+		return err
+	})
+	return bl, err
+}
+
+func (b *Box) getLocation(d *gorm.DB) (BoxLocation, error) {
+	var bl BoxLocation
+	err := d.First(b, b.BoxID).Error
+	if err != nil {
+		return bl, err
+	}
+	bl.Box = *b
+	err = d.First(&bl.Store, b.StoreID).Error
+	if err != nil {
+		return bl, err
+	}
+	l := Location{LocationID: b.LocationID}
+	bl.Path, err = l.getPath(d)
+	return bl, err
+}
+
+func lessPath(a, b []Location) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].Name != b[i].Name {
+			return a[i].Name < b[i].Name
+		}
+	}
+	return len(a) < len(b)
+}
+
+// GetPicklist returns the boxes of the packinglist ordered by store and location,
+// so packers can walk each store once. Boxes without a location come last in their store.
+func (p *Packinglist) GetPicklist(ctx context.Context) ([]BoxLocation, error) {
+	var res []BoxLocation
+	err := p.GetDetails(ctx)
+	if err != nil {
+		return res, err
+	}
+	err = inContext(ctx, db, func(d *gorm.DB) error {
+		for _, b := range p.Boxes {
+			bl, err := b.getLocation(d)
+			if err != nil {
+				return err
+			}
+			res = append(res, bl)
+		}
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Store.Name != res[j].Store.Name {
+			return res[i].Store.Name < res[j].Store.Name
+		}
+		if res[i].Store.StoreID != res[j].Store.StoreID {
+			return res[i].Store.StoreID < res[j].Store.StoreID
+		}
+		if len(res[i].Path) == 0 || len(res[j].Path) == 0 {
+			return len(res[i].Path) > len(res[j].Path)
+		}
+		return lessPath(res[i].Path, res[j].Path)
+	})
+	return res, nil
+}
@@ -0,0 +1,481 @@
+package db100
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Chaosvermittlung/funkloch-server/internal/global"
+	"github.com/jinzhu/gorm"
+)
+
+// NewMemoryRepositories returns repositories that keep the items and boxes in memory, for tests
+// of the api handlers without a database. They know nothing about stores and equipment, so joined
+// entries only carry the box of an item. Lists can be paged but not filtered or sorted.
+func NewMemoryRepositories() Repositories {
+	m := &memoryStore{items: make(map[int]Item), boxes: make(map[int]Box)}
+	return Repositories{
+		Items: memoryItemRepository{m},
+		Boxes: memoryBoxRepository{m},
+	}
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	items    map[int]Item
+	boxes    map[int]Box
+	lastItem int
+	lastBox  int
+}
+
+func checkMemoryList(lq ListQuery) error {
+	for param := range lq.Filters {
+		return &ListQueryError{param, "unknown field"}
+	}
+	if len(lq.Sort) > 0 {
+		return &ListQueryError{"sort", "the list can not be sorted"}
+	}
+	return nil
+}
+
+// exists checks references to boxes and items, the store knows no other rows and takes
+// references to them as valid. Conditions are not checked, no rule references boxes or items with them.
+func (m *memoryStore) exists(model interface{}, id int, conds map[string]interface{}) (bool, error) {
+	var ok bool
+	switch model.(type) {
+	case *Box:
+		_, ok = m.boxes[id]
+	case *Item:
+		_, ok = m.items[id]
+	default:
+		ok = true
+	}
+	return ok, nil
+}
+
+func (m *memoryStore) insertItem(i *Item) error {
+	err := validate(i, m.exists)
+	if err != nil {
+		return err
+	}
+	err = m.checkSerial(i)
+	if err != nil {
+		return err
+	}
+	m.lastItem++
+	i.ItemID = m.lastItem
+	code, err := strconv.Atoi(global.CreateItemCode(i.ItemID))
+	if err != nil {
+		return err
+	}
+	i.Code = code
+	i.Version = 1
+	m.items[i.ItemID] = *i
+	return nil
+}
+
+func (m *memoryStore) checkSerial(i *Item) error {
+	if i.Serial == "" {
+		return nil
+	}
+	for _, oi := range m.items {
+		if oi.ItemID != i.ItemID && oi.EquipmentID == i.EquipmentID && oi.Serial == i.Serial {
+			return conflictError("Serial " + i.Serial + " already exists for this equipment")
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) updateItem(i *Item) error {
+	oi, ok := m.items[i.ItemID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if i.Version != 0 && i.Version != oi.Version {
+		return &VersionConflict{Entity: "Item", ID: i.ItemID, Version: i.Version}
+	}
+	i.ItemRetirement = oi.ItemRetirement
+	if i.Retired() && i.BoxID != 0 {
+		return conflictError("Retired items can not be put into a box")
+	}
+	err := validate(i, m.exists)
+	if err != nil {
+		return err
+	}
+	err = m.checkSerial(i)
+	if err != nil {
+		return err
+	}
+	code, err := strconv.Atoi(global.CreateItemCode(i.ItemID))
+	if err != nil {
+		return err
+	}
+	i.Code = code
+	i.Version = oi.Version + 1
+	m.items[i.ItemID] = *i
+	return nil
+}
+
+func (m *memoryStore) itemEntry(i Item) ItemslistEntry {
+	b := m.boxes[i.BoxID]
+	return ItemslistEntry{
+		ItemID:          i.ItemID,
+		ItemVersion:     i.Version,
+		ItemCode:        i.Code,
+		ItemDescription: i.Description,
+		BoxID:           b.BoxID,
+		BoxCode:         b.Code,
+		BoxDescription:  b.Description,
+		BoxWeight:       b.Weight,
+		StoreID:         b.StoreID,
+		EquipmentID:     i.EquipmentID,
+		ItemAsset:       i.ItemAsset,
+	}
+}
+
+// sortedItems returns the items matching keep ordered by id.
+func (m *memoryStore) sortedItems(keep func(i Item) bool) []ItemslistEntry {
+	var ile []ItemslistEntry
+	for _, i := range m.items {
+		if keep(i) {
+			ile = append(ile, m.itemEntry(i))
+		}
+	}
+	sort.Slice(ile, func(a, b int) bool {
+		return ile[a].ItemID < ile[b].ItemID
+	})
+	return ile
+}
+
+type memoryItemRepository struct {
+	m *memoryStore
+}
+
+func (r memoryItemRepository) Insert(ctx context.Context, i *Item) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.insertItem(i)
+}
+
+func (r memoryItemRepository) Get(ctx context.Context, id int) (Item, error) {
+	if ctx.Err() != nil {
+		return Item{}, ctx.Err()
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	i, ok := r.m.items[id]
+	if !ok {
+		return i, gorm.ErrRecordNotFound
+	}
+	return i, nil
+}
+
+func (r memoryItemRepository) GetFull(ctx context.Context, id int) (ItemslistEntry, error) {
+	i, err := r.Get(ctx, id)
+	if err != nil {
+		return ItemslistEntry{}, err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.itemEntry(i), nil
+}
+
+func (r memoryItemRepository) List(ctx context.Context, storeless bool, ff []AttributeFilter, lq ListQuery) ([]ItemslistEntry, ListPage, error) {
+	if ctx.Err() != nil {
+		return nil, ListPage{}, ctx.Err()
+	}
+	if len(ff) > 0 {
+		return nil, ListPage{}, constraintError("Attribute filters are not supported in memory")
+	}
+	err := checkMemoryList(lq)
+	if err != nil {
+		return nil, ListPage{}, err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	ile := r.m.sortedItems(func(i Item) bool {
+		return !i.Retired() && (!storeless || i.BoxID == 0)
+	})
+	from, to, p, err := lq.window(len(ile))
+	if err != nil {
+		return nil, p, err
+	}
+	return ile[from:to], p, nil
+}
+
+func (r memoryItemRepository) Update(ctx context.Context, i *Item) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.updateItem(i)
+}
+
+func (r memoryItemRepository) SetBox(ctx context.Context, id int, boxID int) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	i, ok := r.m.items[id]
+	if !ok {
+		return fmt.Errorf("Error getting Item Details:%w", ErrNotFound)
+	}
+	i.BoxID = boxID
+	err := r.m.updateItem(&i)
+	if err != nil {
+		return fmt.Errorf("Error updating Item Details:%w", err)
+	}
+	return nil
+}
+
+func (r memoryItemRepository) Delete(ctx context.Context, id int) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.items, id)
+	return nil
+}
+
+func (r memoryItemRepository) Retire(ctx context.Context, id int, ir ItemRetirement) (Item, error) {
+	if ctx.Err() != nil {
+		return Item{}, ctx.Err()
+	}
+	err := checkRetirement(&ir)
+	if err != nil {
+		return Item{}, err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	i, ok := r.m.items[id]
+	if !ok {
+		return i, gorm.ErrRecordNotFound
+	}
+	if i.Retired() {
+		return i, conflictError("Item " + strconv.Itoa(id) + " is not in the active inventory")
+	}
+	ir.RetiredBoxID = i.BoxID
+	i.ItemRetirement = ir
+	i.BoxID = 0
+	i.Version++
+	r.m.items[id] = i
+	return i, nil
+}
+
+func (r memoryItemRepository) Reinstate(ctx context.Context, id int, boxID int) (Item, error) {
+	if ctx.Err() != nil {
+		return Item{}, ctx.Err()
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	i, ok := r.m.items[id]
+	if !ok {
+		return i, gorm.ErrRecordNotFound
+	}
+	if !i.Retired() {
+		return i, conflictError("Item is not retired")
+	}
+	if _, ok := r.m.boxes[boxID]; boxID != 0 && !ok {
+		return i, gorm.ErrRecordNotFound
+	}
+	i.ItemRetirement = ItemRetirement{}
+	i.BoxID = boxID
+	i.Version++
+	r.m.items[id] = i
+	return i, nil
+}
+
+func (r memoryItemRepository) Retired(ctx context.Context, year int) ([]Item, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var ii []Item
+	for _, i := range r.m.items {
+		if i.Retired() && (year == 0 || i.RetiredDate.Year() == year) {
+			ii = append(ii, i)
+		}
+	}
+	sort.Slice(ii, func(a, b int) bool {
+		return ii[a].RetiredDate.Before(ii[b].RetiredDate)
+	})
+	return ii, nil
+}
+
+type memoryBoxRepository struct {
+	m *memoryStore
+}
+
+func (r memoryBoxRepository) Insert(ctx context.Context, b *Box) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	err := validate(b, r.m.exists)
+	if err != nil {
+		return err
+	}
+	r.m.lastBox++
+	nb := *b
+	nb.BoxID = r.m.lastBox
+	code, err := strconv.Atoi(global.CreateBoxCode(nb.BoxID))
+	if err != nil {
+		return err
+	}
+	nb.Code = code
+	nb.Version = 1
+	// Insert the items on a copy of the store, so a refused item leaves the store unchanged
+	items := make(map[int]Item, len(r.m.items))
+	for id, i := range r.m.items {
+		items[id] = i
+	}
+	boxes := make(map[int]Box, len(r.m.boxes)+1)
+	for id, ob := range r.m.boxes {
+		boxes[id] = ob
+	}
+	stored := nb
+	stored.Items = nil
+	boxes[nb.BoxID] = stored
+	m := memoryStore{items: items, boxes: boxes, lastItem: r.m.lastItem}
+	nb.Items = make([]Item, len(b.Items))
+	for n, i := range b.Items {
+		i.ItemID = 0
+		i.BoxID = nb.BoxID
+		err = m.insertItem(&i)
+		if err != nil {
+			r.m.lastBox--
+			return err
+		}
+		nb.Items[n] = i
+	}
+	r.m.items, r.m.boxes, r.m.lastItem = m.items, m.boxes, m.lastItem
+	*b = nb
+	return nil
+}
+
+func (r memoryBoxRepository) Get(ctx context.Context, id int) (Box, error) {
+	if ctx.Err() != nil {
+		return Box{}, ctx.Err()
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	b, ok := r.m.boxes[id]
+	if !ok {
+		return b, gorm.ErrRecordNotFound
+	}
+	return b, nil
+}
+
+func boxEntry(b Box) BoxlistEntry {
+	return BoxlistEntry{
+		BoxID:       b.BoxID,
+		Version:     b.Version,
+		Code:        b.Code,
+		Description: b.Description,
+		Weight:      b.Weight,
+		Length:      b.Length,
+		Width:       b.Width,
+		Height:      b.Height,
+		LocationID:  b.LocationID,
+		StoreID:     b.StoreID,
+	}
+}
+
+func (r memoryBoxRepository) GetFull(ctx context.Context, id int) (BoxlistEntry, error) {
+	b, err := r.Get(ctx, id)
+	if err != nil {
+		return BoxlistEntry{}, err
+	}
+	return boxEntry(b), nil
+}
+
+func (r memoryBoxRepository) List(ctx context.Context, lq ListQuery) ([]BoxlistEntry, ListPage, error) {
+	if ctx.Err() != nil {
+		return nil, ListPage{}, ctx.Err()
+	}
+	err := checkMemoryList(lq)
+	if err != nil {
+		return nil, ListPage{}, err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var ble []BoxlistEntry
+	for _, b := range r.m.boxes {
+		ble = append(ble, boxEntry(b))
+	}
+	sort.Slice(ble, func(a, b int) bool {
+		return ble[a].BoxID < ble[b].BoxID
+	})
+	from, to, p, err := lq.window(len(ble))
+	if err != nil {
+		return nil, p, err
+	}
+	return ble[from:to], p, nil
+}
+
+func (r memoryBoxRepository) Items(ctx context.Context, id int) ([]ItemslistEntry, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.sortedItems(func(i Item) bool {
+		return i.BoxID == id
+	}), nil
+}
+
+func (r memoryBoxRepository) Update(ctx context.Context, b *Box) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	ob, ok := r.m.boxes[b.BoxID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if b.Version != 0 && b.Version != ob.Version {
+		return &VersionConflict{Entity: "Box", ID: b.BoxID, Version: b.Version}
+	}
+	if b.StoreID != ob.StoreID && b.LocationID == ob.LocationID {
+		b.LocationID = 0
+	}
+	err := validate(b, r.m.exists)
+	if err != nil {
+		return err
+	}
+	b.Version = ob.Version + 1
+	stored := *b
+	stored.Items = nil
+	r.m.boxes[b.BoxID] = stored
+	return nil
+}
+
+func (r memoryBoxRepository) Delete(ctx context.Context, id int) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var count int
+	for _, i := range r.m.items {
+		if i.BoxID == id {
+			count++
+		}
+	}
+	if count > 0 {
+		return &ReferenceError{Entity: "Box", Referenced: "items", Count: count}
+	}
+	delete(r.m.boxes, id)
+	return nil
+}
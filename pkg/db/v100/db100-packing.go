@@ -0,0 +1,175 @@
+package db100
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Chaosvermittlung/funkloch-server/internal/global"
+	"github.com/jinzhu/gorm"
+)
+
+var packingPolicy global.PackingConfig
+
+// SetPackingPolicy sets the packing rules from the configuration.
+func SetPackingPolicy(p global.PackingConfig) {
+	packingPolicy = p
+}
+
+// PackingRefusal is returned when the packing policy does not allow adding a box to a packinglist.
+type PackingRefusal struct {
+	Box     Box
+	Reasons []string
+}
+
+func (p *PackingRefusal) Error() string {
+	return "Box " + p.Box.Description + " can not be packed: " + strings.Join(p.Reasons, ", ")
+}
+
+// Is matches ErrConflict.
+func (p *PackingRefusal) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// SuitableBox is a box that can be added to a packinglist with the fault state of its contents.
+type SuitableBox struct {
+	Box
+	OpenFaults     int
+	UnfixableItems int
+	OverdueItems   int
+}
+
+type boxFaultCount struct {
+	BoxID          int
+	OpenFaults     int
+	UnfixableItems int
+}
+
+// getBoxFaultCounts counts the open faults and the items with unfixable faults per box.
+func getBoxFaultCounts(d *gorm.DB) (map[int]boxFaultCount, error) {
+	var bc []boxFaultCount
+	err := d.Table("faults").
+		Select("items.box_id as box_id, sum(case when faults.status in (?, ?) then 1 else 0 end) as open_faults, count(distinct case when faults.status = ? then faults.item_id end) as unfixable_items", FaultStatusNew, FaultStatusInRepair, FaultStatusUnfixable).
+		Joins("join items on faults.item_id = items.item_id").
+		Where("items.box_id <> 0 and items.deleted_at is null").
+		Group("items.box_id").
+		Scan(&bc)
+	res := make(map[int]boxFaultCount)
+	for _, c := range bc {
+		res[c.BoxID] = c
+	}
+	return res, err.Error
+}
+
+// checkPacking applies the packing policy to the box, reading through d.
+func checkPacking(d *gorm.DB, b Box) error {
+	if !packingPolicy.RefuseUnfixable && !packingPolicy.RefuseOverdueInspections {
+		return nil
+	}
+	err := d.First(&b, b.BoxID)
+	if err.Error != nil {
+		return err.Error
+	}
+	var reasons []string
+	if packingPolicy.RefuseUnfixable {
+		var count int
+		err2 := d.Table("faults").Joins("join items on faults.item_id = items.item_id").
+			Where("items.box_id = ? and items.deleted_at is null and faults.status = ?", b.BoxID, FaultStatusUnfixable).Count(&count)
+		if err2.Error != nil {
+			return err2.Error
+		}
+		if count > 0 {
+			reasons = append(reasons, strconv.Itoa(count)+" unfixable item(s)")
+		}
+	}
+	if packingPolicy.RefuseOverdueInspections {
+		oi, err := getOverdueItems(d, []int{b.BoxID})
+		if err != nil {
+			return err
+		}
+		if oi[b.BoxID] > 0 {
+			reasons = append(reasons, strconv.Itoa(oi[b.BoxID])+" item(s) with overdue inspection")
+		}
+	}
+	if len(reasons) > 0 {
+		return &PackingRefusal{Box: b, Reasons: reasons}
+	}
+	return nil
+}
+
+// loadOpenFaults sets the faults of the items that are not fixed, so packing views can flag them.
+func loadOpenFaults(d *gorm.DB, ii []Item) error {
+	if len(ii) == 0 {
+		return nil
+	}
+	var ids []int
+	for _, i := range ii {
+		ids = append(ids, i.ItemID)
+	}
+	var ff []Fault
+	err := d.Where("item_id in (?) and status <> ?", ids, FaultStatusFixed).Find(&ff)
+	if err.Error != nil {
+		return err.Error
+	}
+	faults := make(map[int][]Fault)
+	for _, f := range ff {
+		faults[f.ItemID] = append(faults[f.ItemID], f)
+	}
+	for n := range ii {
+		ii[n].Faults = faults[ii[n].ItemID]
+	}
+	return nil
+}
+
+// GetSuitableBoxes returns the boxes not yet packed for the event of the packinglist. Boxes with
+// healthy contents come first, followed by boxes with open faults, overdue inspections and
+// unfixable items. With hideFaulty set boxes with open faults or unfixable items are left out.
+func (p *Packinglist) GetSuitableBoxes(ctx context.Context, hideFaulty bool) ([]SuitableBox, error) {
+	var res []SuitableBox
+	bb, err := p.FindSuitableBoxes(ctx)
+	if err != nil {
+		return res, err
+	}
+	var fc map[int]boxFaultCount
+	var oi map[int]int
+	err = inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		fc, err = getBoxFaultCounts(d)
+		if err != nil {
+			return err
+		}
+		var ids []int
+		for _, b := range bb {
+			ids = append(ids, b.BoxID)
+		}
+		oi, err = getOverdueItems(d, ids)
+		return err
+	})
+	if err != nil {
+		return res, err
+	}
+	for _, b := range bb {
+		c := fc[b.BoxID]
+		if hideFaulty && (c.OpenFaults > 0 || c.UnfixableItems > 0) {
+			continue
+		}
+		if packingPolicy.RefuseUnfixable && c.UnfixableItems > 0 {
+			continue
+		}
+		if packingPolicy.RefuseOverdueInspections && oi[b.BoxID] > 0 {
+			continue
+		}
+		res = append(res, SuitableBox{Box: b, OpenFaults: c.OpenFaults, UnfixableItems: c.UnfixableItems, OverdueItems: oi[b.BoxID]})
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].UnfixableItems != res[j].UnfixableItems {
+			return res[i].UnfixableItems < res[j].UnfixableItems
+		}
+		if res[i].OverdueItems != res[j].OverdueItems {
+			return res[i].OverdueItems < res[j].OverdueItems
+		}
+		return res[i].OpenFaults < res[j].OpenFaults
+	})
+	return res, nil
+}
@@ -0,0 +1,214 @@
+package db100
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// FaultRepair is the repair effort of a fault. VendorCost is in cents.
+type FaultRepair struct {
+	LabourMinutes int `gorm:"not null;default:0"`
+	Vendor        string
+	VendorCost    int `gorm:"not null;default:0"`
+}
+
+// FaultPart is a spare part used to repair a fault. Parts taken from consumable stock name the
+// box or store they came from, other parts only reference their equipment. UnitPrice is in cents.
+type FaultPart struct {
+	FaultPartID int `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	FaultID     int `gorm:"not null"`
+	EquipmentID int `gorm:"not null"`
+	BoxID       int `gorm:"not null;default:0"`
+	StoreID     int `gorm:"not null;default:0"`
+	Quantity    int `gorm:"not null"`
+	UnitPrice   int `gorm:"not null;default:0"`
+	Comment     string
+	Recorded    time.Time
+}
+
+// RepairSpend is the repair spend on the items of an equipment. PartsCost and VendorCost are in cents.
+type RepairSpend struct {
+	EquipmentID   int
+	Name          string
+	Items         int
+	Faults        int
+	LabourMinutes int
+	PartsCost     int
+	VendorCost    int
+	Total         int
+	PerItem       int
+}
+
+func (r *FaultRepair) checkRepair() error {
+	if r.LabourMinutes < 0 || r.VendorCost < 0 {
+		return constraintError("Repair time and cost can not be negative")
+	}
+	return nil
+}
+
+// fromStock reports whether the part was taken from consumable stock.
+func (p *FaultPart) fromStock() bool {
+	return p.BoxID != 0 || p.StoreID != 0
+}
+
+// AddPart records a part used for the repair. Parts from a box or store are taken from its stock.
+func (f *Fault) AddPart(ctx context.Context, p FaultPart) (FaultPart, error) {
+	p.FaultID = f.FaultID
+	p.FaultPartID = 0
+	if p.Quantity <= 0 {
+		return p, constraintError("Part quantity has to be positive")
+	}
+	if p.UnitPrice < 0 {
+		return p, constraintError("Part price can not be negative")
+	}
+	if p.BoxID != 0 {
+		p.StoreID = 0
+	}
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.First(&f, f.FaultID).Error
+		if err != nil {
+			return err
+		}
+		if p.fromStock() {
+			_, err = checkConsumable(d, p.EquipmentID)
+		} else {
+			err = d.First(&Equipment{}, p.EquipmentID).Error
+		}
+		if err != nil {
+			return err
+		}
+		p.Recorded = time.Now()
+		if p.fromStock() {
+			err = takeStock(d, p.EquipmentID, p.BoxID, p.StoreID, p.Quantity)
+			if err != nil {
+				return err
+			}
+		}
+		err = d.Create(&p).Error
+		if err != nil || !p.fromStock() {
+			return err
+		}
+		return syncProcurementWishlist(d)
+	})
+	return p, err
+}
+
+// RemovePart removes a wrongly recorded part and puts parts taken from stock back.
+func (f *Fault) RemovePart(ctx context.Context, partID int) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		var p FaultPart
+		err := d.Where("fault_part_id = ? and fault_id = ?", partID, f.FaultID).First(&p).Error
+		if err != nil {
+			return err
+		}
+		if p.fromStock() {
+			err = returnStock(d, p.EquipmentID, p.BoxID, p.StoreID, p.Quantity)
+			if err != nil {
+				return err
+			}
+		}
+		err = d.Delete(&p).Error
+		if err != nil || !p.fromStock() {
+			return err
+		}
+		return syncProcurementWishlist(d)
+	})
+}
+
+func (f *Fault) GetParts(ctx context.Context) ([]FaultPart, error) {
+	var pp []FaultPart
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("fault_id = ?", f.FaultID).Order("recorded asc").Find(&pp).Error
+	})
+	return pp, err
+}
+
+type faultSpend struct {
+	EquipmentID   int
+	Faults        int
+	LabourMinutes int
+	VendorCost    int
+}
+
+type partSpend struct {
+	EquipmentID int
+	PartsCost   int
+}
+
+// GetRepairSpend totals the repair spend per equipment for the faults reported between from and to.
+// Zero times leave the range open. The result is ordered by total spend, most expensive first.
+func GetRepairSpend(ctx context.Context, from, to time.Time) ([]RepairSpend, error) {
+	var res []RepairSpend
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		res, err = getRepairSpend(d, from, to)
+		return err
+	})
+	return res, err
+}
+
+func getRepairSpend(d *gorm.DB, from, to time.Time) ([]RepairSpend, error) {
+	var res []RepairSpend
+	fq := d.Table("faults").Select("items.equipment_id as equipment_id, count(*) as faults, sum(faults.labour_minutes) as labour_minutes, sum(faults.vendor_cost) as vendor_cost").
+		Joins("join items on faults.item_id = items.item_id").
+		Group("items.equipment_id")
+	pq := d.Table("fault_parts").Select("items.equipment_id as equipment_id, sum(fault_parts.quantity * fault_parts.unit_price) as parts_cost").
+		Joins("join faults on fault_parts.fault_id = faults.fault_id").
+		Joins("join items on faults.item_id = items.item_id").
+		Group("items.equipment_id")
+	if !from.IsZero() {
+		fq = fq.Where("faults.created >= ?", from)
+		pq = pq.Where("faults.created >= ?", from)
+	}
+	if !to.IsZero() {
+		fq = fq.Where("faults.created <= ?", to)
+		pq = pq.Where("faults.created <= ?", to)
+	}
+	var fs []faultSpend
+	err := fq.Scan(&fs)
+	if err.Error != nil {
+		return res, err.Error
+	}
+	var ps []partSpend
+	err = pq.Scan(&ps)
+	if err.Error != nil {
+		return res, err.Error
+	}
+	parts := make(map[int]int)
+	for _, p := range ps {
+		parts[p.EquipmentID] = p.PartsCost
+	}
+	var ic []stockTotal
+	err = d.Table("items").Select("equipment_id, count(*) as total").Where("deleted_at is null").Group("equipment_id").Scan(&ic)
+	if err.Error != nil {
+		return res, err.Error
+	}
+	items := make(map[int]int)
+	for _, i := range ic {
+		items[i.EquipmentID] = i.Total
+	}
+	for _, s := range fs {
+		var e Equipment
+		err = d.Unscoped().First(&e, s.EquipmentID)
+		if err.Error != nil {
+			return res, err.Error
+		}
+		rs := RepairSpend{EquipmentID: s.EquipmentID, Name: e.Name, Items: items[s.EquipmentID], Faults: s.Faults,
+			LabourMinutes: s.LabourMinutes, PartsCost: parts[s.EquipmentID], VendorCost: s.VendorCost}
+		rs.Total = rs.PartsCost + rs.VendorCost
+		if rs.Items > 0 {
+			rs.PerItem = rs.Total / rs.Items
+		}
+		res = append(res, rs)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Total != res[j].Total {
+			return res[i].Total > res[j].Total
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
@@ -0,0 +1,218 @@
+package db100
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ItemRepository stores the items. Calls stop with the error of ctx when it is done.
+type ItemRepository interface {
+	// Insert inserts the item and assigns its id and code.
+	Insert(ctx context.Context, i *Item) error
+	Get(ctx context.Context, id int) (Item, error)
+	// GetFull returns the item with its box, store and equipment.
+	GetFull(ctx context.Context, id int) (ItemslistEntry, error)
+	// List returns a page of the active items, storeless limits it to items that are not in a box.
+	List(ctx context.Context, storeless bool, ff []AttributeFilter, lq ListQuery) ([]ItemslistEntry, ListPage, error)
+	// Update saves the item, its retirement is kept.
+	Update(ctx context.Context, i *Item) error
+	// SetBox puts the item into the box, a box id of 0 takes it out of its box.
+	SetBox(ctx context.Context, id int, boxID int) error
+	Delete(ctx context.Context, id int) error
+	// Retire takes the item out of the active inventory and returns it, see Item.Retire.
+	Retire(ctx context.Context, id int, r ItemRetirement) (Item, error)
+	// Reinstate puts a retired item back into the box and returns it, see Item.Reinstate.
+	Reinstate(ctx context.Context, id int, boxID int) (Item, error)
+	// Retired returns the items retired in the year ordered by retirement date, 0 returns all.
+	Retired(ctx context.Context, year int) ([]Item, error)
+}
+
+// BoxRepository stores the boxes. Calls stop with the error of ctx when it is done.
+type BoxRepository interface {
+	// Insert inserts the box together with its items and assigns their ids and codes.
+	Insert(ctx context.Context, b *Box) error
+	Get(ctx context.Context, id int) (Box, error)
+	// GetFull returns the box with its store and the store manager.
+	GetFull(ctx context.Context, id int) (BoxlistEntry, error)
+	List(ctx context.Context, lq ListQuery) ([]BoxlistEntry, ListPage, error)
+	// Items returns the items in the box, loose items on a shipped transfer are left out.
+	Items(ctx context.Context, id int) ([]ItemslistEntry, error)
+	Update(ctx context.Context, b *Box) error
+	// Delete moves the box to the trash, boxes that still contain items are refused with a ReferenceError.
+	Delete(ctx context.Context, id int) error
+}
+
+// Repositories bundles the repositories the api routers are built on. They cover the items,
+// including their retirement, and the boxes; the other entities are read from the package database.
+type Repositories struct {
+	Items ItemRepository
+	Boxes BoxRepository
+}
+
+// NewGormRepositories returns repositories on the database d. Every call runs in its own
+// transaction that is bound to the context of the call.
+func NewGormRepositories(d *gorm.DB) Repositories {
+	return Repositories{
+		Items: gormItemRepository{d},
+		Boxes: gormBoxRepository{d},
+	}
+}
+
+// DefaultRepositories returns the repositories on the database opened by Initialisation.
+func DefaultRepositories() Repositories {
+	return NewGormRepositories(db)
+}
+
+type gormItemRepository struct {
+	db *gorm.DB
+}
+
+func (r gormItemRepository) Insert(ctx context.Context, i *Item) error {
+	return transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return u.InsertItem(i)
+	})
+}
+
+func (r gormItemRepository) Get(ctx context.Context, id int) (Item, error) {
+	var i Item
+	err := transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return u.tx.First(&i, id).Error
+	})
+	return i, err
+}
+
+func (r gormItemRepository) GetFull(ctx context.Context, id int) (ItemslistEntry, error) {
+	var ile ItemslistEntry
+	err := transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return itemsJoined(u.tx).Where("items.item_id = ?", id).Scan(&ile).Error
+	})
+	return ile, err
+}
+
+func (r gormItemRepository) List(ctx context.Context, storeless bool, ff []AttributeFilter, lq ListQuery) ([]ItemslistEntry, ListPage, error) {
+	var ile []ItemslistEntry
+	var p ListPage
+	err := transaction(ctx, r.db, func(u *UnitOfWork) error {
+		var err error
+		ile, p, err = getItemsJoinedPage(ctx, u.tx, storeless, ff, lq)
+		return err
+	})
+	return ile, p, err
+}
+
+func (r gormItemRepository) Update(ctx context.Context, i *Item) error {
+	return transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return u.UpdateItem(i)
+	})
+}
+
+func (r gormItemRepository) SetBox(ctx context.Context, id int, boxID int) error {
+	return transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return u.SetItemBox(&Item{ItemID: id}, boxID)
+	})
+}
+
+func (r gormItemRepository) Delete(ctx context.Context, id int) error {
+	return transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return u.DeleteItem(&Item{ItemID: id})
+	})
+}
+
+func (r gormItemRepository) Retire(ctx context.Context, id int, ir ItemRetirement) (Item, error) {
+	i := Item{ItemID: id}
+	err := transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return u.RetireItem(&i, ir)
+	})
+	return i, err
+}
+
+func (r gormItemRepository) Reinstate(ctx context.Context, id int, boxID int) (Item, error) {
+	i := Item{ItemID: id}
+	err := transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return u.ReinstateItem(&i, boxID)
+	})
+	return i, err
+}
+
+func (r gormItemRepository) Retired(ctx context.Context, year int) ([]Item, error) {
+	var ii []Item
+	err := transaction(ctx, r.db, func(u *UnitOfWork) error {
+		var err error
+		ii, err = getRetiredItems(u.tx, year)
+		return err
+	})
+	return ii, err
+}
+
+type gormBoxRepository struct {
+	db *gorm.DB
+}
+
+func (r gormBoxRepository) Insert(ctx context.Context, b *Box) error {
+	return transaction(ctx, r.db, func(u *UnitOfWork) error {
+		ii := b.Items
+		b.Items = nil
+		err := u.InsertBox(b)
+		if err != nil {
+			return err
+		}
+		for n := range ii {
+			ii[n].ItemID = 0
+			ii[n].BoxID = b.BoxID
+			err = u.InsertItem(&ii[n])
+			if err != nil {
+				return err
+			}
+		}
+		b.Items = ii
+		return nil
+	})
+}
+
+func (r gormBoxRepository) Get(ctx context.Context, id int) (Box, error) {
+	var b Box
+	err := transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return u.tx.First(&b, id).Error
+	})
+	return b, err
+}
+
+func (r gormBoxRepository) GetFull(ctx context.Context, id int) (BoxlistEntry, error) {
+	var ble BoxlistEntry
+	err := transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return boxesJoined(u.tx).Where("Boxes.box_id = ?", id).Find(&ble).Error
+	})
+	return ble, err
+}
+
+func (r gormBoxRepository) List(ctx context.Context, lq ListQuery) ([]BoxlistEntry, ListPage, error) {
+	var ble []BoxlistEntry
+	var p ListPage
+	err := transaction(ctx, r.db, func(u *UnitOfWork) error {
+		var err error
+		ble, p, err = getBoxesJoinedPage(ctx, u.tx, lq)
+		return err
+	})
+	return ble, p, err
+}
+
+func (r gormBoxRepository) Items(ctx context.Context, id int) ([]ItemslistEntry, error) {
+	var ile []ItemslistEntry
+	err := transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return itemsNotInTransit(itemsJoined(u.tx).Where("items.box_id = ?", id)).Order("items.item_id asc").Scan(&ile).Error
+	})
+	return ile, err
+}
+
+func (r gormBoxRepository) Update(ctx context.Context, b *Box) error {
+	return transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return u.UpdateBox(b)
+	})
+}
+
+func (r gormBoxRepository) Delete(ctx context.Context, id int) error {
+	return transaction(ctx, r.db, func(u *UnitOfWork) error {
+		return u.DeleteBox(&Box{BoxID: id})
+	})
+}
@@ -0,0 +1,231 @@
+package db100
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type RetirementType int
+
+const (
+	RetirementNone RetirementType = 0 + iota
+	RetirementLost
+	RetirementStolen
+	RetirementDisposed
+	RetirementSold
+)
+
+// ItemRetirement records why and when an item left the inventory. Retired items are taken out
+// of their box, RetiredBoxID keeps the box they were in. Proceeds of sold items are in cents.
+type ItemRetirement struct {
+	Retirement    RetirementType `gorm:"not null;default:0"`
+	RetiredReason string
+	RetiredDate   time.Time
+	RetiredBoxID  int `gorm:"not null;default:0"`
+	Proceeds      int `gorm:"not null;default:0"`
+}
+
+type DisposalEntry struct {
+	Item          Item
+	EquipmentName string
+	BookValue     int
+}
+
+type DisposalTotal struct {
+	Retirement    RetirementType
+	Count         int
+	PurchaseValue int
+	BookValue     int
+	Proceeds      int
+}
+
+// DisposalReport lists the items retired in Year with their book value at retirement.
+type DisposalReport struct {
+	Year          int
+	Items         []DisposalEntry
+	Totals        []DisposalTotal
+	PurchaseValue int
+	BookValue     int
+	Proceeds      int
+}
+
+func (t RetirementType) String() string {
+	switch t {
+	case RetirementNone:
+		return "Active"
+	case RetirementLost:
+		return "Lost"
+	case RetirementStolen:
+		return "Stolen"
+	case RetirementDisposed:
+		return "Disposed"
+	case RetirementSold:
+		return "Sold"
+	}
+	return "Unknown"
+}
+
+// Retired reports whether the item left the inventory.
+func (r *ItemRetirement) Retired() bool {
+	return r.Retirement != RetirementNone
+}
+
+// checkRetirement checks the retirement and fills in the proceeds and date it implies.
+func checkRetirement(r *ItemRetirement) error {
+	if r.Retirement < RetirementLost || r.Retirement > RetirementSold {
+		return constraintError("Retirement type out of bound")
+	}
+	if r.Proceeds < 0 {
+		return constraintError("Proceeds can not be negative")
+	}
+	if r.Retirement != RetirementSold {
+		r.Proceeds = 0
+	}
+	if r.RetiredDate.IsZero() {
+		r.RetiredDate = time.Now()
+	}
+	return nil
+}
+
+// retireItem retires an active item within the transaction.
+func retireItem(tx *gorm.DB, itemID int, r ItemRetirement) error {
+	err0 := checkRetirement(&r)
+	if err0 != nil {
+		return err0
+	}
+	err := tx.Model(&Item{}).Where("item_id = ? and retirement = ?", itemID, RetirementNone).Updates(map[string]interface{}{
+		"retirement":     r.Retirement,
+		"retired_reason": r.RetiredReason,
+		"retired_date":   r.RetiredDate,
+		"retired_box_id": gorm.Expr("box_id"),
+		"proceeds":       r.Proceeds,
+		"box_id":         0,
+		"version":        gorm.Expr("version + 1"),
+	})
+	if err.Error != nil {
+		return err.Error
+	}
+	if err.RowsAffected == 0 {
+		return conflictError("Item " + strconv.Itoa(itemID) + " is not in the active inventory")
+	}
+	return nil
+}
+
+// Retire marks the item as lost, stolen, disposed or sold. The item and its faults stay in the
+// history but it no longer counts for the active inventory, its box, packing or audits.
+func (i *Item) Retire(ctx context.Context, r ItemRetirement) error {
+	return TransactionContext(ctx, func(u *UnitOfWork) error {
+		return u.RetireItem(i, r)
+	})
+}
+
+// Reinstate puts a retired item, e.g. a lost item that turned up again, back into the box.
+func (i *Item) Reinstate(ctx context.Context, boxID int) error {
+	return TransactionContext(ctx, func(u *UnitOfWork) error {
+		return u.ReinstateItem(i, boxID)
+	})
+}
+
+// RetireItem retires the item like Item.Retire and reloads it.
+func (u *UnitOfWork) RetireItem(i *Item, r ItemRetirement) error {
+	err := u.tx.First(i, i.ItemID)
+	if err.Error != nil {
+		return err.Error
+	}
+	err2 := retireItem(u.tx, i.ItemID, r)
+	if err2 != nil {
+		return err2
+	}
+	return u.tx.First(i, i.ItemID).Error
+}
+
+// ReinstateItem reinstates the item like Item.Reinstate and reloads it.
+func (u *UnitOfWork) ReinstateItem(i *Item, boxID int) error {
+	err := u.tx.First(i, i.ItemID)
+	if err.Error != nil {
+		return err.Error
+	}
+	if !i.Retired() {
+		return conflictError("Item is not retired")
+	}
+	if boxID != 0 {
+		err = u.tx.First(&Box{}, boxID)
+		if err.Error != nil {
+			return err.Error
+		}
+	}
+	err = u.tx.Model(i).Updates(map[string]interface{}{
+		"retirement":     RetirementNone,
+		"retired_reason": "",
+		"retired_date":   time.Time{},
+		"retired_box_id": 0,
+		"proceeds":       0,
+		"box_id":         boxID,
+	})
+	if err.Error != nil {
+		return err.Error
+	}
+	return u.tx.First(i, i.ItemID).Error
+}
+
+func getRetiredItems(d *gorm.DB, year int) ([]Item, error) {
+	var ii []Item
+	q := d.Where("retirement <> ?", RetirementNone)
+	if year != 0 {
+		from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+		q = q.Where("retired_date >= ? and retired_date < ?", from, from.AddDate(1, 0, 0))
+	}
+	err := q.Order("retired_date asc").Find(&ii)
+	return ii, err.Error
+}
+
+// GetDisposalReport lists the items retired in the year and totals them per retirement type.
+func GetDisposalReport(ctx context.Context, year int) (DisposalReport, error) {
+	dr := DisposalReport{Year: year}
+	var ii []Item
+	var ee []Equipment
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		ii, err = getRetiredItems(d, year)
+		if err != nil {
+			return err
+		}
+		return d.Find(&ee).Error
+	})
+	if err != nil {
+		return dr, err
+	}
+	equipment := make(map[int]Equipment)
+	for _, e := range ee {
+		equipment[e.EquipmentID] = e
+	}
+	totals := make(map[RetirementType]*DisposalTotal)
+	for _, i := range ii {
+		e := equipment[i.EquipmentID]
+		bv := i.Depreciate(e.DepreciationYears, i.RetiredDate)
+		dr.Items = append(dr.Items, DisposalEntry{Item: i, EquipmentName: e.Name, BookValue: bv})
+		t, ok := totals[i.Retirement]
+		if !ok {
+			t = &DisposalTotal{Retirement: i.Retirement}
+			totals[i.Retirement] = t
+		}
+		t.Count++
+		t.PurchaseValue += i.PurchasePrice
+		t.BookValue += bv
+		t.Proceeds += i.Proceeds
+		dr.PurchaseValue += i.PurchasePrice
+		dr.BookValue += bv
+		dr.Proceeds += i.Proceeds
+	}
+	for _, t := range totals {
+		dr.Totals = append(dr.Totals, *t)
+	}
+	sort.Slice(dr.Totals, func(i, j int) bool {
+		return dr.Totals[i].Retirement < dr.Totals[j].Retirement
+	})
+	return dr, nil
+}
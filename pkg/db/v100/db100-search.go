@@ -0,0 +1,274 @@
+package db100
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+)
+
+// MaxSearchResults is the largest number of results a search returns.
+const MaxSearchResults = 100
+
+// SearchResult is a row matching a search. Rank orders the results, higher ranks match better.
+type SearchResult struct {
+	Kind string
+	ID   int
+	Text string
+	Rank float64
+}
+
+// searchSource is a searched column. The index row of a source row is id*8+code, so results
+// map back to their rows without storing the kind in the index.
+type searchSource struct {
+	kind       string
+	code       int
+	table      string
+	key        string
+	column     string
+	softDelete bool
+}
+
+var searchSources = []searchSource{
+	{"equipment", 1, "equipment", "equipment_id", "name", true},
+	{"item", 2, "items", "item_id", "description", true},
+	{"box", 3, "boxes", "box_id", "description", true},
+	{"store", 4, "stores", "store_id", "name", true},
+	{"fault", 5, "faults", "fault_id", "comment", false},
+	{"event", 6, "events", "event_id", "name", true},
+}
+
+// searchEngine is the full-text module of the search index: fts5 or fts4 on sqlite, postgres.
+var searchEngine string
+
+func getSearchSource(kind string) (searchSource, error) {
+	for _, s := range searchSources {
+		if s.kind == kind {
+			return s, nil
+		}
+	}
+	return searchSource{}, constraintError("Unknown search kind " + kind)
+}
+
+func (s searchSource) rowID(prefix string) string {
+	return prefix + "." + s.key + "*8+" + strconv.Itoa(s.code)
+}
+
+// initSearch creates the search index and the triggers that keep it current on every insert,
+// update and delete. A new index is filled with the existing rows. Deleted rows in the trash
+// are not searchable until they are restored.
+func initSearch(driver string) error {
+	var err error
+	switch driver {
+	case "sqlite3":
+		err = initSqliteSearch()
+	case "postgres":
+		err = initPostgresSearch()
+	default:
+		err = errors.New("Search is not supported for driver " + driver)
+	}
+	if err != nil {
+		return err
+	}
+	var count int
+	err2 := db.Raw("select count(*) from search_index").Row().Scan(&count)
+	if err2 != nil || count > 0 {
+		return err2
+	}
+	for _, s := range searchSources {
+		q := "insert into search_index(" + searchKeyColumn() + ", body) select " + s.rowID(s.table) +
+			", coalesce(" + s.column + ", '') from " + s.table
+		if s.softDelete {
+			q = q + " where deleted_at is null"
+		}
+		err := db.Exec(q)
+		if err.Error != nil {
+			return err.Error
+		}
+	}
+	return nil
+}
+
+func searchKeyColumn() string {
+	if searchEngine == "postgres" {
+		return "id"
+	}
+	return "rowid"
+}
+
+// initSqliteSearch uses FTS5 if the sqlite driver was built with the sqlite_fts5 tag
+// and falls back to FTS4 otherwise.
+func initSqliteSearch() error {
+	var sql []string
+	err := db.Raw("select sql from sqlite_master where name = 'search_index'").Pluck("sql", &sql)
+	if err.Error != nil {
+		return err.Error
+	}
+	switch {
+	case len(sql) > 0 && strings.Contains(strings.ToLower(sql[0]), "fts5"):
+		searchEngine = "fts5"
+	case len(sql) > 0:
+		searchEngine = "fts4"
+	default:
+		var fts5 bool
+		err2 := db.Raw("select sqlite_compileoption_used('ENABLE_FTS5')").Row().Scan(&fts5)
+		if err2 != nil {
+			return err2
+		}
+		searchEngine = "fts4"
+		if fts5 {
+			searchEngine = "fts5"
+		}
+		err = db.Exec("create virtual table search_index using " + searchEngine + "(body)")
+		if err.Error != nil {
+			return err.Error
+		}
+	}
+	for _, s := range searchSources {
+		cond := "1"
+		cols := s.column
+		if s.softDelete {
+			cond = "new.deleted_at is null"
+			cols = cols + ", deleted_at"
+		}
+		insert := "insert into search_index(rowid, body) select " + s.rowID("new") + ", coalesce(new." + s.column + ", '') where " + cond + ";"
+		remove := "delete from search_index where rowid = " + s.rowID("old") + ";"
+		tt := []string{
+			"create trigger if not exists search_" + s.table + "_insert after insert on " + s.table + " begin " + insert + " end",
+			"create trigger if not exists search_" + s.table + "_update after update of " + cols + " on " + s.table + " begin " + remove + " " + insert + " end",
+			"create trigger if not exists search_" + s.table + "_delete after delete on " + s.table + " begin " + remove + " end",
+		}
+		for _, t := range tt {
+			err = db.Exec(t)
+			if err.Error != nil {
+				return err.Error
+			}
+		}
+	}
+	return nil
+}
+
+func initPostgresSearch() error {
+	searchEngine = "postgres"
+	ss := []string{
+		"create table if not exists search_index (id bigint primary key, body text not null, " +
+			"tsv tsvector generated always as (to_tsvector('simple', body)) stored)",
+		"create index if not exists search_index_tsv on search_index using gin(tsv)",
+	}
+	for _, s := range searchSources {
+		cond := "true"
+		if s.softDelete {
+			cond = "new.deleted_at is null"
+		}
+		ss = append(ss,
+			"create or replace function search_"+s.table+"() returns trigger as $$ begin "+
+				"if tg_op <> 'INSERT' then delete from search_index where id = "+s.rowID("old")+"; end if; "+
+				"if tg_op <> 'DELETE' and "+cond+" then insert into search_index(id, body) values ("+s.rowID("new")+", coalesce(new."+s.column+", '')); end if; "+
+				"return null; end $$ language plpgsql",
+			"drop trigger if exists search_"+s.table+" on "+s.table,
+			"create trigger search_"+s.table+" after insert or update or delete on "+s.table+" for each row execute procedure search_"+s.table+"()")
+	}
+	for _, q := range ss {
+		err := db.Exec(q)
+		if err.Error != nil {
+			return err.Error
+		}
+	}
+	return nil
+}
+
+// searchTerms splits the query into words. Every word has to match, a word also matches
+// longer words starting with it.
+func searchTerms(q string) []string {
+	return strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+type searchRow struct {
+	ID      int
+	Body    string
+	Rank    float64
+	Offsets string
+}
+
+// Search returns the rows matching all words of the query, best matches first.
+// A kind like box or event limits the search to one kind of row.
+func Search(ctx context.Context, q string, kind string, limit int) ([]SearchResult, error) {
+	var res []SearchResult
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		return res, constraintError("Search query is empty")
+	}
+	if limit <= 0 || limit > MaxSearchResults {
+		limit = MaxSearchResults
+	}
+	var rows []searchRow
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		switch searchEngine {
+		case "fts5":
+			return searchSqlite(d, &rows, "rowid as id, body, -bm25(search_index) as rank", strings.Join(terms, "* ")+"*", kind, "rank desc", limit)
+		case "fts4":
+			return searchSqlite(d, &rows, "rowid as id, body, offsets(search_index) as offsets", strings.Join(terms, "* ")+"*", kind, "", 0)
+		case "postgres":
+			qq := d.Table("search_index").Select("id, body, ts_rank(tsv, to_tsquery('simple', ?)) as rank", strings.Join(terms, ":* & ")+":*").
+				Where("tsv @@ to_tsquery('simple', ?)", strings.Join(terms, ":* & ")+":*")
+			if kind != "" {
+				s, err := getSearchSource(kind)
+				if err != nil {
+					return err
+				}
+				qq = qq.Where("id % 8 = ?", s.code)
+			}
+			return qq.Order("rank desc").Limit(limit).Scan(&rows).Error
+		}
+		return errors.New("Search is not initialised")
+	})
+	if err != nil {
+		return res, err
+	}
+	for _, r := range rows {
+		sr := SearchResult{ID: r.ID / 8, Text: r.Body, Rank: r.Rank}
+		for _, s := range searchSources {
+			if s.code == r.ID%8 {
+				sr.Kind = s.kind
+			}
+		}
+		if searchEngine == "fts4" {
+			// FTS4 has no ranking function, offsets lists four numbers per hit
+			sr.Rank = float64(len(strings.Fields(r.Offsets)) / 4)
+		}
+		res = append(res, sr)
+	}
+	if searchEngine == "fts4" {
+		sort.SliceStable(res, func(i, j int) bool {
+			return res[i].Rank > res[j].Rank
+		})
+		if len(res) > limit {
+			res = res[:limit]
+		}
+	}
+	return res, nil
+}
+
+func searchSqlite(d *gorm.DB, rows *[]searchRow, sel string, match string, kind string, order string, limit int) error {
+	q := d.Table("search_index").Select(sel).Where("search_index match ?", match)
+	if kind != "" {
+		s, err := getSearchSource(kind)
+		if err != nil {
+			return err
+		}
+		q = q.Where("rowid % 8 = ?", s.code)
+	}
+	if order != "" {
+		q = q.Order(order)
+	}
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	return q.Scan(rows).Error
+}
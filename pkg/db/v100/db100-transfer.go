@@ -0,0 +1,526 @@
+package db100
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type TransferStatus int
+
+const (
+	TransferStatusDraft TransferStatus = 0 + iota
+	TransferStatusShipped
+	TransferStatusReceived
+)
+
+type Transfer struct {
+	TransferID  int            `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	FromStoreID int            `gorm:"not null"`
+	ToStoreID   int            `gorm:"not null"`
+	Status      TransferStatus `gorm:"not null;default:0"`
+	Comment     string
+	Created     time.Time
+	Shipped     time.Time
+	Received    time.Time
+	Boxes       []TransferBox  `gorm:"foreignkey:TransferID;association_foreignkey:TransferID"`
+	Items       []TransferItem `gorm:"foreignkey:TransferID;association_foreignkey:TransferID"`
+	Versioned
+}
+
+type TransferBox struct {
+	TransferID int  `gorm:"type:integer;primary_key;not null"`
+	BoxID      int  `gorm:"type:integer;primary_key;not null"`
+	Received   bool `gorm:"not null;default:false"`
+}
+
+// TransferItem moves a single item out of a box of the source store. FromBoxID is recorded when
+// the transfer is shipped, ToBoxID is the box in the receiving store the item is put into.
+type TransferItem struct {
+	TransferID int  `gorm:"type:integer;primary_key;not null"`
+	ItemID     int  `gorm:"type:integer;primary_key;not null"`
+	FromBoxID  int  `gorm:"not null;default:0"`
+	ToBoxID    int  `gorm:"not null;default:0"`
+	Received   bool `gorm:"not null;default:false"`
+}
+
+// boxesInTransit and itemsInTransit select the boxes and loose items on shipped transfers.
+const (
+	boxesInTransit = "select transfer_boxes.box_id from transfer_boxes join transfers on transfers.transfer_id = transfer_boxes.transfer_id where transfers.status = ?"
+	itemsInTransit = "select transfer_items.item_id from transfer_items join transfers on transfers.transfer_id = transfer_items.transfer_id where transfers.status = ?"
+)
+
+// itemsNotInTransit leaves the loose items on shipped transfers out of an items query.
+func itemsNotInTransit(q *gorm.DB) *gorm.DB {
+	return q.Where("items.item_id not in ("+itemsInTransit+")", TransferStatusShipped)
+}
+
+// checkBoxInTransit returns a conflict if the box is on a shipped transfer.
+func checkBoxInTransit(d *gorm.DB, boxID int) error {
+	var count int
+	err := d.Table("transfer_boxes").Where("box_id in ("+boxesInTransit+") and box_id = ?", TransferStatusShipped, boxID).Count(&count)
+	if err.Error != nil {
+		return err.Error
+	}
+	if count > 0 {
+		return conflictError("Box " + strconv.Itoa(boxID) + " is in transit")
+	}
+	return nil
+}
+
+// checkItemInTransit returns a conflict if the item is on a shipped transfer or in a box on one.
+func checkItemInTransit(d *gorm.DB, i Item) error {
+	var count int
+	err := d.Table("transfer_items").Where("item_id in ("+itemsInTransit+") and item_id = ?", TransferStatusShipped, i.ItemID).Count(&count)
+	if err.Error != nil {
+		return err.Error
+	}
+	if count > 0 {
+		return conflictError("Item " + strconv.Itoa(i.ItemID) + " is in transit")
+	}
+	if i.BoxID != 0 {
+		return checkBoxInTransit(d, i.BoxID)
+	}
+	return nil
+}
+
+type TransferScan struct {
+	TransferScanID int       `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	TransferID     int       `gorm:"not null"`
+	Code           int       `gorm:"type:integer(13);not null"`
+	Scanned        time.Time `gorm:"not null"`
+}
+
+type TransferReport struct {
+	TransferID    int
+	Status        TransferStatus
+	ReceivedBoxes []Box
+	ReceivedItems []Item
+	MissingBoxes  []Box
+	MissingItems  []Item
+	Unexpected    []int
+}
+
+func (t *Transfer) Insert(ctx context.Context) error {
+	if t.FromStoreID == t.ToStoreID {
+		return constraintError("Transfer source and destination store are the same")
+	}
+	t.Status = TransferStatusDraft
+	t.Created = time.Now()
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Create(&t).Error
+	})
+}
+
+var transferListFields = listFields{
+	"transfer_id":   {"transfer_id", fieldInt},
+	"from_store_id": {"from_store_id", fieldInt},
+	"to_store_id":   {"to_store_id", fieldInt},
+	"status":        {"status", fieldInt},
+	"created":       {"created", fieldDate},
+	"shipped":       {"shipped", fieldDate},
+	"received":      {"received", fieldDate},
+}
+
+func GetTransfersPage(ctx context.Context, lq ListQuery) ([]Transfer, ListPage, error) {
+	var t []Transfer
+	p, err := getPage(ctx, db.Model(&Transfer{}), &t, lq, transferListFields, "transfer_id asc")
+	return t, p, err
+}
+
+// GetTransfersInTransit returns all shipped but not yet received transfers from or to the store.
+// A storeID of 0 returns the transfers of all stores.
+func GetTransfersInTransit(ctx context.Context, storeID int) ([]Transfer, error) {
+	var tt []Transfer
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		q := d.Where("status = ?", TransferStatusShipped)
+		if storeID != 0 {
+			q = q.Where("from_store_id = ? or to_store_id = ?", storeID, storeID)
+		}
+		err := q.Find(&tt)
+		if err.Error != nil {
+			return err.Error
+		}
+		for i := range tt {
+			err := tt[i].loadLines(d)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return tt, err
+}
+
+func (t *Transfer) loadLines(d *gorm.DB) error {
+	err := d.Where("transfer_id = ?", t.TransferID).Find(&t.Boxes)
+	if err.Error != nil {
+		return err.Error
+	}
+	err = d.Where("transfer_id = ?", t.TransferID).Find(&t.Items)
+	return err.Error
+}
+
+func (t *Transfer) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, t.getDetails)
+}
+
+func (t *Transfer) getDetails(d *gorm.DB) error {
+	err := d.First(&t, t.TransferID)
+	if err.Error != nil {
+		return err.Error
+	}
+	return t.loadLines(d)
+}
+
+// Update changes the stores and comment of a draft transfer. The status can only be changed by Ship and Receive.
+func (t *Transfer) Update(ctx context.Context) error {
+	if t.FromStoreID == t.ToStoreID {
+		return constraintError("Transfer source and destination store are the same")
+	}
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		var ot Transfer
+		err := d.First(&ot, t.TransferID)
+		if err.Error != nil {
+			return err.Error
+		}
+		if ot.Status != TransferStatusDraft {
+			return conflictError("Only draft transfers can be changed")
+		}
+		t.Status = ot.Status
+		t.Created = ot.Created
+		err = d.Model(&t).Updates(map[string]interface{}{"from_store_id": t.FromStoreID, "to_store_id": t.ToStoreID, "comment": t.Comment})
+		if err.Error != nil {
+			return err.Error
+		}
+		return t.loadLines(d)
+	})
+}
+
+func (t *Transfer) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.First(&t, t.TransferID)
+		if err.Error != nil {
+			return err.Error
+		}
+		if t.Status != TransferStatusDraft {
+			return conflictError("Only draft transfers can be deleted")
+		}
+		err = d.Where("transfer_id = ?", t.TransferID).Delete(TransferBox{})
+		if err.Error != nil {
+			return err.Error
+		}
+		err = d.Where("transfer_id = ?", t.TransferID).Delete(TransferItem{})
+		if err.Error != nil {
+			return err.Error
+		}
+		return d.Delete(&t).Error
+	})
+}
+
+func (t *Transfer) checkDraft(d *gorm.DB) error {
+	err := d.First(&t, t.TransferID)
+	if err.Error != nil {
+		return err.Error
+	}
+	if t.Status != TransferStatusDraft {
+		return conflictError("Transfer is not a draft anymore")
+	}
+	return nil
+}
+
+func (t *Transfer) AddTransferBox(ctx context.Context, b Box) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := t.checkDraft(d)
+		if err != nil {
+			return err
+		}
+		err = d.First(&b, b.BoxID).Error
+		if err != nil {
+			return err
+		}
+		if b.StoreID != t.FromStoreID {
+			return conflictError("Box is not in the source store of the transfer")
+		}
+		err = checkBoxInTransit(d, b.BoxID)
+		if err != nil {
+			return err
+		}
+		tb := TransferBox{TransferID: t.TransferID, BoxID: b.BoxID}
+		return d.Create(&tb).Error
+	})
+}
+
+func (t *Transfer) RemoveTransferBox(ctx context.Context, b Box) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := t.checkDraft(d)
+		if err != nil {
+			return err
+		}
+		return d.Where("transfer_id = ? and box_id = ?", t.TransferID, b.BoxID).Delete(TransferBox{}).Error
+	})
+}
+
+func (t *Transfer) AddTransferItem(ctx context.Context, i Item, toBoxID int) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := t.checkDraft(d)
+		if err != nil {
+			return err
+		}
+		err = d.First(&i, i.ItemID).Error
+		if err != nil {
+			return err
+		}
+		err = t.checkItemSource(d, i)
+		if err != nil {
+			return err
+		}
+		if toBoxID == 0 {
+			return constraintError("Target box is required")
+		}
+		var b Box
+		err = d.First(&b, toBoxID).Error
+		if err != nil {
+			return lookupError("Error getting target Box: ", err)
+		}
+		if b.StoreID != t.ToStoreID {
+			return conflictError("Target box is not in the destination store of the transfer")
+		}
+		ti := TransferItem{TransferID: t.TransferID, ItemID: i.ItemID, FromBoxID: i.BoxID, ToBoxID: toBoxID}
+		return d.Create(&ti).Error
+	})
+}
+
+// checkItemSource checks that the item is in a box of the source store of the transfer
+// and not in transit already.
+func (t *Transfer) checkItemSource(d *gorm.DB, i Item) error {
+	if i.BoxID == 0 {
+		return conflictError("Item is not in the source store of the transfer")
+	}
+	var b Box
+	err := d.First(&b, i.BoxID).Error
+	if err != nil {
+		return err
+	}
+	if b.StoreID != t.FromStoreID {
+		return conflictError("Item is not in the source store of the transfer")
+	}
+	return checkItemInTransit(d, i)
+}
+
+func (t *Transfer) RemoveTransferItem(ctx context.Context, i Item) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := t.checkDraft(d)
+		if err != nil {
+			return err
+		}
+		return d.Where("transfer_id = ? and item_id = ?", t.TransferID, i.ItemID).Delete(TransferItem{}).Error
+	})
+}
+
+// Ship marks a draft transfer as shipped. The boxes and items stay booked on their source store
+// until they are received, but are left out of the store inventory and can not be moved or packed.
+func (t *Transfer) Ship(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := t.getDetails(d)
+		if err != nil {
+			return err
+		}
+		if t.Status != TransferStatusDraft {
+			return conflictError("Only draft transfers can be shipped")
+		}
+		if len(t.Boxes) == 0 && len(t.Items) == 0 {
+			return conflictError("Transfer is empty")
+		}
+		for _, tb := range t.Boxes {
+			var b Box
+			err := d.First(&b, tb.BoxID).Error
+			if err != nil {
+				return err
+			}
+			if b.StoreID != t.FromStoreID {
+				return conflictError("Box " + b.Description + " is not in the source store anymore")
+			}
+			err = checkBoxInTransit(d, b.BoxID)
+			if err != nil {
+				return err
+			}
+		}
+		for _, ti := range t.Items {
+			var i Item
+			err := d.First(&i, ti.ItemID).Error
+			if err != nil {
+				return err
+			}
+			err = t.checkItemSource(d, i)
+			if err != nil {
+				return err
+			}
+			err2 := d.Model(&ti).Where("transfer_id = ? and item_id = ?", ti.TransferID, ti.ItemID).Update("from_box_id", i.BoxID)
+			if err2.Error != nil {
+				return err2.Error
+			}
+		}
+		t.Status = TransferStatusShipped
+		t.Shipped = time.Now()
+		return d.Model(&t).Updates(map[string]interface{}{"status": t.Status, "shipped": t.Shipped}).Error
+	})
+}
+
+// Scan records a box or item code scanned while unloading a shipped transfer.
+func (t *Transfer) Scan(ctx context.Context, code int) (TransferScan, error) {
+	ts := TransferScan{TransferID: t.TransferID, Code: code, Scanned: time.Now()}
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.First(&t, t.TransferID)
+		if err.Error != nil {
+			return err.Error
+		}
+		if t.Status != TransferStatusShipped {
+			return conflictError("Only shipped transfers can be scanned")
+		}
+		return d.Create(&ts).Error
+	})
+	return ts, err
+}
+
+func (t *Transfer) GetScans(ctx context.Context) ([]TransferScan, error) {
+	var ts []TransferScan
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		ts, err = t.getScans(d)
+		return err
+	})
+	return ts, err
+}
+
+func (t *Transfer) getScans(d *gorm.DB) ([]TransferScan, error) {
+	var ts []TransferScan
+	err := d.Where("transfer_id = ?", t.TransferID).Order("scanned asc").Find(&ts)
+	return ts, err.Error
+}
+
+// GetReport compares the scanned codes against the transfer lines. For shipped transfers this is a
+// preview of what Receive would book, for received transfers it is the final discrepancy report.
+func (t *Transfer) GetReport(ctx context.Context) (TransferReport, error) {
+	var tr TransferReport
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		tr, err = t.getReport(d)
+		return err
+	})
+	return tr, err
+}
+
+func (t *Transfer) getReport(d *gorm.DB) (TransferReport, error) {
+	var tr TransferReport
+	err := t.getDetails(d)
+	if err != nil {
+		return tr, err
+	}
+	tr.TransferID = t.TransferID
+	tr.Status = t.Status
+	ss, err := t.getScans(d)
+	if err != nil {
+		return tr, err
+	}
+	scanned := make(map[int]bool)
+	for _, s := range ss {
+		scanned[s.Code] = true
+	}
+	known := make(map[int]bool)
+	for _, tb := range t.Boxes {
+		var b Box
+		err := d.First(&b, tb.BoxID).Error
+		if err != nil {
+			return tr, err
+		}
+		known[b.Code] = true
+		if scanned[b.Code] || tb.Received {
+			tr.ReceivedBoxes = append(tr.ReceivedBoxes, b)
+		} else {
+			tr.MissingBoxes = append(tr.MissingBoxes, b)
+		}
+	}
+	for _, ti := range t.Items {
+		var i Item
+		err := d.First(&i, ti.ItemID).Error
+		if err != nil {
+			return tr, err
+		}
+		known[i.Code] = true
+		if scanned[i.Code] || ti.Received {
+			tr.ReceivedItems = append(tr.ReceivedItems, i)
+		} else {
+			tr.MissingItems = append(tr.MissingItems, i)
+		}
+	}
+	for _, s := range ss {
+		if !known[s.Code] {
+			tr.Unexpected = append(tr.Unexpected, s.Code)
+			known[s.Code] = true
+		}
+	}
+	return tr, nil
+}
+
+// Receive books all scanned boxes and items into the destination store and closes the transfer
+// in one transaction. Lines that were not scanned stay booked on the source store and are listed
+// as missing in the report.
+func (t *Transfer) Receive(ctx context.Context) (TransferReport, error) {
+	var tr TransferReport
+	err := TransactionContext(ctx, func(u *UnitOfWork) error {
+		var err error
+		tr, err = t.getReport(u.tx)
+		if err != nil {
+			return err
+		}
+		if t.Status != TransferStatusShipped {
+			return conflictError("Only shipped transfers can be received")
+		}
+		// The transfer is closed first, the goods are not in transit anymore when they are booked.
+		received := time.Now()
+		err2 := u.tx.Model(&Transfer{}).Where("transfer_id = ? and status = ?", t.TransferID, TransferStatusShipped).
+			Updates(map[string]interface{}{"status": TransferStatusReceived, "received": received, "version": gorm.Expr("version + 1")})
+		if err2.Error != nil {
+			return err2.Error
+		}
+		if err2.RowsAffected == 0 {
+			return conflictError("Only shipped transfers can be received")
+		}
+		for _, b := range tr.ReceivedBoxes {
+			b.StoreID = t.ToStoreID
+			b.LocationID = 0
+			err := u.UpdateBox(&b)
+			if err != nil {
+				return err
+			}
+			err2 := u.tx.Model(TransferBox{}).Where("transfer_id = ? and box_id = ?", t.TransferID, b.BoxID).Update("received", true)
+			if err2.Error != nil {
+				return err2.Error
+			}
+		}
+		for _, i := range tr.ReceivedItems {
+			var ti TransferItem
+			err2 := u.tx.Where("transfer_id = ? and item_id = ?", t.TransferID, i.ItemID).First(&ti)
+			if err2.Error != nil {
+				return err2.Error
+			}
+			i.BoxID = ti.ToBoxID
+			err := u.UpdateItem(&i)
+			if err != nil {
+				return err
+			}
+			err2 = u.tx.Model(&ti).Where("transfer_id = ? and item_id = ?", t.TransferID, i.ItemID).Update("received", true)
+			if err2.Error != nil {
+				return err2.Error
+			}
+		}
+		t.Status = TransferStatusReceived
+		t.Received = received
+		return nil
+	})
+	tr.Status = t.Status
+	return tr, err
+}
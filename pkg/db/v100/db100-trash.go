@@ -0,0 +1,424 @@
+package db100
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SoftDelete marks a row as deleted. Deleted rows are hidden from all queries until they are
+// restored from the trash or purged after the retention period.
+type SoftDelete struct {
+	DeletedAt *time.Time `sql:"index"`
+}
+
+// trash soft deletes the rows of the model matching the query at the given time,
+// so rows deleted together can be restored together.
+func trash(tx *gorm.DB, model interface{}, at time.Time, query string, args ...interface{}) error {
+	err := tx.Model(model).Where(query, args...).UpdateColumn("deleted_at", at)
+	return err.Error
+}
+
+// ReferenceError is returned when a row can not be deleted because other rows still reference it.
+type ReferenceError struct {
+	Entity     string
+	Referenced string
+	Count      int
+}
+
+func (r *ReferenceError) Error() string {
+	return r.Entity + " is still referenced by " + strconv.Itoa(r.Count) + " " + r.Referenced
+}
+
+// Is matches ErrConflict.
+func (r *ReferenceError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// TrashEntry is a deleted row. Name is the name, description or code of the row.
+type TrashEntry struct {
+	Kind      string
+	ID        int
+	Name      string
+	DeletedAt time.Time
+}
+
+type trashTable struct {
+	kind  string
+	table string
+	key   string
+	name  string
+}
+
+// trashTables lists the soft deleted tables in purge order, rows referencing others come first.
+var trashTables = []trashTable{
+	{"item", "items", "item_id", "code"},
+	{"packinglist", "packinglists", "packinglist_id", "name"},
+	{"box", "boxes", "box_id", "description"},
+	{"wishlist", "wishlists", "wishlist_id", "name"},
+	{"event", "events", "event_id", "name"},
+	{"store", "stores", "store_id", "name"},
+	{"equipment", "equipment", "equipment_id", "name"},
+	{"user", "users", "user_id", "username"},
+}
+
+func getTrashTable(kind string) (trashTable, error) {
+	for _, t := range trashTables {
+		if t.kind == kind {
+			return t, nil
+		}
+	}
+	return trashTable{}, constraintError("Unknown trash kind " + kind)
+}
+
+func getTrash(d *gorm.DB, kind string) ([]TrashEntry, error) {
+	var res []TrashEntry
+	for _, t := range trashTables {
+		if kind != "" && kind != t.kind {
+			continue
+		}
+		var te []TrashEntry
+		err := d.Table(t.table).Select(t.key + " as id, " + t.name + " as name, deleted_at").
+			Where("deleted_at is not null").Order("deleted_at desc").Scan(&te)
+		if err.Error != nil {
+			return res, err.Error
+		}
+		for n := range te {
+			te[n].Kind = t.kind
+		}
+		res = append(res, te...)
+	}
+	if kind != "" && len(res) == 0 {
+		_, err := getTrashTable(kind)
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// GetTrashPage returns a page of the deleted rows, most recently deleted first. The trash spans
+// several tables, so it only filters by kind and can not be sorted.
+func GetTrashPage(ctx context.Context, lq ListQuery) ([]TrashEntry, ListPage, error) {
+	var kind string
+	for param, vv := range lq.Filters {
+		if param != "kind" || len(vv) > 1 {
+			return nil, ListPage{}, &ListQueryError{param, "the trash can only be filtered by one kind"}
+		}
+		kind = vv[0]
+	}
+	if len(lq.Sort) > 0 {
+		return nil, ListPage{}, &ListQueryError{"sort", "the trash can not be sorted"}
+	}
+	var te []TrashEntry
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		te, err = getTrash(d, kind)
+		return err
+	})
+	if err != nil {
+		return te, ListPage{}, err
+	}
+	sort.SliceStable(te, func(i, j int) bool {
+		return te[i].DeletedAt.After(te[j].DeletedAt)
+	})
+	from, to, p, err := lq.window(len(te))
+	if err != nil {
+		return nil, p, err
+	}
+	return te[from:to], p, nil
+}
+
+// getDeletedAt returns when the row was deleted, nil if it is not in the trash.
+func getDeletedAt(d *gorm.DB, t trashTable, id int) (*time.Time, error) {
+	var te TrashEntry
+	err := d.Table(t.table).Select("deleted_at").Where(t.key+" = ? and deleted_at is not null", id).Scan(&te)
+	if err.RecordNotFound() {
+		return nil, nil
+	}
+	if err.Error != nil {
+		return nil, err.Error
+	}
+	return &te.DeletedAt, nil
+}
+
+// checkRestore makes sure the rows a restored row references are not deleted.
+func checkRestore(d *gorm.DB, kind string, id int) error {
+	switch kind {
+	case "item":
+		var i Item
+		err := d.Unscoped().First(&i, id)
+		if err.Error != nil {
+			return err.Error
+		}
+		if i.BoxID != 0 && d.First(&Box{}, i.BoxID).Error != nil {
+			return conflictError("Restore box " + strconv.Itoa(i.BoxID) + " first")
+		}
+		if d.First(&Equipment{}, i.EquipmentID).Error != nil {
+			return conflictError("Restore equipment " + strconv.Itoa(i.EquipmentID) + " first")
+		}
+		err2 := i.checkSerial(d)
+		if err2 != nil {
+			return err2
+		}
+	case "box":
+		var b Box
+		err := d.Unscoped().First(&b, id)
+		if err.Error != nil {
+			return err.Error
+		}
+		if d.First(&Store{}, b.StoreID).Error != nil {
+			return conflictError("Restore store " + strconv.Itoa(b.StoreID) + " first")
+		}
+	case "packinglist":
+		var p Packinglist
+		err := d.Unscoped().First(&p, id)
+		if err.Error != nil {
+			return err.Error
+		}
+		if d.First(&Event{}, p.EventID).Error != nil {
+			return conflictError("Restore event " + strconv.Itoa(p.EventID) + " first")
+		}
+	case "user":
+		var u User
+		err := d.Unscoped().First(&u, id)
+		if err.Error != nil {
+			return err.Error
+		}
+		var count int
+		err = d.Model(&User{}).Where("username = ?", u.Username).Count(&count)
+		if err.Error != nil {
+			return err.Error
+		}
+		if count > 0 {
+			return conflictError("Username " + u.Username + " is taken")
+		}
+	}
+	return nil
+}
+
+// Restore takes a row out of the trash. Rows deleted together with it, like the boxes and
+// items of a store deleted with cascade, are restored as well.
+func Restore(ctx context.Context, kind string, id int) error {
+	t, err := getTrashTable(kind)
+	if err != nil {
+		return err
+	}
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		at, err := getDeletedAt(d, t, id)
+		if err != nil {
+			return err
+		}
+		if at == nil {
+			return notFoundError(kind + " " + strconv.Itoa(id) + " is not in the trash")
+		}
+		err = checkRestore(d, kind, id)
+		if err != nil {
+			return err
+		}
+		err2 := d.Table(t.table).Where(t.key+" = ?", id).UpdateColumn("deleted_at", nil)
+		if err2.Error == nil && kind == "store" {
+			err2 = d.Table("items").Where("deleted_at = ? and box_id in (select box_id from boxes where store_id = ? and deleted_at = ?)", at, id, at).UpdateColumn("deleted_at", nil)
+			if err2.Error == nil {
+				err2 = d.Table("boxes").Where("store_id = ? and deleted_at = ?", id, at).UpdateColumn("deleted_at", nil)
+			}
+		}
+		if err2.Error == nil && kind == "event" {
+			err2 = d.Table("packinglists").Where("event_id = ? and deleted_at = ?", id, at).UpdateColumn("deleted_at", nil)
+		}
+		return err2.Error
+	})
+}
+
+// purgeDependents hard deletes the rows that only exist for the purged rows. It returns the
+// storage keys of the files of the deleted attachments.
+func purgeDependents(d *gorm.DB, kind string, ids []int) ([]string, error) {
+	var keys []string
+	switch kind {
+	case "item":
+		for _, id := range ids {
+			err := d.Where("item_id = ?", id).Delete(AttributeValue{})
+			if err.Error != nil {
+				return keys, err.Error
+			}
+			err2 := deleteItemInspections(d, id)
+			if err2 != nil {
+				return keys, err2
+			}
+			var ff []Fault
+			err = d.Where("item_id = ?", id).Find(&ff)
+			if err.Error != nil {
+				return keys, err.Error
+			}
+			for _, f := range ff {
+				fk, err2 := f.delete(d)
+				if err2 != nil {
+					return keys, err2
+				}
+				keys = append(keys, fk...)
+			}
+		}
+		return purgeAttachments(d, keys, AttachmentOwnerItem, ids)
+	case "packinglist":
+		err := d.Exec("delete from packinglist_boxes where packinglist_packinglist_id in (?)", ids)
+		return keys, err.Error
+	case "box":
+		err := d.Exec("delete from packinglist_boxes where box_box_id in (?)", ids)
+		if err.Error != nil {
+			return keys, err.Error
+		}
+		err = d.Where("box_id in (?)", ids).Delete(Stock{})
+		if err.Error != nil {
+			return keys, err.Error
+		}
+		return purgeAttachments(d, keys, AttachmentOwnerBox, ids)
+	case "wishlist":
+		err := d.Exec("delete from wishlist_equipment where wishlist_wishlist_id in (?)", ids)
+		if err.Error != nil {
+			return keys, err.Error
+		}
+		err = d.Exec("delete from wishlist_category where wishlist_wishlist_id in (?)", ids)
+		return keys, err.Error
+	case "event":
+		err := d.Where("event_id in (?)", ids).Delete(Participant{})
+		if err.Error != nil {
+			return keys, err.Error
+		}
+		return purgeAttachments(d, keys, AttachmentOwnerEvent, ids)
+	case "store":
+		err := d.Where("store_id in (?)", ids).Delete(Stock{})
+		if err.Error != nil {
+			return keys, err.Error
+		}
+		err = d.Where("store_id in (?)", ids).Delete(Location{})
+		return keys, err.Error
+	case "equipment":
+		err := d.Where("attribute_id in (select attribute_id from attributes where equipment_id in (?))", ids).Delete(AttributeValue{})
+		if err.Error != nil {
+			return keys, err.Error
+		}
+		err = d.Where("equipment_id in (?)", ids).Delete(Attribute{})
+		if err.Error != nil {
+			return keys, err.Error
+		}
+		err = d.Where("equipment_id in (?)", ids).Delete(InspectionType{})
+		if err.Error != nil {
+			return keys, err.Error
+		}
+		return purgeAttachments(d, keys, AttachmentOwnerEquipment, ids)
+	}
+	return keys, nil
+}
+
+// purgeAttachments deletes the attachments of the purged owners and adds their storage keys to keys.
+func purgeAttachments(d *gorm.DB, keys []string, ownerType AttachmentOwner, ids []int) ([]string, error) {
+	ak, err := deleteAttachments(d, ownerType, ids)
+	return append(keys, ak...), err
+}
+
+// purgeBlocked counts the rows still referencing a row, referenced rows stay in the trash.
+// Transfers and audits keep their boxes and items, so they stay readable.
+var purgeBlocked = map[string][]string{
+	"item": {
+		"select count(*) from transfer_items where item_id = ?",
+		"select count(*) from audit_entries where item_id = ?",
+	},
+	"box": {
+		"select count(*) from items where box_id = ?",
+		"select count(*) from transfer_boxes where box_id = ?",
+		"select count(*) from audit_entries where box_id = ?",
+	},
+	"event":     {"select count(*) from packinglists where event_id = ?"},
+	"store":     {"select count(*) from boxes where store_id = ?"},
+	"equipment": {"select count(*) from items where equipment_id = ?"},
+}
+
+// PurgeTrash hard deletes the rows deleted before the given time and returns how many were purged.
+// Rows still referenced by other rows are kept until those are purged.
+func PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	var count int
+	var keys []string
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		count, keys, err = purgeTrash(d, before)
+		return err
+	})
+	if err != nil {
+		return count, err
+	}
+	removeAttachmentFiles(keys)
+	return count, nil
+}
+
+func purgeTrash(d *gorm.DB, before time.Time) (int, []string, error) {
+	var count int
+	var keys []string
+	for _, t := range trashTables {
+		var te []TrashEntry
+		err := d.Table(t.table).Select(t.key+" as id").Where("deleted_at is not null and deleted_at < ?", before).Scan(&te)
+		if err.Error != nil {
+			return count, keys, err.Error
+		}
+		var ids []int
+		for _, e := range te {
+			refs, err2 := countReferences(d, t.kind, e.ID)
+			if err2 != nil {
+				return count, keys, err2
+			}
+			if refs == 0 {
+				ids = append(ids, e.ID)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		dk, err2 := purgeDependents(d, t.kind, ids)
+		keys = append(keys, dk...)
+		if err2 != nil {
+			return count, keys, err2
+		}
+		err = d.Exec("delete from "+t.table+" where "+t.key+" in (?)", ids)
+		if err.Error != nil {
+			return count, keys, err.Error
+		}
+		count += len(ids)
+	}
+	return count, keys, nil
+}
+
+// countReferences counts the rows still referencing the row of the kind.
+func countReferences(d *gorm.DB, kind string, id int) (int, error) {
+	var count int
+	for _, q := range purgeBlocked[kind] {
+		var refs int
+		err := d.Raw(q, id).Row().Scan(&refs)
+		if err != nil {
+			return count, err
+		}
+		count += refs
+	}
+	return count, nil
+}
+
+// StartTrashPurge purges the trash once a day, keeping deleted rows for retentionDays.
+// A retention of 0 keeps deleted rows until they are purged manually.
+func StartTrashPurge(retentionDays int) {
+	if retentionDays <= 0 {
+		return
+	}
+	go func() {
+		for {
+			n, err := PurgeTrash(context.Background(), time.Now().AddDate(0, 0, -retentionDays))
+			if err != nil {
+				log.Println("Error purging trash:", err)
+			} else if n > 0 {
+				log.Println("Purged", n, "rows from the trash")
+			}
+			time.Sleep(24 * time.Hour)
+		}
+	}()
+}
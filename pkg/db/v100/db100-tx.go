@@ -0,0 +1,226 @@
+package db100
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/Chaosvermittlung/funkloch-server/internal/global"
+	"github.com/jinzhu/gorm"
+)
+
+// UnitOfWork groups db100 operations into one transaction, so an API call changing several
+// rows either changes all of them or none. Reads inside a unit of work see its own changes.
+type UnitOfWork struct {
+	tx *gorm.DB
+}
+
+// TransactionContext runs fn in a new unit of work. The changes are committed if fn returns nil
+// and rolled back if it returns an error or panics. The unit of work is also rolled back when ctx
+// is done or the query timeout passed before it is committed.
+func TransactionContext(ctx context.Context, fn func(u *UnitOfWork) error) error {
+	return transaction(ctx, db, fn)
+}
+
+// transaction runs fn in a unit of work on the database d. The queries of the unit of work
+// are cancelled when ctx is done or the query timeout passed.
+func transaction(ctx context.Context, d *gorm.DB, fn func(u *UnitOfWork) error) (err error) {
+	ctx, cancel := queryContext(ctx)
+	defer cancel()
+	tx := d.BeginTx(ctx, nil)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+	err = fn(&UnitOfWork{tx: tx})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// InsertBox inserts the box and assigns its code. Items of the box are inserted with InsertItem.
+func (u *UnitOfWork) InsertBox(b *Box) error {
+	err := u.tx.Set("gorm:save_associations", false).Create(b)
+	if err.Error != nil {
+		return err.Error
+	}
+	code, err2 := strconv.Atoi(global.CreateBoxCode(b.BoxID))
+	if err2 != nil {
+		return err2
+	}
+	b.Code = code
+	err = u.tx.Model(b).UpdateColumn("code", code)
+	return err.Error
+}
+
+// InsertItem inserts the item and assigns its code.
+func (u *UnitOfWork) InsertItem(i *Item) error {
+	err := i.checkSerial(u.tx)
+	if err != nil {
+		return err
+	}
+	err2 := u.tx.Create(i)
+	if err2.Error != nil {
+		return i.serialError(u.tx, err2.Error)
+	}
+	code, err := strconv.Atoi(global.CreateItemCode(i.ItemID))
+	if err != nil {
+		return err
+	}
+	i.Code = code
+	err2 = u.tx.Model(i).UpdateColumn("code", code)
+	return err2.Error
+}
+
+// UpdateBox saves the box. A box moved to another store leaves its location there,
+// boxes in transit can not be moved.
+func (u *UnitOfWork) UpdateBox(b *Box) error {
+	var ob Box
+	err := u.tx.First(&ob, b.BoxID)
+	if err.Error != nil {
+		return err.Error
+	}
+	if b.StoreID != ob.StoreID || b.LocationID != ob.LocationID {
+		err2 := checkBoxInTransit(u.tx, b.BoxID)
+		if err2 != nil {
+			return err2
+		}
+	}
+	if b.StoreID != ob.StoreID && b.LocationID == ob.LocationID {
+		b.LocationID = 0
+	}
+	err = u.tx.Save(b)
+	return err.Error
+}
+
+// DeleteBox moves the box to the trash. Boxes that still contain items can not be deleted.
+func (u *UnitOfWork) DeleteBox(b *Box) error {
+	var count int
+	err := u.tx.Model(&Item{}).Where("box_id = ?", b.BoxID).Count(&count)
+	if err.Error != nil {
+		return err.Error
+	}
+	if count > 0 {
+		return &ReferenceError{Entity: "Box", Referenced: "items", Count: count}
+	}
+	err = u.tx.Delete(b)
+	return err.Error
+}
+
+// UpdateItem saves the item. The retirement can only be changed with Retire and Reinstate,
+// items in transit can not be moved and nothing can be put into a box in transit.
+func (u *UnitOfWork) UpdateItem(i *Item) error {
+	var oi Item
+	err := u.tx.First(&oi, i.ItemID)
+	if err.Error != nil {
+		return err.Error
+	}
+	i.ItemRetirement = oi.ItemRetirement
+	if i.Retired() && i.BoxID != 0 {
+		return conflictError("Retired items can not be put into a box")
+	}
+	if i.BoxID != oi.BoxID {
+		err2 := checkItemInTransit(u.tx, oi)
+		if err2 != nil {
+			return err2
+		}
+		if i.BoxID != 0 {
+			err2 = checkBoxInTransit(u.tx, i.BoxID)
+			if err2 != nil {
+				return err2
+			}
+		}
+	}
+	err2 := i.checkSerial(u.tx)
+	if err2 != nil {
+		return err2
+	}
+	code, err2 := strconv.Atoi(global.CreateItemCode(i.ItemID))
+	if err2 != nil {
+		return err2
+	}
+	i.Code = code
+	err = u.tx.Save(i)
+	if err.Error != nil {
+		return i.serialError(u.tx, err.Error)
+	}
+	return nil
+}
+
+// SetItemBox puts the item into the box, a box id of 0 takes it out of its box.
+func (u *UnitOfWork) SetItemBox(i *Item, id int) error {
+	err := u.tx.First(i, i.ItemID)
+	if err.Error != nil {
+		return fmt.Errorf("Error getting Item Details:%w", err.Error)
+	}
+	i.BoxID = id
+	err2 := u.UpdateItem(i)
+	if err2 != nil {
+		return fmt.Errorf("Error updating Item Details:%w", err2)
+	}
+	return nil
+}
+
+// DeleteItem moves the item to the trash.
+func (u *UnitOfWork) DeleteItem(i *Item) error {
+	err := u.tx.Delete(i)
+	return err.Error
+}
+
+// InsertPackinglist inserts the packinglist without its boxes, they are added with AddPackinglistBox.
+func (u *UnitOfWork) InsertPackinglist(p *Packinglist) error {
+	p.Weight = 0
+	err := u.tx.Set("gorm:save_associations", false).Create(p)
+	return err.Error
+}
+
+// AddPackinglistBox packs the box and updates the weight of the packinglist. Boxes in transit can not be packed.
+func (u *UnitOfWork) AddPackinglistBox(p *Packinglist, b Box) error {
+	err := u.tx.First(&Packinglist{}, p.PackinglistID)
+	if err.Error != nil {
+		return err.Error
+	}
+	err2 := checkBoxInTransit(u.tx, b.BoxID)
+	if err2 != nil {
+		return err2
+	}
+	err2 = checkPacking(u.tx, b)
+	if err2 != nil {
+		return err2
+	}
+	err3 := u.tx.Model(p).Association("Boxes").Append(&b)
+	if err3.Error != nil {
+		return err3.Error
+	}
+	return u.updatePackinglistWeight(p)
+}
+
+// RemovePackinglistBox unpacks the box and updates the weight of the packinglist.
+func (u *UnitOfWork) RemovePackinglistBox(p *Packinglist, b Box) error {
+	err := u.tx.Model(p).Association("Boxes").Delete(&b)
+	if err.Error != nil {
+		return err.Error
+	}
+	return u.updatePackinglistWeight(p)
+}
+
+func (u *UnitOfWork) updatePackinglistWeight(p *Packinglist) error {
+	var weight int
+	err := u.tx.Table("boxes").Select("coalesce(sum(boxes.weight), 0)").
+		Joins("join packinglist_boxes on packinglist_boxes.box_box_id = boxes.box_id").
+		Where("packinglist_boxes.packinglist_packinglist_id = ? and boxes.deleted_at is null", p.PackinglistID).
+		Row().Scan(&weight)
+	if err != nil {
+		return err
+	}
+	p.Weight = weight
+	err2 := u.tx.Model(&Packinglist{}).Where("packinglist_id = ?", p.PackinglistID).UpdateColumn("weight", weight)
+	return err2.Error
+}
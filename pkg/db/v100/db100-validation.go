@@ -0,0 +1,227 @@
+package db100
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Codes of the rules a field can break, for clients to tell the violations apart.
+const (
+	ViolationRequired  = "required"
+	ViolationMin       = "min"
+	ViolationReference = "reference"
+	ViolationOrder     = "order"
+)
+
+// FieldViolation describes a rule the value of a field breaks.
+type FieldViolation struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// ValidationError is returned when an entity is inserted or updated with fields that break its rules.
+type ValidationError struct {
+	Entity string
+	Fields []FieldViolation
+}
+
+func (v *ValidationError) Error() string {
+	var ss []string
+	for _, f := range v.Fields {
+		ss = append(ss, f.Field+" "+f.Message)
+	}
+	return v.Entity + " is invalid: " + strings.Join(ss, ", ")
+}
+
+// Is matches ErrConstraint.
+func (v *ValidationError) Is(target error) bool {
+	return target == ErrConstraint
+}
+
+// existsFunc reports if the row of the model with the id exists and has the values of conds
+// in its columns. Without conds any row with the id matches.
+type existsFunc func(model interface{}, id int, conds map[string]interface{}) (bool, error)
+
+// fieldCheck checks the value f of a field of the entity e. It returns the code and message of
+// the violated rule, or an empty code if the value is valid.
+type fieldCheck func(f reflect.Value, e reflect.Value, exists existsFunc) (string, string, error)
+
+type fieldRule struct {
+	Field string
+	Check fieldCheck
+}
+
+// entityRules are the rules of the entities, they are checked before every insert and update.
+var entityRules = map[reflect.Type][]fieldRule{
+	reflect.TypeOf(Store{}): {
+		{"Name", required},
+		{"ManagerID", required},
+		{"ManagerID", references(&User{})},
+	},
+	reflect.TypeOf(Equipment{}): {
+		{"Name", required},
+		{"CategoryID", references(&Category{})},
+		{"DepreciationYears", atLeast(0)},
+		{"ReorderLevel", atLeast(0)},
+	},
+	reflect.TypeOf(Box{}): {
+		{"StoreID", required},
+		{"StoreID", references(&Store{})},
+		{"LocationID", referencesWith(&Location{}, "store_id", "StoreID")},
+		{"Weight", atLeast(0)},
+		{"Length", atLeast(0)},
+		{"Width", atLeast(0)},
+		{"Height", atLeast(0)},
+	},
+	reflect.TypeOf(Item{}): {
+		{"EquipmentID", required},
+		{"EquipmentID", references(&Equipment{})},
+		{"BoxID", references(&Box{})},
+		{"PurchasePrice", atLeast(0)},
+	},
+	reflect.TypeOf(Event{}): {
+		{"Name", required},
+		{"End", notBefore("Start")},
+	},
+	reflect.TypeOf(Participant{}): {
+		{"UserID", required},
+		{"UserID", references(&User{})},
+		{"EventID", required},
+		{"EventID", references(&Event{})},
+		{"Departure", notBefore("Arrival")},
+	},
+	reflect.TypeOf(Packinglist{}): {
+		{"Name", required},
+		{"EventID", required},
+		{"EventID", references(&Event{})},
+	},
+	reflect.TypeOf(Fault{}): {
+		{"ItemID", required},
+		{"ItemID", references(&Item{})},
+		{"AssigneeID", references(&User{})},
+	},
+}
+
+func required(f reflect.Value, e reflect.Value, exists existsFunc) (string, string, error) {
+	if f.IsZero() {
+		return ViolationRequired, "must be set", nil
+	}
+	return "", "", nil
+}
+
+func atLeast(min int64) fieldCheck {
+	return func(f reflect.Value, e reflect.Value, exists existsFunc) (string, string, error) {
+		if f.Int() < min {
+			return ViolationMin, "must be at least " + strconv.FormatInt(min, 10), nil
+		}
+		return "", "", nil
+	}
+}
+
+// references checks that the id in the field is one of a row of the model, 0 references nothing.
+func references(model interface{}) fieldCheck {
+	name := reflect.TypeOf(model).Elem().Name()
+	return func(f reflect.Value, e reflect.Value, exists existsFunc) (string, string, error) {
+		id := int(f.Int())
+		if id == 0 {
+			return "", "", nil
+		}
+		ok, err := exists(model, id, nil)
+		if err != nil || ok {
+			return "", "", err
+		}
+		return ViolationReference, name + " " + strconv.Itoa(id) + " does not exist", nil
+	}
+}
+
+// referencesWith checks like references that the referenced row also has the value of the
+// field other of the entity in its column, like a location in the store of the box.
+func referencesWith(model interface{}, column string, other string) fieldCheck {
+	name := reflect.TypeOf(model).Elem().Name()
+	return func(f reflect.Value, e reflect.Value, exists existsFunc) (string, string, error) {
+		id := int(f.Int())
+		if id == 0 {
+			return "", "", nil
+		}
+		ok, err := exists(model, id, map[string]interface{}{column: e.FieldByName(other).Interface()})
+		if err != nil || ok {
+			return "", "", err
+		}
+		return ViolationReference, name + " " + strconv.Itoa(id) + " does not exist for this " + other, nil
+	}
+}
+
+// notBefore checks that the time in the field is not before the time in the field other.
+// Times that are not set are not compared.
+func notBefore(other string) fieldCheck {
+	return func(f reflect.Value, e reflect.Value, exists existsFunc) (string, string, error) {
+		t, _ := f.Interface().(time.Time)
+		o, _ := e.FieldByName(other).Interface().(time.Time)
+		if !t.IsZero() && !o.IsZero() && t.Before(o) {
+			return ViolationOrder, "must not be before " + other, nil
+		}
+		return "", "", nil
+	}
+}
+
+// validate checks the entity against its rules and returns a ValidationError listing every
+// violation. Entities without rules are always valid.
+func validate(entity interface{}, exists existsFunc) error {
+	e := reflect.Indirect(reflect.ValueOf(entity))
+	for e.Kind() == reflect.Ptr {
+		e = e.Elem()
+	}
+	rules, ok := entityRules[e.Type()]
+	if !ok {
+		return nil
+	}
+	var fv []FieldViolation
+	for _, r := range rules {
+		code, msg, err := r.Check(e.FieldByName(r.Field), e, exists)
+		if err != nil {
+			return err
+		}
+		if code != "" {
+			fv = append(fv, FieldViolation{r.Field, code, msg})
+		}
+	}
+	if len(fv) > 0 {
+		return &ValidationError{Entity: e.Type().Name(), Fields: fv}
+	}
+	return nil
+}
+
+// registerValidation validates every entity before it is inserted or saved. References are
+// looked up in the transaction of the change. Update and Updates only change the given columns
+// of a model that is usually not loaded, so they are not validated.
+func registerValidation(d *gorm.DB) {
+	d.Callback().Create().Before("gorm:create").Register("funkloch:validate", validateScope)
+	d.Callback().Update().Before("funkloch:version").Register("funkloch:validate", validateScope)
+}
+
+func validateScope(scope *gorm.Scope) {
+	if scope.HasError() {
+		return
+	}
+	if _, ok := scope.InstanceGet("gorm:update_interface"); ok {
+		return
+	}
+	err := validate(scope.Value, func(model interface{}, id int, conds map[string]interface{}) (bool, error) {
+		var count int
+		ms := scope.NewDB().NewScope(model)
+		q := scope.NewDB().Model(model).Where(ms.Quote(ms.PrimaryKey())+" = ?", id)
+		if conds != nil {
+			q = q.Where(conds)
+		}
+		err := q.Count(&count)
+		return count > 0, err.Error
+	})
+	if err != nil {
+		scope.Err(err)
+	}
+}
@@ -0,0 +1,187 @@
+package db100
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jinzhu/gorm"
+)
+
+type Vehicle struct {
+	VehicleID   int    `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	Name        string `gorm:"not null"`
+	Plate       string
+	Payload     int `gorm:"not null;default:0"`
+	CargoLength int `gorm:"not null;default:0"`
+	CargoWidth  int `gorm:"not null;default:0"`
+	CargoHeight int `gorm:"not null;default:0"`
+	Versioned
+}
+
+func (v *Vehicle) Insert(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Create(&v).Error
+	})
+}
+
+func GetVehicles(ctx context.Context) ([]Vehicle, error) {
+	var v []Vehicle
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Find(&v).Error
+	})
+	return v, err
+}
+
+var vehicleListFields = listFields{
+	"vehicle_id": {"vehicle_id", fieldInt},
+	"name":       {"name", fieldString},
+	"plate":      {"plate", fieldString},
+	"payload":    {"payload", fieldInt},
+}
+
+func GetVehiclesPage(ctx context.Context, lq ListQuery) ([]Vehicle, ListPage, error) {
+	var v []Vehicle
+	p, err := getPage(ctx, db.Model(&Vehicle{}), &v, lq, vehicleListFields, "vehicle_id asc")
+	return v, p, err
+}
+
+func GetVehiclesByID(ctx context.Context, ids []int) ([]Vehicle, error) {
+	var v []Vehicle
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("vehicle_id in (?)", ids).Find(&v).Error
+	})
+	return v, err
+}
+
+func (v *Vehicle) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&v, v.VehicleID).Error
+	})
+}
+
+func (v *Vehicle) Update(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Save(&v).Error
+	})
+}
+
+func (v *Vehicle) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Delete(&v).Error
+	})
+}
+
+// CargoVolume returns the usable volume of the cargo area. 0 means the cargo dimensions are unknown.
+func (v *Vehicle) CargoVolume() int {
+	return v.CargoLength * v.CargoWidth * v.CargoHeight
+}
+
+// Fits reports whether the box fits through the cargo area in any orientation.
+// Vehicles without recorded cargo dimensions accept every box.
+func (v *Vehicle) Fits(b Box) bool {
+	if v.CargoVolume() == 0 || b.Volume() == 0 {
+		return true
+	}
+	cargo := []int{v.CargoLength, v.CargoWidth, v.CargoHeight}
+	box := []int{b.Length, b.Width, b.Height}
+	sort.Ints(cargo)
+	sort.Ints(box)
+	for i := range cargo {
+		if box[i] > cargo[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type VehicleLoad struct {
+	Vehicle    Vehicle
+	Boxes      []Box
+	Weight     int
+	Volume     int
+	Overweight bool
+}
+
+func (vl *VehicleLoad) hasRoomFor(b Box) bool {
+	if !vl.Vehicle.Fits(b) {
+		return false
+	}
+	cv := vl.Vehicle.CargoVolume()
+	if cv > 0 && vl.Volume+b.Volume() > cv {
+		return false
+	}
+	return true
+}
+
+// hasPayloadFor reports whether the box stays within the payload. Vehicles without recorded
+// payload accept every box.
+func (vl *VehicleLoad) hasPayloadFor(b Box) bool {
+	return vl.Vehicle.Payload == 0 || vl.Weight+b.Weight <= vl.Vehicle.Payload
+}
+
+func (vl *VehicleLoad) add(b Box) {
+	vl.Boxes = append(vl.Boxes, b)
+	vl.Weight = vl.Weight + b.Weight
+	vl.Volume = vl.Volume + b.Volume()
+	vl.Overweight = vl.Vehicle.Payload > 0 && vl.Weight > vl.Vehicle.Payload
+}
+
+type LoadPlan struct {
+	PackinglistID int
+	Vehicles      []VehicleLoad
+	Unassigned    []Box
+}
+
+// PlanLoad distributes the boxes of the packinglist over the given vehicles using first fit decreasing.
+// Boxes that do not fit by volume into any vehicle are left unassigned. Boxes that only fail
+// the payload limit are put into the vehicle with the most payload left and the vehicle is flagged overweight.
+// A payload of 0 is unknown and does not limit the load.
+func (p *Packinglist) PlanLoad(ctx context.Context, vv []Vehicle) (LoadPlan, error) {
+	var lp LoadPlan
+	err := p.GetDetails(ctx)
+	if err != nil {
+		return lp, err
+	}
+	lp.PackinglistID = p.PackinglistID
+	for _, v := range vv {
+		lp.Vehicles = append(lp.Vehicles, VehicleLoad{Vehicle: v})
+	}
+	bb := make([]Box, len(p.Boxes))
+	copy(bb, p.Boxes)
+	sort.SliceStable(bb, func(i, j int) bool {
+		if bb[i].Weight != bb[j].Weight {
+			return bb[i].Weight > bb[j].Weight
+		}
+		return bb[i].Volume() > bb[j].Volume()
+	})
+	for _, b := range bb {
+		placed := false
+		for i := range lp.Vehicles {
+			vl := &lp.Vehicles[i]
+			if vl.hasRoomFor(b) && vl.hasPayloadFor(b) {
+				vl.add(b)
+				placed = true
+				break
+			}
+		}
+		if placed {
+			continue
+		}
+		best := -1
+		for i := range lp.Vehicles {
+			vl := &lp.Vehicles[i]
+			if !vl.hasRoomFor(b) {
+				continue
+			}
+			if best < 0 || vl.Vehicle.Payload-vl.Weight > lp.Vehicles[best].Vehicle.Payload-lp.Vehicles[best].Weight {
+				best = i
+			}
+		}
+		if best < 0 {
+			lp.Unassigned = append(lp.Unassigned, b)
+			continue
+		}
+		lp.Vehicles[best].add(b)
+	}
+	return lp, nil
+}
@@ -0,0 +1,101 @@
+package db100
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Versioned counts the changes of a row. Every update raises the version, an update of a row
+// read at an older version is refused with a VersionConflict. A version of 0 updates the row
+// whatever its version is.
+type Versioned struct {
+	Version int `gorm:"not null;default:1"`
+}
+
+// VersionConflict is returned when a row was changed since the version the update is based on.
+type VersionConflict struct {
+	Entity  string
+	ID      int
+	Version int
+}
+
+func (v *VersionConflict) Error() string {
+	return v.Entity + " " + strconv.Itoa(v.ID) + " was changed since version " + strconv.Itoa(v.Version)
+}
+
+// Is matches ErrConflict.
+func (v *VersionConflict) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// registerVersioning raises the version of every versioned row that is updated by its primary
+// key. The version is raised in the transaction of the update, so of two updates based on the
+// same version only the first one succeeds. Bulk updates by a condition raise it themselves.
+func registerVersioning(d *gorm.DB) {
+	d.Callback().Update().Before("gorm:update").Register("funkloch:version", raiseVersion)
+}
+
+func raiseVersion(scope *gorm.Scope) {
+	field, ok := scope.FieldByName("Version")
+	if !ok || scope.HasError() || scope.PrimaryKeyZero() {
+		return
+	}
+	if _, ok := scope.Get("gorm:update_column"); ok {
+		return
+	}
+	// The version is only changed here, never by the saved values
+	scope.Search.Omit("version")
+	version := int(field.Field.Int())
+	id := scope.PrimaryKeyValue()
+	q := "update " + scope.QuotedTableName() + " set version = version + 1 where " + scope.Quote(scope.PrimaryKey()) + " = ?"
+	var res *gorm.DB
+	if version == 0 {
+		res = scope.NewDB().Exec(q, id)
+	} else {
+		res = scope.NewDB().Exec(q+" and version = ?", id, version)
+	}
+	if res.Error != nil {
+		scope.Err(res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		if version != 0 {
+			n, _ := id.(int)
+			scope.Err(&VersionConflict{Entity: scope.GetModelStruct().ModelType.Name(), ID: n, Version: version})
+		}
+		return
+	}
+	if version != 0 {
+		field.Set(version + 1)
+		return
+	}
+	err := scope.NewDB().Table(scope.TableName()).Where(scope.Quote(scope.PrimaryKey())+" = ?", id).Select("version").Row().Scan(&version)
+	if err != nil {
+		scope.Err(err)
+		return
+	}
+	field.Set(version)
+}
+
+// CheckVersion returns a VersionConflict if the row of the model with the id is no longer at
+// the version, for changes that do not update the row like deleting it.
+func CheckVersion(ctx context.Context, model interface{}, id int, version int) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		scope := d.NewScope(model)
+		var current int
+		err := d.Model(model).Where(scope.Quote(scope.PrimaryKey())+" = ?", id).Select("version").Row().Scan(&current)
+		if err == sql.ErrNoRows {
+			return gorm.ErrRecordNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if version != 0 && current != version {
+			return &VersionConflict{Entity: scope.GetModelStruct().ModelType.Name(), ID: id, Version: version}
+		}
+		return nil
+	})
+}
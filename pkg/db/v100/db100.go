@@ -1,9 +1,8 @@
 package db100
 
 import (
-	"errors"
+	"context"
 	"log"
-	"strconv"
 	"time"
 
 	"github.com/Chaosvermittlung/funkloch-server/internal/global"
@@ -16,25 +15,67 @@ var db *gorm.DB
 func Initialisation(dbc *global.DBConnection) {
 	var err error
 	cont := checkDBExists(dbc)
-	db, err = gorm.Open(dbc.Driver, dbc.Connection)
+	db, err = Open(dbc)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = initSearch(dbc.Driver)
 	if err != nil {
 		log.Fatal(err)
 	}
-	db.AutoMigrate(&User{})
-	db.AutoMigrate(&Store{})
-	db.AutoMigrate(&Equipment{})
-	db.AutoMigrate(&Box{})
-	db.AutoMigrate(&Item{})
-	db.AutoMigrate(&Event{})
-	db.AutoMigrate(&Packinglist{})
-	db.AutoMigrate(&Participant{})
-	db.AutoMigrate(&Wishlist{})
-	db.AutoMigrate(&Fault{})
 	if !cont {
 		initDB()
 	}
 }
 
+// Open opens the database and migrates its tables, without making it the database of the
+// package functions. The search index is only kept on the database opened by Initialisation.
+func Open(dbc *global.DBConnection) (*gorm.DB, error) {
+	d, err := gorm.Open(dbc.Driver, dbc.Connection)
+	if err != nil {
+		return nil, err
+	}
+	registerVersioning(d)
+	registerValidation(d)
+	d.AutoMigrate(&User{})
+	d.AutoMigrate(&Store{})
+	d.AutoMigrate(&Category{})
+	d.AutoMigrate(&Equipment{})
+	d.AutoMigrate(&Box{})
+	d.AutoMigrate(&Item{})
+	d.AutoMigrate(&Event{})
+	d.AutoMigrate(&Packinglist{})
+	d.AutoMigrate(&Participant{})
+	d.AutoMigrate(&Wishlist{})
+	d.AutoMigrate(&Fault{})
+	d.AutoMigrate(&FaultComment{})
+	d.AutoMigrate(&FaultPart{})
+	d.AutoMigrate(&Vehicle{})
+	d.AutoMigrate(&Transfer{})
+	d.AutoMigrate(&TransferBox{})
+	d.AutoMigrate(&TransferItem{})
+	d.AutoMigrate(&TransferScan{})
+	d.AutoMigrate(&Location{})
+	d.AutoMigrate(&Audit{})
+	d.AutoMigrate(&AuditEntry{})
+	d.AutoMigrate(&AuditScan{})
+	d.AutoMigrate(&AuditCorrection{})
+	d.AutoMigrate(&Attribute{})
+	d.AutoMigrate(&AttributeValue{})
+	d.AutoMigrate(&Attachment{})
+	d.AutoMigrate(&Stock{})
+	d.AutoMigrate(&Consumption{})
+	d.AutoMigrate(&InspectionType{})
+	d.AutoMigrate(&Inspection{})
+	d.AutoMigrate(&InspectionValue{})
+	// checkSerial gives the error message, the index keeps concurrent writes from duplicating a serial
+	err = d.Exec("create unique index if not exists idx_items_serial on items(equipment_id, serial) where serial <> '' and deleted_at is null").Error
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
 func checkDBExists(dbc *global.DBConnection) bool {
 	var cont bool
 	switch dbc.Driver {
@@ -70,7 +111,7 @@ func initDB() {
 		log.Println(err)
 	}
 	u.Password = pw
-	err = u.Insert()
+	err = u.Insert(context.Background())
 	if err != nil {
 		log.Println(err)
 	}
@@ -92,74 +133,82 @@ type User struct {
 	Salt     string    `json:"-" gorm:"not null"`
 	Email    string    `json:"email" gorm:"not null"`
 	Right    UserRight `json:"userright" gorm:"not null"`
+	Versioned
+	SoftDelete
 }
 
-func copyifnotempty(str1, str2 string) string {
-	if str2 != "" {
-		return str2
-	} else {
-		return str1
-	}
-}
-
-func DoesUserExist(username string) (bool, error) {
+func DoesUserExist(ctx context.Context, username string) (bool, error) {
 	var u User
-	err := db.Where("Username = ?", username).First(&u)
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("Username = ?", username).First(&u).Error
+	})
 	b := (u.UserID > 0)
-	if gorm.IsRecordNotFoundError(err.Error) {
+	if gorm.IsRecordNotFoundError(err) {
 		return false, nil
 	} else {
-		return b, err.Error
+		return b, err
 	}
 }
 
-func GetUsers() ([]User, error) {
+var userListFields = listFields{
+	"user_id":  {"user_id", fieldInt},
+	"username": {"username", fieldString},
+	"email":    {"email", fieldString},
+	"right":    {`"right"`, fieldInt},
+}
+
+func GetUsersPage(ctx context.Context, lq ListQuery) ([]User, ListPage, error) {
 	var u []User
-	err := db.Find(&u)
-	return u, err.Error
+	p, err := getPage(ctx, db.Model(&User{}), &u, lq, userListFields, "user_id asc")
+	return u, p, err
 }
 
-func (u *User) GetDetailstoUsername() error {
-	err := db.Where("Username = ?", u.Username).First(&u)
-	return err.Error
+func (u *User) GetDetailstoUsername(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("Username = ?", u.Username).First(&u).Error
+	})
 }
 
-func (u *User) GetDetails() error {
-	err := db.First(&u, u.UserID)
-	return err.Error
+func (u *User) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&u, u.UserID).Error
+	})
 }
 
-func (u *User) Patch(ou User) error {
-	u.Username = copyifnotempty(u.Username, ou.Username)
-	if ou.Password != "" {
-		p, err := global.GeneratePasswordHash(ou.Password, u.Salt)
+// Patch takes over the fields of the patched user pu. A changed password is hashed with the
+// salt of the user, the id and salt can not be changed.
+func (u *User) Patch(pu User) error {
+	if pu.Password != u.Password {
+		p, err := global.GeneratePasswordHash(pu.Password, u.Salt)
 		if err != nil {
 			return err
 		}
-		u.Password = p
-	}
-	u.Email = copyifnotempty(u.Email, ou.Email)
-	if ou.Right != 0 {
-		u.Right = ou.Right
+		pu.Password = p
 	}
+	pu.UserID = u.UserID
+	pu.Salt = u.Salt
+	*u = pu
 	return nil
 }
 
-func (u *User) Update() error {
-	err := db.Save(&u)
-	return err.Error
+func (u *User) Update(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Save(&u).Error
+	})
 }
 
-func (u *User) Insert() error {
-	err := db.Create(&u)
-	return err.Error
+func (u *User) Insert(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Create(&u).Error
+	})
 }
 
-func DeleteUser(id int) error {
+func DeleteUser(ctx context.Context, id int) error {
 	var u User
 	u.UserID = id
-	err := db.Delete(&u)
-	return err.Error
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Delete(&u).Error
+	})
 }
 
 type Store struct {
@@ -169,80 +218,187 @@ type Store struct {
 	Manager   User   `gorm:"not null"`
 	ManagerID int    `gorm:"foreignkey:ManagerID;not null"`
 	Boxes     []Box  `gorm:"foreignkey:StoreID;association_foreignkey:StoreID"`
+	Versioned
+	SoftDelete
 }
 
-func (s *Store) Insert() error {
-	err := db.Create(&s)
-	return err.Error
+func (s *Store) Insert(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Create(&s).Error
+	})
 }
 
-func GetStores() ([]Store, error) {
+var storeListFields = listFields{
+	"store_id":   {"store_id", fieldInt},
+	"name":       {"name", fieldString},
+	"manager_id": {"manager_id", fieldInt},
+}
+
+func GetStoresPage(ctx context.Context, lq ListQuery) ([]Store, ListPage, error) {
 	var s []Store
-	err := db.Find(&s)
-	return s, err.Error
+	p, err := getPage(ctx, db.Model(&Store{}), &s, lq, storeListFields, "store_id asc")
+	return s, p, err
 }
 
-func (s *Store) GetDetails() error {
-	err := db.First(&s, s.StoreID)
-	return err.Error
+func (s *Store) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&s, s.StoreID).Error
+	})
 }
 
-func (s *Store) GetManager() (User, error) {
+func (s *Store) GetManager(ctx context.Context) (User, error) {
 	var u User
-	err := db.Model(&s).Related(&u)
-	return u, err.Error
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Model(&s).Related(&u).Error
+	})
+	return u, err
+}
+
+func (s *Store) Update(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Save(&s).Error
+	})
 }
 
-func (s *Store) Update() error {
-	err := db.Save(&s)
-	return err.Error
+// Delete moves the store to the trash. Stores that still have boxes can only be deleted
+// with DeleteCascade or DeleteReassign.
+func (s *Store) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		var count int
+		err := d.Model(&Box{}).Where("store_id = ?", s.StoreID).Count(&count)
+		if err.Error != nil {
+			return err.Error
+		}
+		if count > 0 {
+			return &ReferenceError{Entity: "Store", Referenced: "boxes", Count: count}
+		}
+		err = d.Delete(&s)
+		return err.Error
+	})
 }
 
-func (s *Store) Delete() error {
-	err := db.Delete(&s)
-	return err.Error
+// DeleteCascade moves the store together with its boxes and their items to the trash.
+func (s *Store) DeleteCascade(ctx context.Context) error {
+	err := s.GetDetails(ctx)
+	if err != nil {
+		return err
+	}
+	at := time.Now()
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := trash(d, &Item{}, at, "box_id in (select box_id from boxes where store_id = ? and deleted_at is null)", s.StoreID)
+		if err == nil {
+			err = trash(d, &Box{}, at, "store_id = ?", s.StoreID)
+		}
+		if err == nil {
+			err = trash(d, &Store{}, at, "store_id = ?", s.StoreID)
+		}
+		return err
+	})
 }
 
-func (s *Store) GetStoreBoxes() ([]Box, error) {
-	var bo []Box
-	err := db.Model(&s).Association("Boxes").Find(&bo)
-	return bo, err.Error
+// DeleteReassign moves the boxes of the store to another store and moves the store to the trash.
+func (s *Store) DeleteReassign(ctx context.Context, storeID int) error {
+	if storeID == s.StoreID {
+		return constraintError("Boxes can not be reassigned to the deleted store")
+	}
+	ns := Store{StoreID: storeID}
+	err := ns.GetDetails(ctx)
+	if err != nil {
+		return err
+	}
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.Model(&Box{}).Where("store_id = ?", s.StoreID).Updates(map[string]interface{}{"store_id": storeID, "location_id": 0, "version": gorm.Expr("version + 1")})
+		if err.Error == nil {
+			err = d.Delete(&s)
+		}
+		return err.Error
+	})
 }
 
-func (s *Store) AddStoreBox(b Box) error {
-	err := db.Model(&s).Association("Boxes").Append(&b)
-	return err.Error
+// GetStoreBoxes returns the boxes in the store. Boxes on a shipped transfer are in transit and not listed.
+func (s *Store) GetStoreBoxes(ctx context.Context) ([]Box, error) {
+	var bo []Box
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("store_id = ?", s.StoreID).
+			Where("box_id not in ("+boxesInTransit+")", TransferStatusShipped).
+			Find(&bo).Error
+	})
+	return bo, err
 }
 
 type Equipment struct {
 	EquipmentID int    `gorm:"primary_key;AUTO_INCREMENT;not null"`
 	Name        string `gorm:"not null"`
+	CategoryID  int    `gorm:"not null;default:0"`
+	// Years over which items of this equipment are depreciated, 0 keeps the purchase price
+	DepreciationYears int `gorm:"not null;default:0"`
+	// Consumables are counted in stock quantities instead of coded items
+	Consumable   bool `gorm:"not null;default:false"`
+	ReorderLevel int  `gorm:"not null;default:0"`
+	Versioned
+	SoftDelete
 }
 
-func (e *Equipment) Insert() error {
-	err := db.Create(&e)
-	return err.Error
+func (e *Equipment) Insert(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Create(&e).Error
+	})
 }
 
-func GetEquipment() ([]Equipment, error) {
+var equipmentListFields = listFields{
+	"equipment_id": {"equipment_id", fieldInt},
+	"name":         {"name", fieldString},
+	"category_id":  {"category_id", fieldInt},
+	"consumable":   {"consumable", fieldBool},
+}
+
+// GetEquipmentPage returns a page of the equipment. A categoryID other than 0 limits the list to
+// the equipment of the category and its subcategories.
+func GetEquipmentPage(ctx context.Context, categoryID int, lq ListQuery) ([]Equipment, ListPage, error) {
 	var e []Equipment
-	err := db.Find(&e)
-	return e, err.Error
+	q := db.Model(&Equipment{})
+	if categoryID != 0 {
+		c := Category{CategoryID: categoryID}
+		ids, err := c.GetSubtreeIDs(ctx)
+		if err != nil {
+			return e, ListPage{}, err
+		}
+		q = q.Where("category_id in (?)", ids)
+	}
+	p, err := getPage(ctx, q, &e, lq, equipmentListFields, "equipment_id asc")
+	return e, p, err
 }
 
-func (e *Equipment) GetDetails() error {
-	err := db.First(&e, e.EquipmentID)
-	return err.Error
+func (e *Equipment) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&e, e.EquipmentID).Error
+	})
 }
 
-func (e *Equipment) Update() error {
-	err := db.Save(&e)
-	return err.Error
+func (e *Equipment) Update(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.Save(&e)
+		if err.Error != nil {
+			return err.Error
+		}
+		return syncProcurementWishlist(d)
+	})
 }
 
-func (e *Equipment) Delete() error {
-	err := db.Delete(&e)
-	return err.Error
+// Delete moves the equipment to the trash. Equipment that still has items can not be deleted.
+func (e *Equipment) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		var count int
+		err := d.Model(&Item{}).Where("equipment_id = ?", e.EquipmentID).Count(&count)
+		if err.Error != nil {
+			return err.Error
+		}
+		if count > 0 {
+			return &ReferenceError{Entity: "Equipment", Referenced: "items", Count: count}
+		}
+		err = d.Delete(&e)
+		return err.Error
+	})
 }
 
 type Box struct {
@@ -252,13 +408,24 @@ type Box struct {
 	Code        int    `gorm:"type:integer(13)"`
 	Description string `gorm:"not null"`
 	Weight      int    `gorm:"not null;default:0"`
+	Length      int    `gorm:"not null;default:0"`
+	Width       int    `gorm:"not null;default:0"`
+	Height      int    `gorm:"not null;default:0"`
+	LocationID  int    `gorm:"not null;default:0"`
+	Versioned
+	SoftDelete
 }
 
 type BoxlistEntry struct {
 	BoxID       int
+	Version     int
 	Code        int
 	Description string
 	Weight      int
+	Length      int
+	Width       int
+	Height      int
+	LocationID  int
 	StoreID     int
 	Name        string
 	Adress      string
@@ -268,111 +435,88 @@ type BoxlistEntry struct {
 	Right       int
 }
 
-func (b *Box) Insert() error {
-	err := db.Create(&b)
-	tmp, err2 := strconv.Atoi(global.CreateBoxCode(b.BoxID))
-	if err2 != nil {
-		return err2
-	}
-	b.Code = tmp
-	err = db.Save(&b)
-	return err.Error
+func (b *Box) Insert(ctx context.Context) error {
+	return TransactionContext(ctx, func(u *UnitOfWork) error {
+		return u.InsertBox(b)
+	})
 }
 
-func (b *Box) Update() error {
-	err := db.Save(&b)
-	return err.Error
+func (b *Box) Update(ctx context.Context) error {
+	return TransactionContext(ctx, func(u *UnitOfWork) error {
+		return u.UpdateBox(b)
+	})
 }
 
-func GetBoxes() ([]Box, error) {
-	var b []Box
-	err := db.Find(&b)
-	return b, err.Error
+func (b *Box) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&b, b.BoxID).Error
+	})
 }
 
-func (b *Box) GetDetails() error {
-	err := db.First(&b, b.BoxID)
-	return err.Error
+func (b *Box) GetDetailstoCode(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("code = ?", b.Code).First(&b).Error
+	})
 }
 
-func (b *Box) GetFullDetails() (BoxlistEntry, error) {
-	var ble BoxlistEntry
-	err := db.Table("Boxes").
-		Select("Boxes.box_id, Boxes.code, Boxes.description, Boxes.Weight, Stores.store_id, Stores.name, Stores.adress, Stores.manager_id, Users.Username, Users.Email, Users.Right").
+// boxesJoined selects the boxes with their store and its manager in one query.
+// Boxes in the trash are left out.
+func boxesJoined(d *gorm.DB) *gorm.DB {
+	return d.Table("Boxes").
+		Select("Boxes.box_id, Boxes.version, Boxes.code, Boxes.description, Boxes.Weight, Boxes.length, Boxes.width, Boxes.height, Boxes.location_id, Stores.store_id, Stores.name, Stores.adress, Stores.manager_id, Users.Username, Users.Email, Users.Right").
 		Joins("left join Stores on Boxes.Store_Id = Stores.Store_Id").
 		Joins("left join Users on Stores.Manager_id = Users.User_id").
-		Where("Boxes.box_id = ?", b.BoxID).
-		Find(&ble)
-	return ble, err.Error
+		Where("Boxes.deleted_at is null")
 }
 
-func (b *Box) Delete() error {
-	err := db.Delete(b)
-	return err.Error
+func (b *Box) Volume() int {
+	return b.Length * b.Width * b.Height
 }
 
-func (b *Box) AddBoxItem(item Item) error {
-	err := db.Model(&b).Association("Items").Append(&item)
-	return err.Error
+// Delete moves the box to the trash. Boxes that still contain items can not be deleted.
+func (b *Box) Delete(ctx context.Context) error {
+	return TransactionContext(ctx, func(u *UnitOfWork) error {
+		return u.DeleteBox(b)
+	})
 }
 
-func (b *Box) GetBoxItems() ([]Item, error) {
-	var ii []Item
-	err := db.Model(&b).Association("Items").Find(&ii)
-	return ii, err.Error
+var boxListFields = listFields{
+	"box_id":      {"Boxes.box_id", fieldInt},
+	"code":        {"Boxes.code", fieldInt},
+	"description": {"Boxes.description", fieldString},
+	"weight":      {"Boxes.weight", fieldInt},
+	"store_id":    {"Boxes.store_id", fieldInt},
+	"location_id": {"Boxes.location_id", fieldInt},
 }
 
-func GetBoxesJoined() ([]BoxlistEntry, error) {
-	var ble []BoxlistEntry
-	err := db.Table("Boxes").
-		Select("Boxes.box_id, Boxes.code, Boxes.description, Boxes.Weight, Stores.store_id, Stores.name, Stores.adress, Stores.manager_id, Users.Username, Users.Email, Users.Right").
-		Joins("left join Stores on Boxes.Store_Id = Stores.Store_Id").
-		Joins("left join Users on Stores.Manager_id = Users.User_id").
-		Scan(&ble)
-	return ble, err.Error
+func GetBoxesJoinedPage(ctx context.Context, lq ListQuery) ([]BoxlistEntry, ListPage, error) {
+	return getBoxesJoinedPage(ctx, db, lq)
 }
 
-func (b *Box) GetBoxItemsJoined() ([]ItemslistEntry, error) {
-	/*var ile []ItemslistEntry
-	err := db.Table("Items").
-		Select("Items.item_id, Items.code as ItemCode, Boxes.box_id, Boxes.code as BoxCode, Boxes.description as BoxDescription, Stores.store_id, Stores.name as Storename, Stores.adress as StoreAddress, Stores.manager_id as StoreManagerID, Equipment.equipment_id, Equipment.name as EquipmentName ").
-		Joins("left join Boxes on Items.box_id = Boxes.box_id").
-		Joins("left join Stores on Boxes.Store_Id = Stores.Store_Id").
-		Joins("left join equipment on Items.equipment_id = equipment.equipment_id").
-		Where("Items.Box_id = ?", b.BoxID).
-		Scan(&ile)*/
-	var ii []Item
-	var ile []ItemslistEntry
-	err := db.Table("Items").
-		Select("Items.item_id").
-		Where("Items.Box_id = ?", b.BoxID).
-		Scan(&ii)
-	if err.Error != nil {
-		return ile, err.Error
-	}
-	for _, i := range ii {
-		iile, err := i.GetFullDetails()
-		if err != nil {
-			return ile, err
-		}
-		ile = append(ile, iile)
-	}
-	return ile, err.Error
-
+func getBoxesJoinedPage(ctx context.Context, d *gorm.DB, lq ListQuery) ([]BoxlistEntry, ListPage, error) {
+	var ble []BoxlistEntry
+	q := boxesJoined(d)
+	p, err := getPage(ctx, q, &ble, lq, boxListFields, "Boxes.box_id asc")
+	return ble, p, err
 }
 
 type Item struct {
-	ItemID      int `gorm:"primary_key;AUTO_INCREMENT;not null"`
-	BoxID       int
-	EquipmentID int       `gorm:"not null"`
+	ItemID      int       `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	BoxID       int       `gorm:"index"`
+	EquipmentID int       `gorm:"not null;index"`
 	Equipment   Equipment `gorm:"not null"`
 	Code        int       `gorm:"type:integer(13)"`
 	Description string
 	Faults      []Fault `gorm:"foreignkey:ItemID;association_foreignkey:ItemID"`
+	ItemAsset
+	ItemRetirement
+	Versioned
+	SoftDelete
 }
 
 type ItemslistEntry struct {
 	ItemID          int
+	ItemVersion     int
 	ItemCode        int
 	ItemDescription string
 	BoxID           int
@@ -385,139 +529,119 @@ type ItemslistEntry struct {
 	StoreManagerID  int
 	EquipmentID     int
 	EquipmentName   string
+	ItemAsset
 }
 
-func (i *Item) Insert() error {
-	//Don't check this error, it breaks the code
-	err := db.Create(&i)
-	tmp, err2 := strconv.Atoi(global.CreateItemCode(i.ItemID))
-	if err2 != nil {
-		return err2
-	}
-	i.Code = tmp
-	err = db.Save(&i)
-	return err.Error
-}
-
-func (i *Item) GetDetails() error {
-	err := db.First(&i, i.ItemID)
-	return err.Error
-}
-
-func (i *Item) GetFullDetails() (ItemslistEntry, error) {
-	var ile ItemslistEntry
-	/*err := db.Table("Items").
-	Select("Items.item_id, Items.code, Boxes.box_id, Boxes.code, Boxes.description, Stores.store_id, Stores.name, Stores.adress, Stores.manager_id, Equipment.equipment_id, Equipment.name").
-	Joins("left join Boxes on Items.box_id = Boxes.box_id").
-	Joins("left join Stores on Boxes.Store_Id = Stores.Store_Id").
-	Joins("left join equipment on Items.equipment_id = equipment.equipment_id").
-	Where("Items.item_id = ?", i.ItemID).
-	Find(&ile)*/
-	err := i.GetDetails()
-	if err != nil {
-		return ile, err
-	}
-	var ble BoxlistEntry
-	if i.BoxID != 0 {
-		b := Box{BoxID: i.BoxID}
-		ble, err = b.GetFullDetails()
-		if err != nil {
-			return ile, err
-		}
-	}
-	e := Equipment{EquipmentID: i.EquipmentID}
-	err = e.GetDetails()
-	if err != nil {
-		return ile, err
-	}
-	ile.ItemID = i.ItemID
-	ile.ItemCode = i.Code
-	ile.ItemDescription = i.Description
-	ile.BoxID = ble.BoxID
-	ile.BoxCode = ble.Code
-	ile.BoxDescription = ble.Description
-	ile.BoxWeight = ble.Weight
-	ile.StoreID = ble.StoreID
-	ile.StoreAddress = ble.Adress
-	ile.StoreManagerID = ble.ManagerID
-	ile.StoreName = ble.Name
-	ile.EquipmentID = e.EquipmentID
-	ile.EquipmentName = e.Name
-	return ile, err
-}
-
-func (i *Item) Update() error {
-	tmp, err2 := strconv.Atoi(global.CreateItemCode(i.ItemID))
-	if err2 != nil {
-		return err2
-	}
-	i.Code = tmp
-	err := db.Save(&i)
-	return err.Error
+func (i *Item) Insert(ctx context.Context) error {
+	return TransactionContext(ctx, func(u *UnitOfWork) error {
+		return u.InsertItem(i)
+	})
 }
 
-func (i *Item) Delete() error {
-	err := db.Delete(&i)
-	return err.Error
+func (i *Item) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&i, i.ItemID).Error
+	})
 }
 
-func GetItems(storeless bool) ([]Item, error) {
-	var ii []Item
-	var err error
+func (i *Item) GetDetailstoCode(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("code = ?", i.Code).First(&i).Error
+	})
+}
+
+// itemsJoined selects the items with their box, store and equipment in one query.
+func itemsJoined(d *gorm.DB) *gorm.DB {
+	return d.Table("items").
+		Select("items.item_id, items.version as item_version, items.code as item_code, items.description as item_description, " +
+			"boxes.box_id, boxes.code as box_code, boxes.description as box_description, boxes.weight as box_weight, " +
+			"stores.store_id, stores.name as store_name, stores.adress as store_address, stores.manager_id as store_manager_id, " +
+			"equipment.equipment_id, equipment.name as equipment_name, " +
+			"items.serial, items.manufacturer, items.supplier, items.purchase_date, items.purchase_price").
+		Joins("left join boxes on items.box_id = boxes.box_id").
+		Joins("left join stores on boxes.store_id = stores.store_id").
+		Joins("left join equipment on items.equipment_id = equipment.equipment_id").
+		Where("items.deleted_at is null")
+}
+
+// Update saves the item. The retirement can only be changed with Retire and Reinstate.
+func (i *Item) Update(ctx context.Context) error {
+	return TransactionContext(ctx, func(u *UnitOfWork) error {
+		return u.UpdateItem(i)
+	})
+}
+
+// Delete moves the item to the trash. Its faults, inspections and attribute values are kept
+// until the item is purged.
+func (i *Item) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Delete(&i).Error
+	})
+}
+
+func getItemsJoined(d *gorm.DB, storeless bool) ([]ItemslistEntry, error) {
+	var ile []ItemslistEntry
+	q := itemsJoined(d).Where("items.retirement = ?", RetirementNone)
 	if storeless {
-		err2 := db.Where("Box_ID = 0").Find(&ii)
-		err = err2.Error
-	} else {
-		err2 := db.Find(&ii)
-		err = err2.Error
+		q = q.Where("items.box_id = 0")
 	}
-	return ii, err
+	err := q.Order("items.item_id asc").Scan(&ile)
+	return ile, err.Error
+}
+
+var itemListFields = listFields{
+	"item_id":        {"items.item_id", fieldInt},
+	"code":           {"items.code", fieldInt},
+	"description":    {"items.description", fieldString},
+	"box_id":         {"items.box_id", fieldInt},
+	"store_id":       {"boxes.store_id", fieldInt},
+	"equipment_id":   {"items.equipment_id", fieldInt},
+	"serial":         {"items.serial", fieldString},
+	"manufacturer":   {"items.manufacturer", fieldString},
+	"supplier":       {"items.supplier", fieldString},
+	"purchase_date":  {"items.purchase_date", fieldDate},
+	"purchase_price": {"items.purchase_price", fieldInt},
 }
 
-func GetItemsJoined(storeless bool) ([]ItemslistEntry, error) {
+// GetItemsJoinedPage returns a page of the active items matching the attribute filters.
+func GetItemsJoinedPage(ctx context.Context, storeless bool, ff []AttributeFilter, lq ListQuery) ([]ItemslistEntry, ListPage, error) {
+	return getItemsJoinedPage(ctx, db, storeless, ff, lq)
+}
+
+func getItemsJoinedPage(ctx context.Context, d *gorm.DB, storeless bool, ff []AttributeFilter, lq ListQuery) ([]ItemslistEntry, ListPage, error) {
 	var ile []ItemslistEntry
-	/*err := db.Table("Items").
-	Select("Items.item_id, Items.code, Boxes.box_id, Boxes.code, Boxes.description, Stores.store_id, Stores.name, Stores.adress, Stores.manager_id, Equipment.equipment_id, Equipment.name").
-	Joins("left join Boxes on Items.box_id = Boxes.box_id").
-	Joins("left join Stores on Boxes.Store_Id = Stores.Store_Id").
-	Joins("left join equipment on Items.equipment_id = equipment.equipment_id").
-	Select(&ile)*/
-	ii, err := GetItems(storeless)
-	if err != nil {
-		return ile, err
+	q := itemsNotInTransit(itemsJoined(d).Where("items.retirement = ?", RetirementNone))
+	if storeless {
+		q = q.Where("items.box_id = 0")
 	}
-	for _, i := range ii {
-		iile, err := i.GetFullDetails()
+	if len(ff) > 0 {
+		ids, err := getItemsMatchingAttributes(d, ff)
 		if err != nil {
-			return ile, err
+			return ile, ListPage{}, err
 		}
-		ile = append(ile, iile)
+		q = q.Where("items.item_id in (?)", ids)
 	}
-	return ile, err
+	p, err := getPage(ctx, q, &ile, lq, itemListFields, "items.item_id asc")
+	return ile, p, err
 }
 
-func (i *Item) GetFaults() ([]Fault, error) {
+func (i *Item) GetFaults(ctx context.Context) ([]Fault, error) {
 	var result []Fault
-	err := db.Where("item_id = ?", i.ItemID).Find(&result)
-	return result, err.Error
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("item_id = ?", i.ItemID).Find(&result).Error
+	})
+	return result, err
 }
 
-func (i *Item) AddFault(f Fault) (Fault, error) {
-	err := f.Insert()
+func (i *Item) AddFault(ctx context.Context, f Fault) (Fault, error) {
+	err := f.Insert(ctx)
 	return f, err
 }
 
-func (i *Item) SetBox(id int) error {
-	err := i.GetDetails()
-	if err != nil {
-		return errors.New("Error getting Item Details:" + err.Error())
-	}
-	i.BoxID = id
-	err = i.Update()
-	if err != nil {
-		return errors.New("Error updating Item Details:" + err.Error())
-	}
-	return nil
+func (i *Item) SetBox(ctx context.Context, id int) error {
+	return TransactionContext(ctx, func(u *UnitOfWork) error {
+		return u.SetItemBox(i, id)
+	})
 }
 
 type Event struct {
@@ -527,50 +651,76 @@ type Event struct {
 	End          time.Time     `gorm:"not null"`
 	Adress       string        `gorm:"not null"`
 	Participants []Participant `gorm:"foreignkey:EventID;association_foreignkey:EventID"`
+	Versioned
+	SoftDelete
 }
 
-func (e *Event) Insert() error {
-	err := db.Create(&e)
-	return err.Error
+func (e *Event) Insert(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Create(&e).Error
+	})
 }
 
-func (e *Event) GetDetails() error {
-	err := db.First(&e, e.EventID)
-	return err.Error
+func (e *Event) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&e, e.EventID).Error
+	})
 }
 
-func (e *Event) Update() error {
-	err := db.Save(&e)
-	return err.Error
+func (e *Event) Update(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Save(&e).Error
+	})
 }
 
-func (e *Event) Delete() error {
-	err := db.Delete(&e)
-	return err.Error
+// Delete moves the event together with its packinglists to the trash.
+func (e *Event) Delete(ctx context.Context) error {
+	at := time.Now()
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := trash(d, &Packinglist{}, at, "event_id = ?", e.EventID)
+		if err == nil {
+			err = trash(d, &Event{}, at, "event_id = ?", e.EventID)
+		}
+		return err
+	})
 }
 
-func (e *Event) GetParticipants() ([]Participant, error) {
+func (e *Event) GetParticipants(ctx context.Context) ([]Participant, error) {
 	var pp []Participant
-	err := db.Model(&e).Related(&pp)
-	return pp, err.Error
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Model(&e).Related(&pp).Error
+	})
+	return pp, err
 }
 
-func (e *Event) GetPackinglists() ([]Packinglist, error) {
+func (e *Event) GetPackinglists(ctx context.Context) ([]Packinglist, error) {
 	var pp []Packinglist
-	err := db.Model(&e).Related(&pp)
-	return pp, err.Error
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Model(&e).Related(&pp).Error
+	})
+	return pp, err
+}
+
+var eventListFields = listFields{
+	"event_id": {"event_id", fieldInt},
+	"name":     {"name", fieldString},
+	"start":    {"start", fieldDate},
+	"end":      {`"end"`, fieldDate},
+	"adress":   {"adress", fieldString},
 }
 
-func GetEvents() ([]Event, error) {
+func GetEventsPage(ctx context.Context, lq ListQuery) ([]Event, ListPage, error) {
 	var e []Event
-	err := db.Find(&e)
-	return e, err.Error
+	p, err := getPage(ctx, db.Model(&Event{}), &e, lq, eventListFields, "event_id asc")
+	return e, p, err
 }
 
-func GetNextEvent() (Event, error) {
+func GetNextEvent(ctx context.Context) (Event, error) {
 	var e Event
-	err := db.Where("start > ?", time.Now()).Order("start asc").First(&e)
-	return e, err.Error
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("start > ?", time.Now()).Order("start asc").First(&e).Error
+	})
+	return e, err
 }
 
 type Packinglist struct {
@@ -580,116 +730,156 @@ type Packinglist struct {
 	Event         Event  `gorm:"not null"`
 	Boxes         []Box  `gorm:"many2many:packinglist_boxes;"`
 	Weight        int    `gorm:"not null;default:0"`
+	Versioned
+	SoftDelete
 }
 
-func (p *Packinglist) Insert() error {
-	err := db.Create(&p)
-	return err.Error
+func (p *Packinglist) Insert(ctx context.Context) error {
+	return TransactionContext(ctx, func(u *UnitOfWork) error {
+		return u.InsertPackinglist(p)
+	})
 }
 
-func GetPackinglists() ([]Packinglist, error) {
+func GetPackinglists(ctx context.Context) ([]Packinglist, error) {
 	var p []Packinglist
 	var res []Packinglist
-	err := db.Find(&p)
-	if err.Error != nil {
-		return p, err.Error
-	}
-	for _, pp := range p {
-		err := db.Model(&pp).Related(&pp.Event)
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.Find(&p)
 		if err.Error != nil {
-			return p, err.Error
+			return err.Error
 		}
-		res = append(res, pp)
+		for _, pp := range p {
+			err := d.Model(&pp).Related(&pp.Event)
+			if err.Error != nil {
+				return err.Error
+			}
+			res = append(res, pp)
+		}
+		return nil
+	})
+	if err != nil {
+		return p, err
 	}
 	return res, nil
 }
 
-func (p *Packinglist) GetDetails() error {
-	err := db.First(&p, p.PackinglistID)
-	if err.Error != nil {
-		return err.Error
+var packinglistListFields = listFields{
+	"packinglist_id": {"packinglist_id", fieldInt},
+	"name":           {"name", fieldString},
+	"event_id":       {"event_id", fieldInt},
+	"weight":         {"weight", fieldInt},
+}
+
+func GetPackinglistsPage(ctx context.Context, lq ListQuery) ([]Packinglist, ListPage, error) {
+	var pp []Packinglist
+	p, err := getPage(ctx, db.Model(&Packinglist{}), &pp, lq, packinglistListFields, "packinglist_id asc")
+	if err != nil {
+		return pp, p, err
 	}
-	err = db.Model(&p).Related(&p.Event)
-	if err.Error != nil {
+	err = inContext(ctx, db, func(d *gorm.DB) error {
+		for i := range pp {
+			err := d.Model(&pp[i]).Related(&pp[i].Event)
+			if err.Error != nil {
+				return err.Error
+			}
+		}
+		return nil
+	})
+	return pp, p, err
+}
+
+func (p *Packinglist) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.First(&p, p.PackinglistID)
+		if err.Error != nil {
+			return err.Error
+		}
+		err = d.Model(&p).Related(&p.Event)
+		if err.Error != nil {
+			return err.Error
+		}
+		err = d.Model(&p).Related(&p.Boxes, "Boxes")
 		return err.Error
-	}
-	err = db.Model(&p).Related(&p.Boxes, "Boxes")
-	return err.Error
+	})
 }
 
-func (p *Packinglist) Update() error {
-	err := db.Save(&p)
-	return err.Error
+// Update saves the packinglist without its event and boxes, the boxes are changed with
+// AddPackinglistBox and RemovePackinglistBox.
+func (p *Packinglist) Update(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Set("gorm:save_associations", false).Save(&p).Error
+	})
 }
 
-func (p *Packinglist) AddPackinglistBox(b Box) error {
-	err := db.Model(&p).Association("Boxes").Append(&b)
-	if err.Error != nil {
-		return err.Error
-	}
-	return p.updateWeight()
+func (p *Packinglist) AddPackinglistBox(ctx context.Context, b Box) error {
+	return TransactionContext(ctx, func(u *UnitOfWork) error {
+		return u.AddPackinglistBox(p, b)
+	})
 }
 
-func (p *Packinglist) GetPackinglistBoxes() ([]Box, error) {
+func (p *Packinglist) GetPackinglistBoxes(ctx context.Context) ([]Box, error) {
 	var res []Box
-	err := db.Model(&p).Association("Boxes").Find(&res)
-	if err.Error != nil {
-		return res, err.Error
-	}
-	var res2 []Box
-	for _, b := range res {
-		var err2 error
-		ile, err2 := b.GetBoxItemsJoined()
-		if err2 != nil {
-			return res, err2
+	var ii []Item
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		err := d.Model(&p).Association("Boxes").Find(&res)
+		if err.Error != nil {
+			return err.Error
+		}
+		if len(res) == 0 {
+			return nil
 		}
-		for _, ii := range ile {
-			var i Item
-			i.Code = ii.ItemCode
-			i.ItemID = ii.ItemID
-			i.Equipment.EquipmentID = ii.EquipmentID
-			i.Equipment.Name = ii.EquipmentName
-			b.Items = append(b.Items, i)
+		var ids []int
+		for _, b := range res {
+			ids = append(ids, b.BoxID)
 		}
-		res2 = append(res2, b)
+		var ile []ItemslistEntry
+		err2 := itemsNotInTransit(itemsJoined(d).Where("items.box_id in (?)", ids)).Order("items.item_id asc").Scan(&ile)
+		if err2.Error != nil {
+			return err2.Error
+		}
+		for _, e := range ile {
+			i := Item{ItemID: e.ItemID, BoxID: e.BoxID, Code: e.ItemCode, EquipmentID: e.EquipmentID}
+			i.Equipment.EquipmentID = e.EquipmentID
+			i.Equipment.Name = e.EquipmentName
+			ii = append(ii, i)
+		}
+		return loadOpenFaults(d, ii)
+	})
+	if err != nil || len(res) == 0 {
+		return res, err
 	}
-	return res2, nil
-}
-
-func (p *Packinglist) updateWeight() error {
-	err := p.GetDetails()
-	if err != nil {
-		return err
+	items := make(map[int][]Item)
+	for _, i := range ii {
+		items[i.BoxID] = append(items[i.BoxID], i)
 	}
-	p.Weight = 0
-	for _, b := range p.Boxes {
-		p.Weight = p.Weight + b.Weight
+	for n := range res {
+		res[n].Items = items[res[n].BoxID]
 	}
-	err = p.Update()
-	return err
+	return res, nil
 }
 
-func (p *Packinglist) RemovePackinglistBox(b Box) error {
-	err := db.Model(&p).Association("Boxes").Delete(&b)
-	if err.Error != nil {
-		return err.Error
-	}
-	return p.updateWeight()
+func (p *Packinglist) RemovePackinglistBox(ctx context.Context, b Box) error {
+	return TransactionContext(ctx, func(u *UnitOfWork) error {
+		return u.RemovePackinglistBox(p, b)
+	})
 }
 
-func (p *Packinglist) Delete() error {
-	err := db.Delete(&p)
-	return err.Error
+func (p *Packinglist) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Delete(&p).Error
+	})
 }
 
-func (p *Packinglist) FindSuitableBoxes() ([]Box, error) {
+func (p *Packinglist) FindSuitableBoxes(ctx context.Context) ([]Box, error) {
 	var res []Box
-	err := p.GetDetails()
+	err := p.GetDetails(ctx)
 	if err != nil {
 		return res, err
 	}
-	err2 := db.Raw("Select * From Boxes Where Box_Id not in(Select Box_ID from Boxes, Events, Packinglists, Packinglist_boxes Where Boxes.box_id = Packinglist_boxes.box_box_id and Packinglist_boxes.packinglist_packinglist_id = packinglists.packinglist_id and packinglists.event_id = ?)", p.EventID).Scan(&res)
-	return res, err2.Error
+	err = inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Raw("Select * From Boxes Where deleted_at is null and Box_Id not in(Select Box_ID from Boxes, Events, Packinglists, Packinglist_boxes Where Boxes.box_id = Packinglist_boxes.box_box_id and Packinglist_boxes.packinglist_packinglist_id = packinglists.packinglist_id and packinglists.event_id = ?) and Box_Id not in ("+boxesInTransit+")", p.EventID, TransferStatusShipped).Scan(&res).Error
+	})
+	return res, err
 }
 
 type Participant struct {
@@ -700,67 +890,120 @@ type Participant struct {
 	Departure time.Time `gorm:"not null"`
 }
 
-func (p *Participant) Insert() error {
-	err := db.Create(&p)
-	return err.Error
+func (p *Participant) Insert(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Create(&p).Error
+	})
 }
 
-func (p *Participant) Update() error {
-	err := db.Save(&p)
-	return err.Error
+func (p *Participant) Update(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Save(&p).Error
+	})
 }
 
-func (p *Participant) Delete() error {
-	err := db.Delete(&p)
-	return err.Error
+func (p *Participant) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Delete(&p).Error
+	})
 }
 
-func (p *Participant) GetDetails() error {
-	err := db.Where("User_ID = ? and Event_ID = ?", p.UserID, p.EventID).First(&p)
-	return err.Error
+func (p *Participant) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Where("User_ID = ? and Event_ID = ?", p.UserID, p.EventID).First(&p).Error
+	})
 }
 
 type Wishlist struct {
 	WishlistID int         `gorm:"primary_key;AUTO_INCREMENT;not null"`
 	Name       string      `gorm:"not null"`
 	Items      []Equipment `gorm:"many2many:wishlist_equipment;"`
+	Categories []Category  `gorm:"many2many:wishlist_category;"`
+	// Procurement marks the wishlist that low stock consumables are added to
+	Procurement bool `gorm:"not null;default:false"`
+	Versioned
+	SoftDelete
+}
+
+func (w *Wishlist) Insert(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Create(&w).Error
+	})
 }
 
-func (w *Wishlist) Insert() error {
-	err := db.Create(&w)
-	return err.Error
+var wishlistListFields = listFields{
+	"wishlist_id": {"wishlist_id", fieldInt},
+	"name":        {"name", fieldString},
+	"procurement": {"procurement", fieldBool},
 }
 
-func GetWishlists() ([]Wishlist, error) {
+func GetWishlistsPage(ctx context.Context, lq ListQuery) ([]Wishlist, ListPage, error) {
 	var ww []Wishlist
-	err := db.Find(&ww)
-	return ww, err.Error
+	p, err := getPage(ctx, db.Model(&Wishlist{}), &ww, lq, wishlistListFields, "wishlist_id asc")
+	return ww, p, err
 }
 
-func (w *Wishlist) Update() error {
-	err := db.Save(&w)
-	return err.Error
+func (w *Wishlist) Update(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Save(&w).Error
+	})
 }
 
-func (w *Wishlist) Delete() error {
-	err := db.Delete(&w)
-	return err.Error
+func (w *Wishlist) Delete(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Delete(&w).Error
+	})
 }
 
-func (w *Wishlist) GetDetails() error {
-	err := db.First(&w, w.WishlistID)
-	return err.Error
+func (w *Wishlist) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&w, w.WishlistID).Error
+	})
 }
 
-func (w *Wishlist) AddWishlistItem(e Equipment) error {
-	err := db.Model(&w).Association("Items").Append(&e)
-	return err.Error
+func (w *Wishlist) AddWishlistItem(ctx context.Context, e Equipment) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Model(&w).Association("Items").Append(&e).Error
+	})
 }
 
-func (w *Wishlist) GetWishlistItems() ([]Equipment, error) {
+func (w *Wishlist) GetWishlistItems(ctx context.Context) ([]Equipment, error) {
 	var res []Equipment
-	err := db.Model(&w).Association("Items").Find(&res)
-	return res, err.Error
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Model(&w).Association("Items").Find(&res).Error
+	})
+	return res, err
+}
+
+func (w *Wishlist) RemoveWishlistItem(ctx context.Context, e Equipment) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Model(&w).Association("Items").Delete(&e).Error
+	})
+}
+
+// AddWishlistCategory adds the category to the wishlist. Categories that do not exist are not found.
+func (w *Wishlist) AddWishlistCategory(ctx context.Context, c Category) error {
+	err := c.GetDetails(ctx)
+	if err != nil {
+		return err
+	}
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Model(&w).Association("Categories").Append(&c).Error
+	})
+}
+
+func (w *Wishlist) GetWishlistCategories(ctx context.Context) ([]Category, error) {
+	var res []Category
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Model(&w).Association("Categories").Find(&res).Error
+	})
+	return res, err
+}
+
+func (w *Wishlist) RemoveWishlistCategory(ctx context.Context, c Category) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Model(&w).Association("Categories").Delete(&c).Error
+	})
 }
 
 type FaultStatus int
@@ -773,34 +1016,68 @@ const (
 )
 
 type Fault struct {
-	FaultID int         `gorm:"primary_key;AUTO_INCREMENT;not null"`
-	ItemID  int         `gorm:"not null"`
-	Status  FaultStatus `gorm:"not null"`
-	Comment string      `gorm:"not null"`
+	FaultID    int         `gorm:"primary_key;AUTO_INCREMENT;not null"`
+	ItemID     int         `gorm:"not null;index"`
+	Status     FaultStatus `gorm:"not null"`
+	Comment    string      `gorm:"not null"`
+	AssigneeID int         `gorm:"not null;default:0"`
+	Created    time.Time
+	Updated    time.Time
+	FaultRepair
+	Versioned
 }
 
-func (f *Fault) Insert() error {
-	err := db.Create(&f)
-	return err.Error
+func (f *Fault) Insert(ctx context.Context) error {
+	return f.InsertBy(ctx, 0)
 }
 
-func GetFaults() ([]Fault, error) {
+func GetFaults(ctx context.Context) ([]Fault, error) {
 	var f []Fault
-	err := db.Find(&f)
-	return f, err.Error
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		return d.Find(&f).Error
+	})
+	return f, err
 }
 
-func (f *Fault) Update() error {
-	err := db.Save(&f)
-	return err.Error
+func (f *Fault) Update(ctx context.Context) error {
+	return f.UpdateBy(ctx, 0, "")
 }
 
-func (f *Fault) Delete() error {
-	err := db.Delete(&f)
-	return err.Error
+// Delete removes the fault with its comments, parts and attachments.
+func (f *Fault) Delete(ctx context.Context) error {
+	var keys []string
+	err := inContext(ctx, db, func(d *gorm.DB) error {
+		var err error
+		keys, err = f.delete(d)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	removeAttachmentFiles(keys)
+	return nil
+}
+
+// delete removes the fault and returns the storage keys of the files of its attachments.
+func (f *Fault) delete(d *gorm.DB) ([]string, error) {
+	err := d.Where("fault_id = ?", f.FaultID).Delete(FaultComment{})
+	if err.Error != nil {
+		return nil, err.Error
+	}
+	err = d.Where("fault_id = ?", f.FaultID).Delete(FaultPart{})
+	if err.Error != nil {
+		return nil, err.Error
+	}
+	keys, err2 := deleteAttachments(d, AttachmentOwnerFault, []int{f.FaultID})
+	if err2 != nil {
+		return nil, err2
+	}
+	err = d.Delete(&f)
+	return keys, err.Error
 }
 
-func (f *Fault) GetDetails() error {
-	err := db.First(&f, f.FaultID)
-	return err.Error
+func (f *Fault) GetDetails(ctx context.Context) error {
+	return inContext(ctx, db, func(d *gorm.DB) error {
+		return d.First(&f, f.FaultID).Error
+	})
 }
@@ -1,14 +1,19 @@
 package db100
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"time"
 
 	"github.com/Chaosvermittlung/funkloch-server/internal/global"
+	"github.com/Chaosvermittlung/funkloch-server/internal/storage"
 )
 
 func TestMain(m *testing.M) {
@@ -43,7 +48,7 @@ func TestUserInsert(t *testing.T) {
 	}
 	u.Password = pw
 
-	err = u.Insert()
+	err = u.Insert(context.Background())
 
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
@@ -55,7 +60,7 @@ func TestUserInsert(t *testing.T) {
 }
 
 func TestDoesUserExist(t *testing.T) {
-	cont, err := DoesUserExist("foobar")
+	cont, err := DoesUserExist(context.Background(), "foobar")
 
 	if err != nil {
 		t.Fatalf("No error expected but got %v", err)
@@ -65,7 +70,7 @@ func TestDoesUserExist(t *testing.T) {
 		t.Errorf("Expected false got %v", cont)
 	}
 
-	cont, err = DoesUserExist("test")
+	cont, err = DoesUserExist(context.Background(), "test")
 
 	if err != nil {
 		t.Fatalf("No error expected but got %v", err)
@@ -77,7 +82,7 @@ func TestDoesUserExist(t *testing.T) {
 }
 
 func TestGetUsers(t *testing.T) {
-	uu, err := GetUsers()
+	uu, _, err := GetUsersPage(context.Background(), ListQuery{})
 	if err != nil {
 		t.Fatalf("No error expected but got %v", err)
 	}
@@ -88,7 +93,7 @@ func TestGetUsers(t *testing.T) {
 
 func TestGetDetailstoUsername(t *testing.T) {
 	u := User{Username: "test"}
-	err := u.GetDetailstoUsername()
+	err := u.GetDetailstoUsername(context.Background())
 	if err != nil {
 		t.Fatalf("No error expected but got %v", err)
 	}
@@ -99,7 +104,7 @@ func TestGetDetailstoUsername(t *testing.T) {
 
 func TestGetUserDetails(t *testing.T) {
 	u := User{UserID: 2}
-	err := u.GetDetails()
+	err := u.GetDetails(context.Background())
 	if err != nil {
 		t.Fatalf("No error expected but got %v", err)
 	}
@@ -130,11 +135,11 @@ func TestPatchUser(t *testing.T) {
 func TestUpdateUser(t *testing.T) {
 	u := User{UserID: 2, Username: "test1", Password: "test", Email: "test@otherhost", Right: USERRIGHT_ADMIN}
 	un := User{UserID: 2}
-	err := u.Update()
+	err := u.Update(context.Background())
 	if err != nil {
 		t.Fatalf("No error expected but got %v", err)
 	}
-	err = un.GetDetails()
+	err = un.GetDetails(context.Background())
 	if err != nil {
 		t.Fatalf("No error expected but got %v", err)
 	}
@@ -147,11 +152,11 @@ func TestUpdateUser(t *testing.T) {
 }
 
 func TestDeleteUser(t *testing.T) {
-	err := DeleteUser(2)
+	err := DeleteUser(context.Background(), 2)
 	if err != nil {
 		t.Fatalf("No error expected but got %v", err)
 	}
-	uu, err := GetUsers()
+	uu, _, err := GetUsersPage(context.Background(), ListQuery{})
 	if err != nil {
 		t.Fatalf("No error expected but got %v", err)
 	}
@@ -163,12 +168,12 @@ func TestDeleteUser(t *testing.T) {
 func TestStoreInsert(t *testing.T) {
 	var m User
 	m.UserID = 1
-	err := m.GetDetails()
+	err := m.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 	s := Store{Name: "foobar", Adress: "test", Manager: m, ManagerID: 1}
-	err = s.Insert()
+	err = s.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -179,7 +184,7 @@ func TestStoreInsert(t *testing.T) {
 }
 
 func TestGetStores(t *testing.T) {
-	ss, err := GetStores()
+	ss, _, err := GetStoresPage(context.Background(), ListQuery{})
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -190,7 +195,7 @@ func TestGetStores(t *testing.T) {
 
 func TestStoreGetDetails(t *testing.T) {
 	s := Store{StoreID: 1}
-	err := s.GetDetails()
+	err := s.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -208,11 +213,11 @@ func TestStoreGetDetails(t *testing.T) {
 func TestStoreUpdate(t *testing.T) {
 	s := Store{StoreID: 1, Name: "foobar2", Adress: "test2", ManagerID: 1}
 	sn := Store{StoreID: 1}
-	err := s.Update()
+	err := s.Update(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = sn.GetDetails()
+	err = sn.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -229,11 +234,11 @@ func TestStoreUpdate(t *testing.T) {
 
 func TestStoreGetManager(t *testing.T) {
 	s := Store{StoreID: 1}
-	err := s.GetDetails()
+	err := s.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	m, err := s.GetManager()
+	m, err := s.GetManager(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -244,7 +249,7 @@ func TestStoreGetManager(t *testing.T) {
 
 func TestStoreDelete(t *testing.T) {
 	s := Store{StoreID: 1}
-	err := s.Delete()
+	err := s.Delete(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -252,7 +257,7 @@ func TestStoreDelete(t *testing.T) {
 
 func TestEquipmentInsert(t *testing.T) {
 	e := Equipment{Name: "FF54"}
-	err := e.Insert()
+	err := e.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -263,7 +268,7 @@ func TestEquipmentInsert(t *testing.T) {
 
 func TestEquipmentGetDetails(t *testing.T) {
 	e := Equipment{EquipmentID: 1}
-	err := e.GetDetails()
+	err := e.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -273,7 +278,7 @@ func TestEquipmentGetDetails(t *testing.T) {
 }
 
 func TestGetEquipment(t *testing.T) {
-	res, err := GetEquipment()
+	res, _, err := GetEquipmentPage(context.Background(), 0, ListQuery{})
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -285,11 +290,11 @@ func TestGetEquipment(t *testing.T) {
 func TestEquipmentUpdate(t *testing.T) {
 	e := Equipment{EquipmentID: 1, Name: "FF33"}
 	en := Equipment{EquipmentID: 1}
-	err := e.Update()
+	err := e.Update(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = en.GetDetails()
+	err = en.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -300,7 +305,7 @@ func TestEquipmentUpdate(t *testing.T) {
 
 func TestEquipmentDelete(t *testing.T) {
 	e := Equipment{EquipmentID: 1}
-	err := e.Delete()
+	err := e.Delete(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -308,12 +313,12 @@ func TestEquipmentDelete(t *testing.T) {
 
 func TestBoxInsert(t *testing.T) {
 	s := Store{Name: "foobar", Adress: "test", ManagerID: 1}
-	err := s.Insert()
+	err := s.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 	b := Box{StoreID: s.StoreID, Description: "TestBox", Weight: 5}
-	err = b.Insert()
+	err = b.Insert(context.Background())
 	if b.BoxID != 1 {
 		t.Errorf("Expected BoxID = 1 but got %v", b.BoxID)
 	}
@@ -329,7 +334,7 @@ func TestBoxInsert(t *testing.T) {
 }
 
 func TestGetBoxes(t *testing.T) {
-	bb, err := GetBoxes()
+	bb, _, err := GetBoxesJoinedPage(context.Background(), ListQuery{})
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -340,7 +345,7 @@ func TestGetBoxes(t *testing.T) {
 
 func TestBoxGetDetails(t *testing.T) {
 	b := Box{BoxID: 1}
-	err := b.GetDetails()
+	err := b.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -361,11 +366,11 @@ func TestBoxGetDetails(t *testing.T) {
 func TestBoxUpdate(t *testing.T) {
 	b := Box{BoxID: 1, StoreID: 2, Description: "TestBox2", Weight: 10}
 	bn := Box{BoxID: 1}
-	err := b.Update()
+	err := b.Update(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = bn.GetDetails()
+	err = bn.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -377,18 +382,19 @@ func TestBoxUpdate(t *testing.T) {
 	}
 }
 
-func TestStoreAddStoreBox(t *testing.T) {
+func TestBoxChangeStore(t *testing.T) {
 	b := Box{BoxID: 1}
-	err := b.GetDetails()
+	err := b.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no #1 error but got %v", err)
 	}
 	s := Store{StoreID: 2}
-	err = s.GetDetails()
+	err = s.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no #2 error but got %v", err)
 	}
-	err = s.AddStoreBox(b)
+	b.StoreID = s.StoreID
+	err = DefaultRepositories().Boxes.Update(context.Background(), &b)
 	if err != nil {
 		t.Errorf("Expected no #3 error but got %v", err)
 	}
@@ -396,11 +402,11 @@ func TestStoreAddStoreBox(t *testing.T) {
 
 func TestStoreGetStoreBoxes(t *testing.T) {
 	s := Store{StoreID: 2}
-	err := s.GetDetails()
+	err := s.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	bb, err := s.GetStoreBoxes()
+	bb, err := s.GetStoreBoxes(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -411,7 +417,7 @@ func TestStoreGetStoreBoxes(t *testing.T) {
 
 func TestBoxDelete(t *testing.T) {
 	b := Box{BoxID: 1}
-	err := b.Delete()
+	err := b.Delete(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -420,21 +426,21 @@ func TestBoxDelete(t *testing.T) {
 func TestItemInsert(t *testing.T) {
 	e := Equipment{Name: "FF54"}
 	s := Store{Name: "foobar", Adress: "test", ManagerID: 1}
-	err := e.Insert()
+	err := e.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = s.Insert()
+	err = s.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 	b := Box{StoreID: s.StoreID, Description: "TestBox"}
-	err = b.Insert()
+	err = b.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 	si := Item{BoxID: b.BoxID, EquipmentID: e.EquipmentID, Description: "Foobar"}
-	err = si.Insert()
+	err = si.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -448,7 +454,7 @@ func TestItemInsert(t *testing.T) {
 
 func TestItemGetDetails(t *testing.T) {
 	si := Item{ItemID: 1}
-	err := si.GetDetails()
+	err := si.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -467,17 +473,14 @@ func TestItemGetDetails(t *testing.T) {
 }
 
 func TestBoxAddBoxItem(t *testing.T) {
-	b := Box{BoxID: 2}
-	si := Item{ItemID: 1}
-	err := b.AddBoxItem(si)
+	err := DefaultRepositories().Items.SetBox(context.Background(), 1, 2)
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 }
 
 func TestBoxGetBoxItems(t *testing.T) {
-	b := Box{BoxID: 2}
-	res, err := b.GetBoxItems()
+	res, err := DefaultRepositories().Boxes.Items(context.Background(), 2)
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -489,21 +492,21 @@ func TestBoxGetBoxItems(t *testing.T) {
 func TestItemUpdate(t *testing.T) {
 	e := Equipment{Name: "FF54"}
 	b := Box{StoreID: 2, Description: "TestBox2"}
-	err := b.Insert()
+	err := b.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = e.Insert()
+	err = e.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 	si := Item{ItemID: 1, BoxID: b.BoxID, EquipmentID: e.EquipmentID}
 	sin := Item{ItemID: 1}
-	err = si.Update()
+	err = si.Update(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = sin.GetDetails()
+	err = sin.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -516,7 +519,7 @@ func TestItemUpdate(t *testing.T) {
 }
 
 func TestGetItems(t *testing.T) {
-	ii, err := GetItems(false)
+	ii, _, err := GetItemsJoinedPage(context.Background(), false, nil, ListQuery{})
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -524,7 +527,7 @@ func TestGetItems(t *testing.T) {
 		t.Errorf("Expected len > 1 got %v", len(ii))
 	}
 
-	ii, err = GetItems(true)
+	ii, _, err = GetItemsJoinedPage(context.Background(), true, nil, ListQuery{})
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -536,7 +539,7 @@ func TestGetItems(t *testing.T) {
 func TestItemAddFault(t *testing.T) {
 	si := Item{ItemID: 1}
 	f := Fault{ItemID: si.ItemID, Status: FaultStatusNew, Comment: "Alles kaputt"}
-	f, err := si.AddFault(f)
+	f, err := si.AddFault(context.Background(), f)
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -547,7 +550,7 @@ func TestItemAddFault(t *testing.T) {
 
 func TestItemGetFaults(t *testing.T) {
 	si := Item{ItemID: 1}
-	ff, err := si.GetFaults()
+	ff, err := si.GetFaults(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -557,7 +560,7 @@ func TestItemGetFaults(t *testing.T) {
 }
 
 func TestGetFaults(t *testing.T) {
-	ff, err := GetFaults()
+	ff, err := GetFaults(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -568,7 +571,7 @@ func TestGetFaults(t *testing.T) {
 
 func TestGetFaultDetails(t *testing.T) {
 	f := Fault{FaultID: 1}
-	err := f.GetDetails()
+	err := f.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -583,11 +586,11 @@ func TestGetFaultDetails(t *testing.T) {
 func TestUpdateFault(t *testing.T) {
 	f := Fault{FaultID: 1, Status: FaultStatusFixed, Comment: "Nix mehr kaputt"}
 	fn := Fault{FaultID: 1}
-	err := f.Update()
+	err := f.Update(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = fn.GetDetails()
+	err = fn.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -601,7 +604,7 @@ func TestUpdateFault(t *testing.T) {
 
 func TestDeleteFault(t *testing.T) {
 	f := Fault{FaultID: 1}
-	err := f.Delete()
+	err := f.Delete(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -609,7 +612,7 @@ func TestDeleteFault(t *testing.T) {
 
 func TestItemDelete(t *testing.T) {
 	si := Item{ItemID: 1}
-	err := si.Delete()
+	err := si.Delete(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -617,7 +620,7 @@ func TestItemDelete(t *testing.T) {
 
 func TestEventInsert(t *testing.T) {
 	e := Event{Name: "CCS", Adress: "Chiemsee", Start: time.Now().Add(time.Hour * 24), End: time.Now().Add(time.Hour * 24 * 3)}
-	err := e.Insert()
+	err := e.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -628,7 +631,7 @@ func TestEventInsert(t *testing.T) {
 
 func TestEventGetDetails(t *testing.T) {
 	e := Event{EventID: 1}
-	err := e.GetDetails()
+	err := e.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -643,11 +646,11 @@ func TestEventGetDetails(t *testing.T) {
 func TestEventUpdate(t *testing.T) {
 	e := Event{EventID: 1, Name: "CSS", Adress: "Würmsee", Start: time.Now().Add(time.Hour * 24), End: time.Now().Add(time.Hour * 24 * 3)}
 	en := Event{EventID: 1}
-	err := e.Update()
+	err := e.Update(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = en.GetDetails()
+	err = en.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -666,7 +669,7 @@ func TestEventUpdate(t *testing.T) {
 }
 
 func TestGetEvents(t *testing.T) {
-	ee, err := GetEvents()
+	ee, _, err := GetEventsPage(context.Background(), ListQuery{})
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -676,7 +679,7 @@ func TestGetEvents(t *testing.T) {
 }
 
 func TestGetNextEvent(t *testing.T) {
-	e, err := GetNextEvent()
+	e, err := GetNextEvent(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -686,8 +689,8 @@ func TestGetNextEvent(t *testing.T) {
 }
 
 func TestParticipantInsert(t *testing.T) {
-	p := Participant{UserID: 1, EventID: 1, Arrival: time.Now().Add(25 * time.Hour), Departure: time.Now().Add(23 * time.Hour)}
-	err := p.Insert()
+	p := Participant{UserID: 1, EventID: 1, Arrival: time.Now().Add(23 * time.Hour), Departure: time.Now().Add(25 * time.Hour)}
+	err := p.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -695,7 +698,7 @@ func TestParticipantInsert(t *testing.T) {
 
 func TestEventGetParticipants(t *testing.T) {
 	e := Event{EventID: 1}
-	pp, err := e.GetParticipants()
+	pp, err := e.GetParticipants(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -709,20 +712,20 @@ func TestEventGetParticipants(t *testing.T) {
 
 func TestParticipantGetDetails(t *testing.T) {
 	p := Participant{UserID: 1, EventID: 1}
-	err := p.GetDetails()
+	err := p.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 }
 
 func TestParticipantUpdate(t *testing.T) {
-	p := Participant{UserID: 1, EventID: 1, Arrival: time.Now().Add(25 * time.Hour), Departure: time.Now().Add(23 * time.Hour)}
+	p := Participant{UserID: 1, EventID: 1, Arrival: time.Now().Add(21 * time.Hour), Departure: time.Now().Add(27 * time.Hour)}
 	pn := Participant{UserID: 1, EventID: 1}
-	err := p.Update()
+	err := p.Update(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = pn.GetDetails()
+	err = pn.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -736,7 +739,7 @@ func TestParticipantUpdate(t *testing.T) {
 
 func TestParticipantDelete(t *testing.T) {
 	p := Participant{UserID: 1, EventID: 1}
-	err := p.Delete()
+	err := p.Delete(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -744,7 +747,18 @@ func TestParticipantDelete(t *testing.T) {
 
 func TestEventDelete(t *testing.T) {
 	e := Event{EventID: 1}
-	err := e.Delete()
+	err := e.Delete(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	tt, _, err := GetTrashPage(context.Background(), ListQuery{Filters: map[string][]string{"kind": {"event"}}})
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if len(tt) != 1 || tt[0].ID != 1 {
+		t.Errorf("Expected Event 1 in the trash but got %v", tt)
+	}
+	_, err = PurgeTrash(context.Background(), time.Now().Add(time.Second))
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -752,12 +766,12 @@ func TestEventDelete(t *testing.T) {
 
 func TestPackinglistInsert(t *testing.T) {
 	e := Event{EventID: 1, Name: "CSS", Adress: "Würmsee", Start: time.Now().Add(time.Hour * 24), End: time.Now().Add(time.Hour * 24 * 3)}
-	err := e.Insert()
+	err := e.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 	pl := Packinglist{Name: "Galaxy", EventID: 1}
-	err = pl.Insert()
+	err = pl.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -767,7 +781,7 @@ func TestPackinglistInsert(t *testing.T) {
 }
 
 func TestGetPackingLists(t *testing.T) {
-	pp, err := GetPackinglists()
+	pp, err := GetPackinglists(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -778,7 +792,7 @@ func TestGetPackingLists(t *testing.T) {
 
 func TestEventGetPackinglists(t *testing.T) {
 	e := Event{EventID: 1}
-	pp, err := e.GetPackinglists()
+	pp, err := e.GetPackinglists(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -789,7 +803,7 @@ func TestEventGetPackinglists(t *testing.T) {
 
 func TestPackingListGetDetails(t *testing.T) {
 	p := Packinglist{PackinglistID: 1}
-	err := p.GetDetails()
+	err := p.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -801,11 +815,11 @@ func TestPackingListGetDetails(t *testing.T) {
 func TestPackingListUpdate(t *testing.T) {
 	p := Packinglist{PackinglistID: 1, Name: "Focus", EventID: 1}
 	pn := Packinglist{PackinglistID: 1}
-	err := p.Update()
+	err := p.Update(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = pn.GetDetails()
+	err = pn.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -816,30 +830,30 @@ func TestPackingListUpdate(t *testing.T) {
 
 func TestPackinglistAddBox(t *testing.T) {
 	e := Equipment{Name: "FF54"}
-	err := e.Insert()
+	err := e.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 	s := Store{Name: "Kitchen", Adress: "Straße", ManagerID: 1}
-	err = s.Insert()
+	err = s.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 	b := Box{StoreID: s.StoreID, Description: "TestBox2", Weight: 5}
-	err = b.Insert()
+	err = b.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 	p := Packinglist{PackinglistID: 1}
-	err = p.GetDetails()
+	err = p.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = p.AddPackinglistBox(b)
+	err = p.AddPackinglistBox(context.Background(), b)
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = p.GetDetails()
+	err = p.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -853,7 +867,7 @@ func TestPackinglistAddBox(t *testing.T) {
 
 func TestPackinglistGetPackinglistBoxes(t *testing.T) {
 	p := Packinglist{PackinglistID: 1}
-	sis, err := p.GetPackinglistBoxes()
+	sis, err := p.GetPackinglistBoxes(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -864,16 +878,16 @@ func TestPackinglistGetPackinglistBoxes(t *testing.T) {
 
 func TestPackinglistRemovePackinglistBox(t *testing.T) {
 	b := Box{BoxID: 4}
-	err := b.GetDetails()
+	err := b.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 	p := Packinglist{PackinglistID: 1}
-	err = p.RemovePackinglistBox(b)
+	err = p.RemovePackinglistBox(context.Background(), b)
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = p.GetDetails()
+	err = p.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -887,7 +901,7 @@ func TestPackinglistRemovePackinglistBox(t *testing.T) {
 
 func TestPackingListDelete(t *testing.T) {
 	p := Packinglist{PackinglistID: 1}
-	err := p.Delete()
+	err := p.Delete(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -895,7 +909,7 @@ func TestPackingListDelete(t *testing.T) {
 
 func TestWishlistInsert(t *testing.T) {
 	w := Wishlist{Name: "test"}
-	err := w.Insert()
+	err := w.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -905,7 +919,7 @@ func TestWishlistInsert(t *testing.T) {
 }
 
 func TestGetWishlists(t *testing.T) {
-	ww, err := GetWishlists()
+	ww, _, err := GetWishlistsPage(context.Background(), ListQuery{})
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -916,7 +930,7 @@ func TestGetWishlists(t *testing.T) {
 
 func TestWishlistGetDetails(t *testing.T) {
 	w := Wishlist{WishlistID: 1}
-	err := w.GetDetails()
+	err := w.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -928,11 +942,11 @@ func TestWishlistGetDetails(t *testing.T) {
 func TestWishlistUpdate(t *testing.T) {
 	w := Wishlist{WishlistID: 1, Name: "test2"}
 	wn := Wishlist{WishlistID: 1}
-	err := w.Update()
+	err := w.Update(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
-	err = wn.GetDetails()
+	err = wn.GetDetails(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -944,7 +958,7 @@ func TestWishlistUpdate(t *testing.T) {
 func TestWishlistAddWishlistItems(t *testing.T) {
 	w := Wishlist{WishlistID: 1}
 	e := Equipment{EquipmentID: 4}
-	err := w.AddWishlistItem(e)
+	err := w.AddWishlistItem(context.Background(), e)
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -952,7 +966,7 @@ func TestWishlistAddWishlistItems(t *testing.T) {
 
 func TestWishlistGetWishlistItems(t *testing.T) {
 	w := Wishlist{WishlistID: 1}
-	ee, err := w.GetWishlistItems()
+	ee, err := w.GetWishlistItems(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
@@ -963,8 +977,2184 @@ func TestWishlistGetWishlistItems(t *testing.T) {
 
 func TestWishlistDelete(t *testing.T) {
 	wl := Wishlist{WishlistID: 1}
-	err := wl.Delete()
+	err := wl.Delete(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestVehicleInsert(t *testing.T) {
+	v := Vehicle{Name: "Sprinter", Plate: "M-CV 42", Payload: 20, CargoLength: 300, CargoWidth: 170, CargoHeight: 180}
+	err := v.Insert(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if v.VehicleID != 1 {
+		t.Errorf("Expected VehicleID = 1 but got %v", v.VehicleID)
+	}
+}
+
+func TestGetVehicles(t *testing.T) {
+	vv, err := GetVehicles(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if len(vv) != 1 {
+		t.Errorf("Expected len = 1 but got %v", len(vv))
+	}
+}
+
+func TestVehicleUpdate(t *testing.T) {
+	v := Vehicle{VehicleID: 1, Name: "Crafter", Plate: "M-CV 42", Payload: 20, CargoLength: 300, CargoWidth: 170, CargoHeight: 180}
+	vn := Vehicle{VehicleID: 1}
+	err := v.Update(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	err = vn.GetDetails(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if v.Name != vn.Name {
+		t.Error("Name missmatch:", v.Name, vn.Name)
+	}
+}
+
+func TestVehicleFits(t *testing.T) {
+	v := Vehicle{CargoLength: 300, CargoWidth: 170, CargoHeight: 180}
+	if !v.Fits(Box{Length: 60, Width: 200, Height: 40}) {
+		t.Error("Expected rotated box to fit")
+	}
+	if v.Fits(Box{Length: 310, Width: 40, Height: 40}) {
+		t.Error("Expected overlong box not to fit")
+	}
+	if !v.Fits(Box{}) {
+		t.Error("Expected box without dimensions to fit")
+	}
+}
+
+func TestPackinglistPlanLoad(t *testing.T) {
+	e := Event{Name: "Camp", Adress: "Zehdenick", Start: time.Now().Add(time.Hour * 24), End: time.Now().Add(time.Hour * 24 * 5)}
+	err := e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	p := Packinglist{Name: "Camp", EventID: e.EventID}
+	err = p.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	boxes := []Box{
+		{StoreID: 2, Description: "Rack", Weight: 15, Length: 80, Width: 60, Height: 100},
+		{StoreID: 2, Description: "DECT", Weight: 8, Length: 60, Width: 40, Height: 40},
+		{StoreID: 2, Description: "Cable", Weight: 10, Length: 60, Width: 40, Height: 40},
+		{StoreID: 2, Description: "Mast", Weight: 5, Length: 400, Width: 20, Height: 20},
+	}
+	for _, b := range boxes {
+		err = b.Insert(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		err = p.AddPackinglistBox(context.Background(), b)
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+	vv := []Vehicle{
+		{VehicleID: 1, Name: "Crafter", Payload: 20, CargoLength: 300, CargoWidth: 170, CargoHeight: 180},
+		{VehicleID: 2, Name: "Caddy", Payload: 10, CargoLength: 150, CargoWidth: 110, CargoHeight: 110},
+	}
+	lp, err := p.PlanLoad(context.Background(), vv)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(lp.Unassigned) != 1 || lp.Unassigned[0].Description != "Mast" {
+		t.Errorf("Expected Mast to be unassigned but got %v", lp.Unassigned)
+	}
+	if len(lp.Vehicles) != 2 {
+		t.Fatalf("Expected len(Vehicles) = 2 but got %v", len(lp.Vehicles))
+	}
+	if lp.Vehicles[0].Weight+lp.Vehicles[1].Weight != 33 {
+		t.Errorf("Expected total Weight = 33 but got %v", lp.Vehicles[0].Weight+lp.Vehicles[1].Weight)
+	}
+	if !lp.Vehicles[0].Overweight && !lp.Vehicles[1].Overweight {
+		t.Error("Expected one vehicle to be overweight")
+	}
+	lp, err = p.PlanLoad(context.Background(), []Vehicle{{VehicleID: 3, Name: "Trailer", CargoLength: 300, CargoWidth: 170, CargoHeight: 180}})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(lp.Vehicles[0].Boxes) != 3 || lp.Vehicles[0].Overweight {
+		t.Errorf("Expected 3 boxes in a vehicle without payload and no overweight but got %+v", lp.Vehicles[0])
+	}
+}
+
+func TestTransferInsert(t *testing.T) {
+	s := Store{Name: "Lager Nord", Adress: "Hafen", ManagerID: 1}
+	err := s.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	tr := Transfer{FromStoreID: 2, ToStoreID: s.StoreID, Comment: "Umzug"}
+	err = tr.Insert(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if tr.TransferID != 1 {
+		t.Errorf("Expected TransferID = 1 but got %v", tr.TransferID)
+	}
+	if tr.Status != TransferStatusDraft {
+		t.Errorf("Expected Status Draft but got %v", tr.Status)
+	}
+	tr2 := Transfer{FromStoreID: 2, ToStoreID: 2}
+	err = tr2.Insert(context.Background())
+	if err == nil {
+		t.Error("Expected error for transfer into the same store")
+	}
+}
+
+func TestTransferAddLines(t *testing.T) {
+	tr := Transfer{TransferID: 1}
+	err := tr.AddTransferBox(context.Background(), Box{BoxID: 3})
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	err = tr.AddTransferBox(context.Background(), Box{BoxID: 5})
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	err = tr.AddTransferBox(context.Background(), Box{BoxID: 2})
+	if err == nil {
+		t.Error("Expected error for box from another store")
+	}
+	e := Equipment{Name: "Yagi"}
+	err = e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	i := Item{BoxID: 6, EquipmentID: e.EquipmentID}
+	err = i.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = tr.AddTransferItem(context.Background(), i, 0)
+	if !errors.Is(err, ErrConstraint) {
+		t.Errorf("Expected error for item without target box but got %v", err)
+	}
+	loose := Item{EquipmentID: e.EquipmentID}
+	err = loose.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	target := Box{StoreID: tr.ToStoreID, Description: "Eingang"}
+	err = target.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = tr.AddTransferItem(context.Background(), loose, target.BoxID)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected error for item outside the source store but got %v", err)
+	}
+	err = tr.AddTransferItem(context.Background(), i, target.BoxID)
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	err = tr.GetDetails(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if len(tr.Boxes) != 2 || len(tr.Items) != 1 {
+		t.Errorf("Expected 2 boxes and 1 item but got %v %v", len(tr.Boxes), len(tr.Items))
+	}
+}
+
+func TestTransferShip(t *testing.T) {
+	s := Store{StoreID: 2}
+	before, err := s.GetStoreBoxes(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	tr := Transfer{TransferID: 1}
+	err = tr.Ship(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if tr.Status != TransferStatusShipped {
+		t.Errorf("Expected Status Shipped but got %v", tr.Status)
+	}
+	after, err := s.GetStoreBoxes(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(before)-len(after) != 2 {
+		t.Errorf("Expected 2 boxes in transit but got %v", len(before)-len(after))
+	}
+	tt, err := GetTransfersInTransit(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(tt) != 1 {
+		t.Errorf("Expected len = 1 but got %v", len(tt))
+	}
+	err = tr.AddTransferBox(context.Background(), Box{BoxID: 7})
+	if err == nil {
+		t.Error("Expected error adding a box to a shipped transfer")
+	}
+	r := DefaultRepositories()
+	ile, err := r.Boxes.Items(context.Background(), 6)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	for _, e := range ile {
+		if e.ItemID == 2 {
+			t.Error("Expected item in transit to be left out of the box")
+		}
+	}
+	err = r.Items.SetBox(context.Background(), 2, 0)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected conflict moving an item in transit but got %v", err)
+	}
+	b := Box{BoxID: 3}
+	err = b.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	b.StoreID = 1
+	err = r.Boxes.Update(context.Background(), &b)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected conflict moving a box in transit but got %v", err)
+	}
+	tr2 := Transfer{FromStoreID: 2, ToStoreID: 1}
+	err = tr2.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = tr2.AddTransferBox(context.Background(), Box{BoxID: 3})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected conflict adding a box in transit but got %v", err)
+	}
+	err = tr2.Delete(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestTransferReceive(t *testing.T) {
+	tr := Transfer{TransferID: 1}
+	b := Box{BoxID: 3}
+	err := b.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	i := Item{ItemID: 2}
+	err = i.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	for _, c := range []int{b.Code, i.Code, 39999} {
+		_, err = tr.Scan(context.Background(), c)
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+	rep, err := tr.Receive(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(rep.ReceivedBoxes) != 1 || len(rep.MissingBoxes) != 1 {
+		t.Errorf("Expected 1 received and 1 missing box but got %v %v", len(rep.ReceivedBoxes), len(rep.MissingBoxes))
+	}
+	if len(rep.ReceivedItems) != 1 {
+		t.Errorf("Expected 1 received item but got %v", len(rep.ReceivedItems))
+	}
+	if len(rep.Unexpected) != 1 || rep.Unexpected[0] != 39999 {
+		t.Errorf("Expected unexpected code 39999 but got %v", rep.Unexpected)
+	}
+	err = b.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if b.StoreID != tr.ToStoreID {
+		t.Errorf("Expected StoreID = %v but got %v", tr.ToStoreID, b.StoreID)
+	}
+	err = i.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if i.BoxID != tr.Items[0].ToBoxID {
+		t.Errorf("Expected BoxID = %v but got %v", tr.Items[0].ToBoxID, i.BoxID)
+	}
+	ile, err := DefaultRepositories().Boxes.Items(context.Background(), i.BoxID)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(ile) != 1 || ile[0].ItemID != i.ItemID {
+		t.Errorf("Expected the received item in its target box but got %v", ile)
+	}
+	_, err = tr.Receive(context.Background())
+	if err == nil {
+		t.Error("Expected error receiving a transfer twice")
+	}
+}
+
+func TestLocationInsert(t *testing.T) {
+	room := Location{StoreID: 2, Type: LocationTypeRoom, Name: "Keller"}
+	err := room.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if room.Code != 50001 {
+		t.Errorf("Expected Code = 50001 but got %v", room.Code)
+	}
+	shelves := []string{"B", "A"}
+	for _, n := range shelves {
+		shelf := Location{StoreID: 2, Type: LocationTypeShelf, ParentID: room.LocationID, Name: n}
+		err = shelf.Insert(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+	slot := Location{StoreID: 2, Type: LocationTypeSlot, ParentID: room.LocationID, Name: "01"}
+	err = slot.Insert(context.Background())
+	if err == nil {
+		t.Error("Expected error for slot below a room")
+	}
+	slot = Location{StoreID: 3, Type: LocationTypeSlot, ParentID: 2, Name: "01"}
+	err = slot.Insert(context.Background())
+	if err == nil {
+		t.Error("Expected error for slot in another store than its shelf")
+	}
+	slot = Location{StoreID: 2, Type: LocationTypeSlot, ParentID: 2, Name: "01"}
+	err = slot.Insert(context.Background())
 	if err != nil {
 		t.Errorf("Expected no error but got %v", err)
 	}
 }
+
+func TestLocationGetPath(t *testing.T) {
+	l := Location{LocationID: 4}
+	path, err := l.GetPath(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(path) != 3 {
+		t.Fatalf("Expected len = 3 but got %v", len(path))
+	}
+	if path[0].Name != "Keller" || path[1].Name != "B" || path[2].Name != "01" {
+		t.Errorf("Expected path Keller/B/01 but got %v/%v/%v", path[0].Name, path[1].Name, path[2].Name)
+	}
+}
+
+func TestBoxPutAway(t *testing.T) {
+	b := Box{BoxID: 6}
+	err := b.PutAway(context.Background(), Location{LocationID: 4})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = b.PutAway(context.Background(), Location{LocationID: 3})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	b2 := Box{BoxID: 2}
+	err = b2.PutAway(context.Background(), Location{LocationID: 3})
+	if err == nil {
+		t.Error("Expected error putting away a box into another store")
+	}
+	bl, err := b.GetLocation(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(bl.Path) != 2 || bl.Path[1].Name != "A" {
+		t.Errorf("Expected box on shelf A but got %v", bl.Path)
+	}
+	l := Location{LocationID: 3}
+	err = l.Delete(context.Background())
+	if err == nil {
+		t.Error("Expected error deleting a location with boxes")
+	}
+	err = b2.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = l.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	l.StoreID = b2.StoreID
+	err = l.Update(context.Background())
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected conflict moving a location with boxes to another store but got %v", err)
+	}
+	b2.LocationID = 3
+	err = b2.Update(context.Background())
+	if !errors.Is(err, ErrConstraint) {
+		t.Errorf("Expected error for a location in another store but got %v", err)
+	}
+	mb := Box{StoreID: 2, Description: "Umzug"}
+	err = mb.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = mb.PutAway(context.Background(), Location{LocationID: 3})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	mb.StoreID = b2.StoreID
+	err = mb.Update(context.Background())
+	if err != nil || mb.LocationID != 0 {
+		t.Errorf("Expected box moved to another store to leave its location but got %v, %v", mb.LocationID, err)
+	}
+	err = mb.Delete(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+}
+
+func TestPackinglistGetPicklist(t *testing.T) {
+	b := Box{BoxID: 8}
+	err := b.PutAway(context.Background(), Location{LocationID: 4})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	p := Packinglist{PackinglistID: 2}
+	pl, err := p.GetPicklist(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(pl) != 4 {
+		t.Fatalf("Expected len = 4 but got %v", len(pl))
+	}
+	if pl[0].Box.BoxID != 6 || pl[1].Box.BoxID != 8 {
+		t.Errorf("Expected boxes 6 and 8 first but got %v and %v", pl[0].Box.BoxID, pl[1].Box.BoxID)
+	}
+	if len(pl[3].Path) != 0 {
+		t.Errorf("Expected box without location last but got %v", pl[3].Path)
+	}
+}
+
+func TestAuditInsert(t *testing.T) {
+	a := Audit{StoreID: 2}
+	err := a.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if a.AuditID != 1 {
+		t.Errorf("Expected AuditID = 1 but got %v", a.AuditID)
+	}
+	ee, err := a.GetEntries(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	s := Store{StoreID: 2}
+	bb, err := s.GetStoreBoxes(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(ee) < len(bb) {
+		t.Errorf("Expected at least %v entries but got %v", len(bb), len(ee))
+	}
+}
+
+func TestAuditCloseAndApply(t *testing.T) {
+	e := Equipment{Name: "Funkgerät"}
+	err := e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	lost := Item{BoxID: 7, EquipmentID: e.EquipmentID}
+	moved := Item{BoxID: 7, EquipmentID: e.EquipmentID}
+	retired := Item{BoxID: 7, EquipmentID: e.EquipmentID}
+	trashed := Item{BoxID: 7, EquipmentID: e.EquipmentID}
+	for _, i := range []*Item{&lost, &moved, &retired, &trashed} {
+		err = i.Insert(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+	a := Audit{StoreID: 2}
+	err = a.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	b7 := Box{BoxID: 7}
+	b8 := Box{BoxID: 8}
+	b2 := Box{BoxID: 2}
+	for _, b := range []*Box{&b7, &b8, &b2} {
+		err = b.GetDetails(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+	err = retired.Retire(context.Background(), ItemRetirement{Retirement: RetirementDisposed, RetiredReason: "Defekt"})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = trashed.Delete(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	scans := [][2]int{{b7.Code, 0}, {b8.Code, 0}, {moved.Code, b8.Code}, {retired.Code, b8.Code}, {b2.Code, 0}, {99999, 0}}
+	for _, s := range scans {
+		_, err = a.Scan(context.Background(), s[0], s[1])
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+	ar, err := a.Close(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(ar.MissingItems) != 1 || ar.MissingItems[0].ItemID != lost.ItemID {
+		t.Errorf("Expected item %v missing but got %v", lost.ItemID, ar.MissingItems)
+	}
+	if len(ar.UnexpectedBoxes) != 1 || ar.UnexpectedBoxes[0].BoxID != 2 {
+		t.Errorf("Expected box 2 unexpected but got %v", ar.UnexpectedBoxes)
+	}
+	if len(ar.UnknownCodes) != 1 {
+		t.Errorf("Expected 1 unknown code but got %v", ar.UnknownCodes)
+	}
+	if len(ar.TrashedItems) != 1 || ar.TrashedItems[0].ItemID != trashed.ItemID {
+		t.Errorf("Expected item %v trashed but got %v", trashed.ItemID, ar.TrashedItems)
+	}
+	for _, c := range ar.Corrections {
+		if c.ItemID == retired.ItemID {
+			t.Errorf("Expected no correction for the retired item but got %v", c)
+		}
+	}
+	_, err = a.Scan(context.Background(), b7.Code, 0)
+	if err == nil {
+		t.Error("Expected error scanning a closed audit")
+	}
+	_, err = a.Apply(context.Background(), []AuditCorrection{{Type: AuditCorrectionMoveItem, ItemID: moved.ItemID, ToBoxID: 9999}})
+	if !errors.Is(err, ErrConstraint) {
+		t.Errorf("Expected error applying a correction the audit does not suggest but got %v", err)
+	}
+	err = moved.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	v := moved.Version
+	cc, err := a.Apply(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(cc) != 3 {
+		t.Errorf("Expected 3 corrections but got %v", len(cc))
+	}
+	err = moved.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if moved.BoxID != 8 {
+		t.Errorf("Expected BoxID = 8 but got %v", moved.BoxID)
+	}
+	if moved.Version != v+1 {
+		t.Errorf("Expected Version = %v but got %v", v+1, moved.Version)
+	}
+	err = lost.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if lost.BoxID != 0 {
+		t.Errorf("Expected BoxID = 0 but got %v", lost.BoxID)
+	}
+	if lost.Retirement != RetirementLost || lost.RetiredBoxID == 0 {
+		t.Errorf("Expected Item to be retired as lost but got %v", lost.ItemRetirement)
+	}
+	err = b2.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if b2.StoreID != 2 {
+		t.Errorf("Expected StoreID = 2 but got %v", b2.StoreID)
+	}
+}
+
+func TestCategoryInsert(t *testing.T) {
+	c := Category{Name: "Funk"}
+	err := c.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	s := Category{Name: "Handfunk", ParentID: c.CategoryID}
+	err = s.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	c.ParentID = s.CategoryID
+	err = c.Update(context.Background())
+	if err == nil {
+		t.Error("Expected error making a category its own grandparent")
+	}
+	o := Category{Name: "Waise", ParentID: 9999}
+	err = o.Insert(context.Background())
+	if err == nil {
+		t.Error("Expected error inserting a category with unknown parent")
+	}
+}
+
+func TestGetCategoryTree(t *testing.T) {
+	c := Category{Name: "Strom"}
+	err := c.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	s := Category{Name: "Kabel", ParentID: c.CategoryID}
+	err = s.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	e := Equipment{Name: "Verlängerung", CategoryID: s.CategoryID}
+	err = e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	for n := 0; n < 2; n++ {
+		i := Item{EquipmentID: e.EquipmentID}
+		err = i.Insert(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+	cn, err := GetCategoryTree(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	var root *CategoryNode
+	for n := range cn {
+		if cn[n].Category.CategoryID == c.CategoryID {
+			root = &cn[n]
+		}
+	}
+	if root == nil {
+		t.Fatalf("Expected category %v in tree", c.CategoryID)
+	}
+	if root.EquipmentCount != 1 || root.ItemCount != 2 {
+		t.Errorf("Expected 1 equipment and 2 items but got %v and %v", root.EquipmentCount, root.ItemCount)
+	}
+	if len(root.Children) != 1 || root.Children[0].ItemCount != 2 {
+		t.Errorf("Expected 1 child with 2 items but got %v", root.Children)
+	}
+	ee, err := c.GetCategoryEquipment(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if len(ee) != 1 {
+		t.Errorf("Expected len = 1 but got %v", len(ee))
+	}
+	err = c.Delete(context.Background())
+	if err == nil {
+		t.Error("Expected error deleting a category with subcategories")
+	}
+}
+
+func TestWishlistCategories(t *testing.T) {
+	w := Wishlist{Name: "Anschaffungen"}
+	err := w.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = w.AddWishlistCategory(context.Background(), Category{CategoryID: 9999})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected not found adding a missing category but got %v", err)
+	}
+	c := Category{CategoryID: 1}
+	err = w.AddWishlistCategory(context.Background(), c)
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	cc, err := w.GetWishlistCategories(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if len(cc) != 1 {
+		t.Errorf("Expected len = 1 but got %v", len(cc))
+	}
+	err = w.RemoveWishlistCategory(context.Background(), c)
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	cc, err = w.GetWishlistCategories(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if len(cc) != 0 {
+		t.Errorf("Expected len = 0 but got %v", len(cc))
+	}
+}
+
+func TestAttributeInsert(t *testing.T) {
+	e := Equipment{Name: "Patchkabel"}
+	err := e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	aa := []Attribute{
+		{EquipmentID: e.EquipmentID, Name: "length", Type: AttributeTypeInt, Required: true},
+		{EquipmentID: e.EquipmentID, Name: "color", Type: AttributeTypeEnum, Options: "blue, red"},
+		{EquipmentID: e.EquipmentID, Name: "mac", Type: AttributeTypeMAC},
+	}
+	for n := range aa {
+		err = aa[n].Insert(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+	d := Attribute{EquipmentID: e.EquipmentID, Name: "length", Type: AttributeTypeString}
+	err = d.Insert(context.Background())
+	if err == nil {
+		t.Error("Expected error inserting a duplicate attribute")
+	}
+	en := Attribute{EquipmentID: e.EquipmentID, Name: "band", Type: AttributeTypeEnum}
+	err = en.Insert(context.Background())
+	if err == nil {
+		t.Error("Expected error inserting an enum without options")
+	}
+}
+
+func TestItemSetAttributes(t *testing.T) {
+	var a Attribute
+	err := db.Where("name = ?", "length").First(&a)
+	if err.Error != nil {
+		t.Fatalf("Expected no error but got %v", err.Error)
+	}
+	lengths := []string{"5", "10", "20"}
+	var ii []Item
+	for _, l := range lengths {
+		i := Item{EquipmentID: a.EquipmentID}
+		err := i.Insert(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		_, err = i.SetAttributes(context.Background(), map[string]string{"length": l, "color": "blue"})
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		ii = append(ii, i)
+	}
+	_, err2 := ii[0].SetAttributes(context.Background(), map[string]string{"length": "long"})
+	if err2 == nil {
+		t.Error("Expected error setting a non integer length")
+	}
+	_, err2 = ii[0].SetAttributes(context.Background(), map[string]string{"color": "green"})
+	if err2 == nil {
+		t.Error("Expected error setting a color outside the enum")
+	}
+	_, err2 = ii[0].SetAttributes(context.Background(), map[string]string{"length": ""})
+	if err2 == nil {
+		t.Error("Expected error removing a required attribute")
+	}
+	ia, err2 := ii[0].SetAttributes(context.Background(), map[string]string{"mac": "00-1A-2B-3C-4D-5E"})
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	for _, v := range ia {
+		if v.Attribute.Name == "mac" && v.Value != "00:1a:2b:3c:4d:5e" {
+			t.Errorf("Expected normalized MAC but got %v", v.Value)
+		}
+	}
+	ile, _, err2 := GetItemsJoinedPage(context.Background(), false, nil, ListQuery{})
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	res, err2 := FilterItemsByAttributes(ile, []AttributeFilter{{Name: "length", Op: ">=", Value: "10"}})
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if len(res) != 2 {
+		t.Errorf("Expected len = 2 but got %v", len(res))
+	}
+	res, err2 = FilterItemsByAttributes(ile, []AttributeFilter{{Name: "length", Op: ">=", Value: "10"}, {Name: "length", Op: "<", Value: "20"}})
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if len(res) != 1 || res[0].ItemID != ii[1].ItemID {
+		t.Errorf("Expected item %v but got %v", ii[1].ItemID, res)
+	}
+}
+
+func TestItemSerialUnique(t *testing.T) {
+	e := Equipment{Name: "Switch", DepreciationYears: 4}
+	err := e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	i := Item{EquipmentID: e.EquipmentID}
+	i.Serial = "SN-1"
+	err = i.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	d := Item{EquipmentID: e.EquipmentID}
+	d.Serial = "SN-1"
+	err = d.Insert(context.Background())
+	if err == nil {
+		t.Error("Expected error inserting a duplicate serial")
+	}
+	err = db.Create(&d).Error
+	if err == nil {
+		t.Error("Expected the index to refuse a duplicate serial")
+	}
+	err = i.Update(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestItemAssetDepreciate(t *testing.T) {
+	a := ItemAsset{PurchaseDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), PurchasePrice: 40000}
+	cases := []struct {
+		years int
+		at    time.Time
+		value int
+	}{
+		{4, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), 40000},
+		{4, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), 20000},
+		{4, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), 0},
+		{0, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), 40000},
+	}
+	for _, c := range cases {
+		v := a.Depreciate(c.years, c.at)
+		if v < c.value-20 || v > c.value+20 {
+			t.Errorf("Expected value %v after %v years but got %v", c.value, c.years, v)
+		}
+	}
+}
+
+func TestGetAssetReport(t *testing.T) {
+	var e Equipment
+	err := db.Where("name = ?", "Switch").First(&e)
+	if err.Error != nil {
+		t.Fatalf("Expected no error but got %v", err.Error)
+	}
+	i := Item{EquipmentID: e.EquipmentID, BoxID: 7}
+	i.PurchaseDate = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	i.PurchasePrice = 40000
+	err2 := i.Insert(context.Background())
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	ar, err2 := GetAssetReport(context.Background(), time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	var ev AssetValue
+	for _, v := range ar.Equipment {
+		if v.ID == e.EquipmentID {
+			ev = v
+		}
+	}
+	if ev.Count != 2 || ev.PurchaseValue != 40000 {
+		t.Errorf("Expected 2 items worth 40000 but got %v", ev)
+	}
+	if ev.CurrentValue < 19980 || ev.CurrentValue > 20020 {
+		t.Errorf("Expected current value 20000 but got %v", ev.CurrentValue)
+	}
+	if ar.PurchaseValue != 40000 {
+		t.Errorf("Expected total purchase value 40000 but got %v", ar.PurchaseValue)
+	}
+}
+
+func TestAttachmentInsert(t *testing.T) {
+	a := Attachment{OwnerType: AttachmentOwnerBox, OwnerID: 7, Filename: "inhalt.jpg", ContentType: "image/jpeg", StorageKey: "box/7/inhalt"}
+	err := a.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	o := Attachment{OwnerType: AttachmentOwnerFault, OwnerID: 9999, Filename: "defekt.jpg"}
+	err = o.Insert(context.Background())
+	if err == nil {
+		t.Error("Expected error attaching to an unknown fault")
+	}
+	u := Attachment{OwnerType: "user", OwnerID: 1}
+	err = u.Insert(context.Background())
+	if err == nil {
+		t.Error("Expected error attaching to an unknown owner type")
+	}
+	aa, err := GetAttachments(context.Background(), AttachmentOwnerBox, 7)
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if len(aa) != 1 {
+		t.Errorf("Expected len = 1 but got %v", len(aa))
+	}
+	err = a.Delete(context.Background())
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestSetStock(t *testing.T) {
+	e := Equipment{Name: "Kabelbinder", Consumable: true, ReorderLevel: 100}
+	err := e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	_, err = SetStock(context.Background(), Stock{EquipmentID: e.EquipmentID, BoxID: 7, StoreID: 2, Quantity: 10})
+	if err == nil {
+		t.Error("Expected error setting stock in a box and a store")
+	}
+	_, err = SetStock(context.Background(), Stock{EquipmentID: 1, StoreID: 2, Quantity: 10})
+	if err == nil {
+		t.Error("Expected error setting stock of a non consumable")
+	}
+	s, err := SetStock(context.Background(), Stock{EquipmentID: e.EquipmentID, BoxID: 7, Quantity: 80})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	s2, err := SetStock(context.Background(), Stock{EquipmentID: e.EquipmentID, BoxID: 7, Quantity: 150})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if s2.StockID != s.StockID {
+		t.Errorf("Expected stock %v to be updated but got %v", s.StockID, s2.StockID)
+	}
+	ls, err := GetLowStock(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	for _, l := range ls {
+		if l.Equipment.EquipmentID == e.EquipmentID {
+			t.Errorf("Expected %v not to be low on stock", e.Name)
+		}
+	}
+}
+
+func TestConsumptionInsert(t *testing.T) {
+	var e Equipment
+	err := db.Where("name = ?", "Kabelbinder").First(&e)
+	if err.Error != nil {
+		t.Fatalf("Expected no error but got %v", err.Error)
+	}
+	c := Consumption{EquipmentID: e.EquipmentID, BoxID: 7, PackinglistID: 2, Quantity: 500}
+	err2 := c.Insert(context.Background())
+	if err2 == nil {
+		t.Error("Expected error consuming more than the stock")
+	}
+	c.Quantity = 60
+	err2 = c.Insert(context.Background())
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if c.EventID == 0 {
+		t.Error("Expected EventID of the packinglist")
+	}
+	cc, err2 := GetConsumptions(context.Background(), 0, 2)
+	if err2 != nil {
+		t.Errorf("Expected no error but got %v", err2)
+	}
+	if len(cc) != 1 {
+		t.Errorf("Expected len = 1 but got %v", len(cc))
+	}
+	ls, err2 := GetLowStock(context.Background())
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if len(ls) != 1 || ls[0].Shortfall != 10 {
+		t.Errorf("Expected a shortfall of 10 but got %v", ls)
+	}
+	w, err2 := GetProcurementWishlist(context.Background())
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	ee, err2 := w.GetWishlistItems(context.Background())
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if len(ee) != 1 || ee[0].EquipmentID != e.EquipmentID {
+		t.Errorf("Expected %v on the procurement wishlist but got %v", e.Name, ee)
+	}
+	e.Consumable = false
+	err2 = e.Update(context.Background())
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	ee, err2 = w.GetWishlistItems(context.Background())
+	if err2 != nil || len(ee) != 0 {
+		t.Errorf("Expected no longer consumable %v to leave the procurement wishlist but got %v, %v", e.Name, ee, err2)
+	}
+	e.Consumable = true
+	err2 = e.Update(context.Background())
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	_, err2 = SetStock(context.Background(), Stock{EquipmentID: e.EquipmentID, StoreID: 2, Quantity: 50})
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	ee, err2 = w.GetWishlistItems(context.Background())
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if len(ee) != 0 {
+		t.Errorf("Expected empty procurement wishlist but got %v", ee)
+	}
+	st := Store{StoreID: 2}
+	ss, err2 := st.GetStoreStock(context.Background())
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if len(ss) != 2 {
+		t.Errorf("Expected len = 2 but got %v", len(ss))
+	}
+}
+
+func TestFaultTransitions(t *testing.T) {
+	var e Equipment
+	err := db.Where("name = ?", "Switch").First(&e)
+	if err.Error != nil {
+		t.Fatalf("Expected no error but got %v", err.Error)
+	}
+	var i Item
+	err = db.Where("equipment_id = ? and box_id = ?", e.EquipmentID, 7).First(&i)
+	if err.Error != nil {
+		t.Fatalf("Expected no error but got %v", err.Error)
+	}
+	f := Fault{ItemID: i.ItemID, Status: FaultStatusNew, Comment: "Port 3 tot", AssigneeID: 9999}
+	err2 := f.InsertBy(context.Background(), 1)
+	if err2 == nil {
+		t.Error("Expected error assigning an unknown user")
+	}
+	f.AssigneeID = 0
+	err2 = f.InsertBy(context.Background(), 1)
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	f.Status = FaultStatusInRepair
+	f.AssigneeID = 1
+	err2 = f.UpdateBy(context.Background(), 1, "Nehme ich mit")
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	f.Status = FaultStatusUnfixable
+	err2 = f.UpdateBy(context.Background(), 1, "")
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	f.Status = FaultStatusNew
+	err2 = f.UpdateBy(context.Background(), 1, "")
+	if err2 == nil {
+		t.Error("Expected error reopening an unfixable fault")
+	}
+	_, err2 = f.AddComment(context.Background(), 1, "Ersatz bestellt")
+	if err2 != nil {
+		t.Errorf("Expected no error but got %v", err2)
+	}
+	fc, err2 := f.GetComments(context.Background())
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if len(fc) != 4 {
+		t.Fatalf("Expected len = 4 but got %v", len(fc))
+	}
+	if fc[1].FromStatus != FaultStatusNew || fc[1].ToStatus != FaultStatusInRepair || fc[1].AssigneeID != 1 {
+		t.Errorf("Expected transition New -> InRepair assigned to 1 but got %v", fc[1])
+	}
+}
+
+func TestGetFaultsFiltered(t *testing.T) {
+	lq := ListQuery{Filters: map[string][]string{"status": {strconv.Itoa(int(FaultStatusUnfixable))}, "assignee_id": {"1"}, "store_id": {"2"}}}
+	ff, _, err := GetFaultsPage(context.Background(), lq)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(ff) != 1 {
+		t.Errorf("Expected len = 1 but got %v", len(ff))
+	}
+	lq = ListQuery{Filters: map[string][]string{"status": {strconv.Itoa(int(FaultStatusNew)), strconv.Itoa(int(FaultStatusInRepair))}, "assignee_id": {"1"}}}
+	ff, _, err = GetFaultsPage(context.Background(), lq)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(ff) != 0 {
+		t.Errorf("Expected len = 0 but got %v", len(ff))
+	}
+}
+
+func TestPackinglistGetSuitableBoxes(t *testing.T) {
+	e := Event{Name: "Congress", Adress: "Hamburg", Start: time.Now().Add(time.Hour * 24 * 30), End: time.Now().Add(time.Hour * 24 * 34)}
+	err := e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	p := Packinglist{Name: "Congress", EventID: e.EventID}
+	err = p.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	bb, err := p.GetSuitableBoxes(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(bb) == 0 {
+		t.Fatal("Expected suitable boxes")
+	}
+	if bb[len(bb)-1].BoxID != 7 || bb[len(bb)-1].UnfixableItems != 1 {
+		t.Errorf("Expected Box 7 with 1 unfixable Item ranked last but got %v", bb[len(bb)-1])
+	}
+	bb, err = p.GetSuitableBoxes(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	for _, b := range bb {
+		if b.BoxID == 7 {
+			t.Error("Expected Box 7 to be hidden")
+		}
+	}
+}
+
+func TestPackinglistRefuseUnfixable(t *testing.T) {
+	var p Packinglist
+	err := db.Where("name = ?", "Congress").First(&p)
+	if err.Error != nil {
+		t.Fatalf("Expected no error but got %v", err.Error)
+	}
+	SetPackingPolicy(global.PackingConfig{RefuseUnfixable: true})
+	err2 := p.AddPackinglistBox(context.Background(), Box{BoxID: 7})
+	SetPackingPolicy(global.PackingConfig{})
+	if _, ok := err2.(*PackingRefusal); !ok {
+		t.Fatalf("Expected PackingRefusal but got %v", err2)
+	}
+	err2 = p.AddPackinglistBox(context.Background(), Box{BoxID: 7})
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	bb, err2 := p.GetPackinglistBoxes(context.Background())
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	flagged := 0
+	for _, b := range bb {
+		for _, i := range b.Items {
+			flagged = flagged + len(i.Faults)
+		}
+	}
+	if flagged != 1 {
+		t.Errorf("Expected 1 flagged Fault but got %v", flagged)
+	}
+}
+
+func TestInspections(t *testing.T) {
+	e := Equipment{Name: "Stromverteiler"}
+	err := e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	it := InspectionType{EquipmentID: e.EquipmentID, Name: "DGUV V3", IntervalDays: 365}
+	err = it.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	var ii []Item
+	for _, d := range []string{"Verteiler A", "Verteiler B"} {
+		b := Box{StoreID: 2, Description: d}
+		err = b.Insert(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		i := Item{EquipmentID: e.EquipmentID, BoxID: b.BoxID}
+		err = i.Insert(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		ii = append(ii, i)
+	}
+	dd, err := GetDueInspections(context.Background(), 2, time.Now())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(dd) != 2 || dd[0].Last != nil || !dd[0].Overdue {
+		t.Fatalf("Expected 2 overdue never inspected Items but got %v", dd)
+	}
+	in := Inspection{ItemID: ii[0].ItemID, InspectionTypeID: it.InspectionTypeID, Tester: "Elektro Meyer", Passed: true, Values: []InspectionValue{{Name: "Isolationswiderstand", Value: "550", Unit: "MOhm"}}}
+	err = in.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	in = Inspection{ItemID: ii[1].ItemID, InspectionTypeID: it.InspectionTypeID, Tester: "Elektro Meyer", Passed: false, Comment: "Schutzleiter unterbrochen"}
+	err = in.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if in.FaultID == 0 {
+		t.Fatal("Expected failed Inspection to open a Fault")
+	}
+	f := Fault{FaultID: in.FaultID}
+	err = f.GetDetails(context.Background())
+	if err != nil || f.ItemID != ii[1].ItemID || f.Status != FaultStatusNew {
+		t.Errorf("Expected new Fault for Item %v but got %v, %v", ii[1].ItemID, f, err)
+	}
+	dd, err = GetDueInspections(context.Background(), 2, time.Now())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(dd) != 1 || dd[0].Item.ItemID != ii[1].ItemID {
+		t.Errorf("Expected failed Item to stay due but got %v", dd)
+	}
+	dd, err = GetDueInspections(context.Background(), 2, time.Now().AddDate(1, 0, 1))
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(dd) != 2 || dd[0].Last == nil || dd[0].Overdue {
+		t.Errorf("Expected passed Item to be due next year but got %v", dd)
+	}
+	ins, err := ii[0].GetInspections(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(ins) != 1 || len(ins[0].Values) != 1 {
+		t.Errorf("Expected 1 Inspection with 1 Value but got %v", ins)
+	}
+	err = it.Delete(context.Background())
+	if err == nil {
+		t.Error("Expected error deleting Inspection type with records")
+	}
+	p := Packinglist{Name: "Inspektion", EventID: 1}
+	err = p.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	SetPackingPolicy(global.PackingConfig{RefuseOverdueInspections: true})
+	err = p.AddPackinglistBox(context.Background(), Box{BoxID: ii[1].BoxID})
+	if _, ok := err.(*PackingRefusal); !ok {
+		t.Errorf("Expected PackingRefusal but got %v", err)
+	}
+	err = p.AddPackinglistBox(context.Background(), Box{BoxID: ii[0].BoxID})
+	SetPackingPolicy(global.PackingConfig{})
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestFaultRepair(t *testing.T) {
+	var f Fault
+	err := db.Where("comment like ?", "Inspection DGUV V3 failed%").First(&f)
+	if err.Error != nil {
+		t.Fatalf("Expected no error but got %v", err.Error)
+	}
+	var kb, sw Equipment
+	err = db.Where("name = ?", "Kabelbinder").First(&kb)
+	if err.Error != nil {
+		t.Fatalf("Expected no error but got %v", err.Error)
+	}
+	err = db.Where("name = ?", "Switch").First(&sw)
+	if err.Error != nil {
+		t.Fatalf("Expected no error but got %v", err.Error)
+	}
+	_, err2 := f.AddPart(context.Background(), FaultPart{EquipmentID: sw.EquipmentID, StoreID: 2, Quantity: 1})
+	if err2 == nil {
+		t.Error("Expected error taking a non consumable from stock")
+	}
+	_, err2 = f.AddPart(context.Background(), FaultPart{EquipmentID: kb.EquipmentID, StoreID: 2, Quantity: 500})
+	if err2 == nil {
+		t.Error("Expected error taking more than the stock")
+	}
+	p, err2 := f.AddPart(context.Background(), FaultPart{EquipmentID: kb.EquipmentID, StoreID: 2, Quantity: 5, UnitPrice: 2})
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	_, err2 = f.AddPart(context.Background(), FaultPart{EquipmentID: sw.EquipmentID, Quantity: 1, UnitPrice: 1500})
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	var s Stock
+	err = db.Where("equipment_id = ? and store_id = ?", kb.EquipmentID, 2).First(&s)
+	if err.Error != nil || s.Quantity != 45 {
+		t.Errorf("Expected 45 left in stock but got %v, %v", s.Quantity, err.Error)
+	}
+	f.LabourMinutes = 30
+	f.Vendor = "Elektro Meyer"
+	f.VendorCost = 4000
+	err2 = f.UpdateBy(context.Background(), 1, "Schutzleiter ersetzt")
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	rs, err2 := GetRepairSpend(context.Background(), time.Time{}, time.Time{})
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if len(rs) == 0 || rs[0].Name != "Stromverteiler" || rs[0].Total != 5510 || rs[0].PerItem != 2755 || rs[0].LabourMinutes != 30 {
+		t.Errorf("Expected Stromverteiler with total 5510 first but got %v", rs)
+	}
+	err2 = f.RemovePart(context.Background(), p.FaultPartID)
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	err = db.Where("equipment_id = ? and store_id = ?", kb.EquipmentID, 2).First(&s)
+	if err.Error != nil || s.Quantity != 50 {
+		t.Errorf("Expected 50 in stock but got %v, %v", s.Quantity, err.Error)
+	}
+	pp, err2 := f.GetParts(context.Background())
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if len(pp) != 1 {
+		t.Errorf("Expected len = 1 but got %v", len(pp))
+	}
+	rs, err2 = GetRepairSpend(context.Background(), time.Now().Add(time.Hour), time.Time{})
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if len(rs) != 0 {
+		t.Errorf("Expected no spend in the future but got %v", rs)
+	}
+}
+
+func TestItemRetire(t *testing.T) {
+	var e Equipment
+	err := db.Where("name = ?", "Switch").First(&e)
+	if err.Error != nil {
+		t.Fatalf("Expected no error but got %v", err.Error)
+	}
+	var i Item
+	err = db.Where("equipment_id = ? and box_id = ?", e.EquipmentID, 7).First(&i)
+	if err.Error != nil {
+		t.Fatalf("Expected no error but got %v", err.Error)
+	}
+	err2 := i.Retire(context.Background(), ItemRetirement{Retirement: RetirementDisposed + 5})
+	if err2 == nil {
+		t.Error("Expected error retiring with unknown type")
+	}
+	err2 = i.Retire(context.Background(), ItemRetirement{Retirement: RetirementSold, RetiredReason: "Port 3 defekt", Proceeds: 2500, RetiredDate: time.Date(2025, time.June, 1, 12, 0, 0, 0, time.Local)})
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if i.BoxID != 0 || i.RetiredBoxID != 7 {
+		t.Errorf("Expected Item taken out of Box 7 but got %v, %v", i.BoxID, i.RetiredBoxID)
+	}
+	err2 = i.Retire(context.Background(), ItemRetirement{Retirement: RetirementLost})
+	if err2 == nil {
+		t.Error("Expected error retiring a retired Item")
+	}
+	err2 = i.SetBox(context.Background(), 7)
+	if err2 == nil {
+		t.Error("Expected error putting a retired Item into a Box")
+	}
+	ii, _, err2 := GetItemsJoinedPage(context.Background(), false, nil, ListQuery{})
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	for _, a := range ii {
+		if a.ItemID == i.ItemID {
+			t.Error("Expected retired Item not to be in the active inventory")
+		}
+	}
+	ff, err2 := i.GetFaults(context.Background())
+	if err2 != nil || len(ff) == 0 {
+		t.Errorf("Expected Faults to stay in the history but got %v, %v", ff, err2)
+	}
+	var p Packinglist
+	err = db.Where("name = ?", "Inspektion").First(&p)
+	if err.Error != nil {
+		t.Fatalf("Expected no error but got %v", err.Error)
+	}
+	bb, err2 := p.GetSuitableBoxes(context.Background(), true)
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	found := false
+	for _, b := range bb {
+		found = found || b.BoxID == 7
+	}
+	if !found {
+		t.Error("Expected Box 7 to be suitable after retiring its unfixable Item")
+	}
+	dr, err2 := GetDisposalReport(context.Background(), 2025)
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if len(dr.Items) != 1 || dr.Proceeds != 2500 || len(dr.Totals) != 1 || dr.Totals[0].Retirement != RetirementSold {
+		t.Errorf("Expected 1 sold Item in 2025 but got %v", dr)
+	}
+	dr, err2 = GetDisposalReport(context.Background(), 2024)
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if len(dr.Items) != 0 {
+		t.Errorf("Expected no Items in 2024 but got %v", dr.Items)
+	}
+	err2 = i.Reinstate(context.Background(), 7)
+	if err2 != nil {
+		t.Fatalf("Expected no error but got %v", err2)
+	}
+	if i.Retired() || i.BoxID != 7 {
+		t.Errorf("Expected Item back in Box 7 but got %v", i)
+	}
+}
+
+func TestStoreDeleteReferences(t *testing.T) {
+	s := Store{Name: "Lager Süd", Adress: "München", ManagerID: 1}
+	err := s.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	b := Box{StoreID: s.StoreID, Description: "Antennen"}
+	err = b.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	e := Equipment{Name: "Richtantenne"}
+	err = e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	i := Item{EquipmentID: e.EquipmentID, BoxID: b.BoxID}
+	err = i.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = s.Delete(context.Background())
+	if _, ok := err.(*ReferenceError); !ok {
+		t.Errorf("Expected ReferenceError but got %v", err)
+	}
+	err = b.Delete(context.Background())
+	if _, ok := err.(*ReferenceError); !ok {
+		t.Errorf("Expected ReferenceError but got %v", err)
+	}
+	err = s.DeleteCascade(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	ni := Item{ItemID: i.ItemID}
+	if ni.GetDetails(context.Background()) == nil {
+		t.Error("Expected Item to be in the trash")
+	}
+	tt, _, err := GetTrashPage(context.Background(), ListQuery{})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	kinds := make(map[string]bool)
+	for _, te := range tt {
+		kinds[te.Kind] = true
+	}
+	if !kinds["store"] || !kinds["box"] || !kinds["item"] {
+		t.Errorf("Expected Store, Box and Item in the trash but got %v", tt)
+	}
+	err = Restore(context.Background(), "box", b.BoxID)
+	if err == nil {
+		t.Error("Expected error restoring a Box of a deleted Store")
+	}
+	err = Restore(context.Background(), "store", s.StoreID)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = ni.GetDetails(context.Background())
+	if err != nil || ni.BoxID != b.BoxID {
+		t.Errorf("Expected Item restored in Box %v but got %v, %v", b.BoxID, ni.BoxID, err)
+	}
+	err = b.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	v := b.Version
+	err = s.DeleteReassign(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = b.GetDetails(context.Background())
+	if err != nil || b.StoreID != 2 {
+		t.Errorf("Expected Box moved to Store 2 but got %v, %v", b.StoreID, err)
+	}
+	if b.Version != v+1 {
+		t.Errorf("Expected Version = %v but got %v", v+1, b.Version)
+	}
+	w := Wishlist{Name: "Weg"}
+	err = w.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = w.AddWishlistItem(context.Background(), Equipment{EquipmentID: 1})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = w.Delete(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	n, err := PurgeTrash(context.Background(), time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if n < 2 {
+		t.Errorf("Expected at least Store and Wishlist purged but got %v", n)
+	}
+	tt, _, err = GetTrashPage(context.Background(), ListQuery{Filters: map[string][]string{"kind": {"store"}}})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(tt) != 0 {
+		t.Errorf("Expected empty trash but got %v", tt)
+	}
+}
+
+func TestPurgeTrashDependents(t *testing.T) {
+	st, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	SetAttachmentStorage(st)
+	defer SetAttachmentStorage(nil)
+	e := Equipment{Name: "Kamera"}
+	err = e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	i := Item{EquipmentID: e.EquipmentID, Description: "Purge"}
+	err = i.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	audited := Item{EquipmentID: e.EquipmentID, Description: "Audited"}
+	err = audited.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = st.Put("purge-file", strings.NewReader("Foto"), 4, "text/plain")
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	a := Attachment{OwnerType: AttachmentOwnerItem, OwnerID: i.ItemID, Filename: "foto.txt", StorageKey: "purge-file"}
+	err = db.Create(&a).Error
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	ae := AuditEntry{AuditID: 9999, ItemID: audited.ItemID, Code: audited.Code}
+	err = db.Create(&ae).Error
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	defer db.Delete(&ae)
+	for _, di := range []Item{i, audited} {
+		err = di.Delete(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+	_, err = PurgeTrash(context.Background(), time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = db.First(&Attachment{}, a.AttachmentID).Error
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected Attachment to be purged but got %v", err)
+	}
+	_, err = st.Get("purge-file")
+	if err != storage.ErrNotFound {
+		t.Errorf("Expected attachment file to be deleted but got %v", err)
+	}
+	tt, _, err := GetTrashPage(context.Background(), ListQuery{Filters: map[string][]string{"kind": {"item"}}})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	kept := make(map[int]bool)
+	for _, te := range tt {
+		kept[te.ID] = true
+	}
+	if !kept[audited.ItemID] || kept[i.ItemID] {
+		t.Errorf("Expected only the audited Item to stay in the trash but got %v", tt)
+	}
+}
+
+func TestListPages(t *testing.T) {
+	for _, n := range []int{100, 300, 200} {
+		v := Vehicle{Name: "Page", Payload: n}
+		err := v.Insert(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+	lq := ListQuery{Limit: 2, Sort: []string{"-payload"}, Filters: map[string][]string{"name": {"Page"}, "payload_from": {"150"}}}
+	vv, p, err := GetVehiclesPage(context.Background(), lq)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if p.Total != 2 || len(vv) != 2 || vv[0].Payload != 300 || vv[1].Payload != 200 || p.NextCursor != "" {
+		t.Errorf("Expected Payloads 300, 200 of 2 but got %v, %+v", vv, p)
+	}
+	lq = ListQuery{Limit: 2, Sort: []string{"payload"}, Filters: map[string][]string{"name": {"Page"}}}
+	vv, p, err = GetVehiclesPage(context.Background(), lq)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if p.Total != 3 || len(vv) != 2 || vv[0].Payload != 100 || p.NextCursor == "" {
+		t.Fatalf("Expected first page of 3 Vehicles but got %v, %+v", vv, p)
+	}
+	lq.Cursor = p.NextCursor
+	vv, p, err = GetVehiclesPage(context.Background(), lq)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(vv) != 1 || vv[0].Payload != 300 || p.NextCursor != "" {
+		t.Errorf("Expected last page with Payload 300 but got %v, %+v", vv, p)
+	}
+	_, _, err = GetVehiclesPage(context.Background(), ListQuery{Filters: map[string][]string{"colour": {"red"}}})
+	if _, ok := err.(*ListQueryError); !ok {
+		t.Errorf("Expected ListQueryError for unknown field but got %v", err)
+	}
+	_, _, err = GetVehiclesPage(context.Background(), ListQuery{Filters: map[string][]string{"payload": {"heavy"}}})
+	if _, ok := err.(*ListQueryError); !ok {
+		t.Errorf("Expected ListQueryError for invalid value but got %v", err)
+	}
+	_, _, err = GetEventsPage(context.Background(), ListQuery{Sort: []string{"-end"}, Filters: map[string][]string{"start_from": {"2000-01-01"}}})
+	if err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	bb, _, err := GetBoxesJoinedPage(context.Background(), ListQuery{})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	_, p, err = GetBoxesJoinedPage(context.Background(), ListQuery{Limit: 1})
+	if err != nil || p.Total != len(bb) {
+		t.Errorf("Expected %v Boxes but got %+v, %v", len(bb), p, err)
+	}
+	st := Store{Name: "Lager Nord", Adress: "Hamburg", ManagerID: 1}
+	err = st.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	b := Box{StoreID: st.StoreID, Description: "Kabel"}
+	err = b.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	e := Equipment{Name: "Schuko"}
+	err = e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	for n := 0; n < 2; n++ {
+		i := Item{EquipmentID: e.EquipmentID, BoxID: b.BoxID}
+		err = i.Insert(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+	ile, p, err := GetItemsJoinedPage(context.Background(), false, nil, ListQuery{Filters: map[string][]string{"store_id": {strconv.Itoa(st.StoreID)}}})
+	if err != nil || p.Total != 2 || len(ile) != 2 || ile[0].EquipmentName != "Schuko" {
+		t.Errorf("Expected 2 Items in Store %v but got %v of %+v, %v", st.StoreID, ile, p, err)
+	}
+	ff, _, err := GetFaultsPage(context.Background(), ListQuery{Filters: map[string][]string{"status": {"0", "1"}}})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	_, p, err = GetFaultsPage(context.Background(), ListQuery{Filters: map[string][]string{"status": {"0,1"}}})
+	if err != nil || p.Total != len(ff) {
+		t.Errorf("Expected %v Faults but got %+v, %v", len(ff), p, err)
+	}
+}
+
+var benchmarkStore Store
+
+// seedBenchmark fills a store with 50 boxes of 20 items each for the listing benchmarks.
+func seedBenchmark(b *testing.B) {
+	if benchmarkStore.StoreID != 0 {
+		return
+	}
+	benchmarkStore = Store{Name: "Benchmark", Adress: "Benchmark", ManagerID: 1}
+	err := benchmarkStore.Insert(context.Background())
+	if err != nil {
+		b.Fatalf("Expected no error but got %v", err)
+	}
+	e := Equipment{Name: "Benchmark"}
+	err = e.Insert(context.Background())
+	if err != nil {
+		b.Fatalf("Expected no error but got %v", err)
+	}
+	tx := db.Begin()
+	for n := 0; n < 50; n++ {
+		bx := Box{StoreID: benchmarkStore.StoreID, Description: "Benchmark"}
+		err2 := tx.Create(&bx)
+		if err2.Error != nil {
+			tx.Rollback()
+			b.Fatalf("Expected no error but got %v", err2.Error)
+		}
+		for m := 0; m < 20; m++ {
+			err2 = tx.Create(&Item{BoxID: bx.BoxID, EquipmentID: e.EquipmentID})
+			if err2.Error != nil {
+				tx.Rollback()
+				b.Fatalf("Expected no error but got %v", err2.Error)
+			}
+		}
+	}
+	tx.Commit()
+}
+
+func BenchmarkItemsJoined(b *testing.B) {
+	seedBenchmark(b)
+	lq := ListQuery{Filters: map[string][]string{"store_id": {strconv.Itoa(benchmarkStore.StoreID)}}}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		ile, _, err := GetItemsJoinedPage(context.Background(), false, nil, lq)
+		if err != nil || len(ile) != 1000 {
+			b.Fatalf("Expected 1000 Items but got %v, %v", len(ile), err)
+		}
+	}
+}
+
+// BenchmarkItemsJoinedPerItem loads the same items with one query per item, box and equipment
+// as the listing did before the join.
+func BenchmarkItemsJoinedPerItem(b *testing.B) {
+	seedBenchmark(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var ii []Item
+		err := db.Where("box_id in (select box_id from boxes where store_id = ?)", benchmarkStore.StoreID).Find(&ii)
+		if err.Error != nil || len(ii) != 1000 {
+			b.Fatalf("Expected 1000 Items but got %v, %v", len(ii), err.Error)
+		}
+		for _, i := range ii {
+			err2 := i.GetDetails(context.Background())
+			if err2 != nil {
+				b.Fatalf("Expected no error but got %v", err2)
+			}
+			_, err2 = DefaultRepositories().Boxes.GetFull(context.Background(), i.BoxID)
+			if err2 != nil {
+				b.Fatalf("Expected no error but got %v", err2)
+			}
+			e := Equipment{EquipmentID: i.EquipmentID}
+			err2 = e.GetDetails(context.Background())
+			if err2 != nil {
+				b.Fatalf("Expected no error but got %v", err2)
+			}
+		}
+	}
+}
+
+func BenchmarkBoxItemsJoined(b *testing.B) {
+	seedBenchmark(b)
+	bb, err := benchmarkStore.GetStoreBoxes(context.Background())
+	if err != nil || len(bb) == 0 {
+		b.Fatalf("Expected Boxes but got %v, %v", bb, err)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		ile, err := DefaultRepositories().Boxes.Items(context.Background(), bb[n%len(bb)].BoxID)
+		if err != nil || len(ile) != 20 {
+			b.Fatalf("Expected 20 Items but got %v, %v", len(ile), err)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	e := Equipment{Name: "Pelican Case gelb"}
+	err := e.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	st := Store{Name: "Lager Ost", Adress: "Berlin", ManagerID: 1}
+	err = st.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	b := Box{StoreID: st.StoreID, Description: "DECT Basisstationen"}
+	err = b.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	i := Item{EquipmentID: e.EquipmentID, BoxID: b.BoxID, Description: "gelber Pelican mit DECT Handteilen"}
+	err = i.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	rr, err := Search(context.Background(), "pelican dect", "", 0)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(rr) != 1 || rr[0].Kind != "item" || rr[0].ID != i.ItemID {
+		t.Errorf("Expected Item %v but got %v", i.ItemID, rr)
+	}
+	rr, err = Search(context.Background(), "dect basis", "box", 0)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(rr) != 1 || rr[0].ID != b.BoxID {
+		t.Errorf("Expected Box %v but got %v", b.BoxID, rr)
+	}
+	rr, err = Search(context.Background(), "peli", "", 0)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if len(rr) != 2 {
+		t.Errorf("Expected Equipment and Item but got %v", rr)
+	}
+	b.Description = "Funkgeräte"
+	err = b.Update(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	rr, err = Search(context.Background(), "basisstationen", "", 0)
+	if err != nil || len(rr) != 0 {
+		t.Errorf("Expected no results after update but got %v, %v", rr, err)
+	}
+	rr, err = Search(context.Background(), "funkgeräte", "box", 0)
+	if err != nil || len(rr) != 1 {
+		t.Errorf("Expected updated Box but got %v, %v", rr, err)
+	}
+	f := Fault{ItemID: i.ItemID, Status: FaultStatusNew, Comment: "Akku vom Handteil aufgebläht"}
+	err = f.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	rr, err = Search(context.Background(), "akku", "fault", 0)
+	if err != nil || len(rr) != 1 || rr[0].ID != f.FaultID {
+		t.Errorf("Expected Fault %v but got %v, %v", f.FaultID, rr, err)
+	}
+	err = i.Delete(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	rr, err = Search(context.Background(), "handteilen", "", 0)
+	if err != nil || len(rr) != 0 {
+		t.Errorf("Expected deleted Item hidden but got %v, %v", rr, err)
+	}
+	_, err = Search(context.Background(), " ,; ", "", 0)
+	if err == nil {
+		t.Error("Expected error for empty query")
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	st := Store{Name: "Lager Süd", Adress: "München", ManagerID: 1}
+	err := st.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	var b Box
+	err = TransactionContext(context.Background(), func(u *UnitOfWork) error {
+		b = Box{StoreID: st.StoreID, Description: "Verworfen", Weight: 3}
+		err := u.InsertBox(&b)
+		if err != nil {
+			return err
+		}
+		return errors.New("Abort")
+	})
+	if err == nil || err.Error() != "Abort" {
+		t.Fatalf("Expected Abort but got %v", err)
+	}
+	b2 := Box{BoxID: b.BoxID}
+	err = b2.GetDetails(context.Background())
+	if err == nil {
+		t.Errorf("Expected rolled back Box %v to be missing", b.BoxID)
+	}
+	var p Packinglist
+	err = TransactionContext(context.Background(), func(u *UnitOfWork) error {
+		b = Box{StoreID: st.StoreID, Description: "Übernommen", Weight: 5}
+		err := u.InsertBox(&b)
+		if err != nil {
+			return err
+		}
+		p = Packinglist{Name: "Transaktion", EventID: 1}
+		err = u.InsertPackinglist(&p)
+		if err != nil {
+			return err
+		}
+		return u.AddPackinglistBox(&p, b)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	b2 = Box{BoxID: b.BoxID}
+	err = b2.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if b2.Code == 0 {
+		t.Error("Expected Box code to be set")
+	}
+	p2 := Packinglist{PackinglistID: p.PackinglistID}
+	err = p2.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if p2.Weight != 5 {
+		t.Errorf("Expected weight 5 but got %v", p2.Weight)
+	}
+}
+
+func testRepositories(t *testing.T, repo Repositories) {
+	ctx := context.Background()
+	b := Box{StoreID: 1, Description: "Repository", Weight: 2, Items: []Item{
+		{EquipmentID: 1, Description: "Erstes", ItemAsset: ItemAsset{Serial: "R-1"}},
+		{EquipmentID: 1, Description: "Zweites"},
+	}}
+	err := repo.Boxes.Insert(ctx, &b)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if b.Code == 0 || len(b.Items) != 2 || b.Items[0].BoxID != b.BoxID || b.Items[1].Code == 0 {
+		t.Fatalf("Expected Box with two coded Items but got %v", b)
+	}
+	bad := Box{Description: "Doppelt", Items: []Item{{EquipmentID: 1, ItemAsset: ItemAsset{Serial: "R-1"}}}}
+	err = repo.Boxes.Insert(ctx, &bad)
+	if err == nil {
+		t.Error("Expected duplicate serial to be refused")
+	}
+	bb, p, err := repo.Boxes.List(ctx, ListQuery{})
+	if err != nil || len(bb) != 1 || p.Total != 1 {
+		t.Fatalf("Expected one Box but got %v, %v, %v", bb, p, err)
+	}
+	ii, err := repo.Boxes.Items(ctx, b.BoxID)
+	if err != nil || len(ii) != 2 || ii[0].BoxDescription != "Repository" {
+		t.Fatalf("Expected two Box Items but got %v, %v", ii, err)
+	}
+	err = repo.Boxes.Delete(ctx, b.BoxID)
+	if _, ok := err.(*ReferenceError); !ok {
+		t.Errorf("Expected ReferenceError but got %v", err)
+	}
+	for _, i := range b.Items {
+		err = repo.Items.SetBox(ctx, i.ItemID, 0)
+		if err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+	ile, p, err := repo.Items.List(ctx, true, nil, ListQuery{Limit: 1})
+	if err != nil || len(ile) != 1 || p.Total != 2 || p.NextCursor == "" {
+		t.Errorf("Expected first of two storeless Items but got %v, %v, %v", ile, p, err)
+	}
+	i, err := repo.Items.Get(ctx, b.Items[0].ItemID)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	i.Description = "Geändert"
+	err = repo.Items.Update(ctx, &i)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	ie, err := repo.Items.GetFull(ctx, i.ItemID)
+	if err != nil || ie.ItemDescription != "Geändert" || ie.BoxID != 0 {
+		t.Errorf("Expected updated Item but got %v, %v", ie, err)
+	}
+	i, err = repo.Items.Retire(ctx, i.ItemID, ItemRetirement{Retirement: RetirementLost, RetiredReason: "Verloren"})
+	if err != nil || !i.Retired() || i.RetiredDate.IsZero() {
+		t.Fatalf("Expected retired Item but got %v, %v", i, err)
+	}
+	_, err = repo.Items.Retire(ctx, i.ItemID, ItemRetirement{Retirement: RetirementLost})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected conflict for retired Item but got %v", err)
+	}
+	ri, err := repo.Items.Retired(ctx, i.RetiredDate.Year())
+	if err != nil || len(ri) != 1 || ri[0].ItemID != i.ItemID {
+		t.Errorf("Expected one retired Item but got %v, %v", ri, err)
+	}
+	_, err = repo.Items.Reinstate(ctx, i.ItemID, 9999)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected missing Box but got %v", err)
+	}
+	i, err = repo.Items.Reinstate(ctx, i.ItemID, 0)
+	if err != nil || i.Retired() {
+		t.Errorf("Expected reinstated Item but got %v, %v", i, err)
+	}
+	err = repo.Boxes.Delete(ctx, b.BoxID)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	_, err = repo.Boxes.Get(ctx, b.BoxID)
+	if err == nil {
+		t.Error("Expected deleted Box to be missing")
+	}
+	_, err = repo.Boxes.GetFull(ctx, b.BoxID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleted Box to be not found but got %v", err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = repo.Items.Get(cancelled, i.ItemID)
+	if err == nil {
+		t.Error("Expected error for cancelled context")
+	}
+}
+
+func TestMemoryRepositories(t *testing.T) {
+	testRepositories(t, NewMemoryRepositories())
+}
+
+func TestGormRepositories(t *testing.T) {
+	con := global.DBConnection{Driver: "sqlite3", Connection: "./test-repository.db"}
+	os.Remove(con.Connection)
+	defer os.Remove(con.Connection)
+	d, err := Open(&con)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	defer d.Close()
+	// The boxes and items of the contract reference store 1 and equipment 1
+	err = d.Create(&User{Username: "Lagerist"}).Error
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = d.Create(&Store{Name: "Repository", ManagerID: 1}).Error
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = d.Create(&Equipment{Name: "Funkgerät"}).Error
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	testRepositories(t, NewGormRepositories(d))
+	bb, _, err := GetBoxesJoinedPage(context.Background(), ListQuery{})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	for _, b := range bb {
+		if b.Description == "Repository" {
+			t.Errorf("Expected the package database to be unchanged but got %v", b)
+		}
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := GetItemsJoinedPage(ctx, false, nil, ListQuery{})
+	if err == nil {
+		t.Error("Expected error for cancelled item list")
+	}
+	_, err = Search(ctx, "dect", "", 0)
+	if err == nil {
+		t.Error("Expected error for cancelled search")
+	}
+	st := Store{Name: "Abgebrochen", Adress: "Hamburg", ManagerID: 1}
+	err = TransactionContext(ctx, func(u *UnitOfWork) error {
+		return u.tx.Create(&st).Error
+	})
+	if err == nil {
+		t.Error("Expected error for cancelled transaction")
+	}
+	ss, _, err := GetStoresPage(context.Background(), ListQuery{Filters: map[string][]string{"name": {"Abgebrochen"}}})
+	if err != nil || len(ss) != 0 {
+		t.Errorf("Expected no Store but got %v, %v", ss, err)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	s := Store{Name: "Versionslager", Adress: "Berlin", ManagerID: 1}
+	err := s.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	b := Box{StoreID: s.StoreID, Description: "Versioniert"}
+	err = b.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if b.Version != 1 {
+		t.Errorf("Expected version 1 after insert but got %v", b.Version)
+	}
+	stale := Box{BoxID: b.BoxID}
+	err = stale.GetDetails(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	b.Weight = 7
+	err = b.Update(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if b.Version != 2 {
+		t.Errorf("Expected version 2 after update but got %v", b.Version)
+	}
+	stale.Weight = 9
+	err = stale.Update(context.Background())
+	if _, ok := err.(*VersionConflict); !ok {
+		t.Fatalf("Expected VersionConflict but got %v", err)
+	}
+	b2 := Box{BoxID: b.BoxID}
+	err = b2.GetDetails(context.Background())
+	if err != nil || b2.Weight != 7 || b2.Version != 2 {
+		t.Errorf("Expected weight 7 at version 2 but got %v, %v", b2, err)
+	}
+	unversioned := Box{BoxID: b.BoxID, StoreID: s.StoreID, Description: "Versioniert", Weight: 8}
+	err = unversioned.Update(context.Background())
+	if err != nil || unversioned.Version != 3 {
+		t.Errorf("Expected version 3 but got %v, %v", unversioned.Version, err)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	b := Box{StoreID: 9999, Description: "Ohne Lager", Weight: -1}
+	err := b.Insert(context.Background())
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected ValidationError but got %v", err)
+	}
+	if len(ve.Fields) != 2 || ve.Fields[0].Field != "StoreID" || ve.Fields[0].Code != ViolationReference || ve.Fields[1].Code != ViolationMin {
+		t.Errorf("Expected StoreID and Weight violations but got %v", ve.Fields)
+	}
+	b = Box{Description: "Ohne Lager"}
+	err = b.Insert(context.Background())
+	ve, ok = err.(*ValidationError)
+	if !ok || ve.Fields[0].Field != "StoreID" || ve.Fields[0].Code != ViolationRequired {
+		t.Errorf("Expected StoreID to be required but got %v", err)
+	}
+	i := Item{Description: "Ohne Equipment"}
+	err = i.Insert(context.Background())
+	ve, ok = err.(*ValidationError)
+	if !ok || ve.Fields[0].Field != "EquipmentID" || ve.Fields[0].Code != ViolationRequired {
+		t.Errorf("Expected EquipmentID to be required but got %v", err)
+	}
+
+	e := Event{Name: "Rückwärts", Start: time.Now(), End: time.Now().Add(-time.Hour)}
+	err = e.Insert(context.Background())
+	ve, ok = err.(*ValidationError)
+	if !ok || ve.Fields[0].Field != "End" || ve.Fields[0].Code != ViolationOrder {
+		t.Errorf("Expected End violation but got %v", err)
+	}
+
+	p := Packinglist{Name: "Ohne Event", EventID: 9999}
+	err = p.Insert(context.Background())
+	ve, ok = err.(*ValidationError)
+	if !ok || ve.Fields[0].Field != "EventID" || ve.Fields[0].Code != ViolationReference {
+		t.Errorf("Expected EventID violation but got %v", err)
+	}
+
+	s := Store{Name: "Validiert", Adress: "Hamburg", ManagerID: 1}
+	err = s.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	s.Name = ""
+	err = s.Update(context.Background())
+	ve, ok = err.(*ValidationError)
+	if !ok || ve.Fields[0].Field != "Name" || ve.Fields[0].Code != ViolationRequired {
+		t.Errorf("Expected Name violation but got %v", err)
+	}
+	ss, _, err := GetStoresPage(context.Background(), ListQuery{Filters: map[string][]string{"name": {"Validiert"}}})
+	if err != nil || len(ss) != 1 || ss[0].Version != 1 {
+		t.Errorf("Expected unchanged Store but got %v, %v", ss, err)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	s := Store{StoreID: 99999}
+	err := s.GetDetails(context.Background())
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound but got %v", err)
+	}
+	c := Category{Name: "Funk", ParentID: 99999}
+	err = c.Insert(context.Background())
+	if !errors.Is(err, ErrConstraint) || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrConstraint but got %v", err)
+	}
+	p := Category{Name: "Antennen"}
+	err = p.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	c = Category{Name: "Richtantennen", ParentID: p.CategoryID}
+	err = c.Insert(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	err = p.Delete(context.Background())
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict but got %v", err)
+	}
+	err = (&ValidationError{Entity: "Box"})
+	if !errors.Is(err, ErrConstraint) {
+		t.Errorf("Expected ValidationError to be ErrConstraint")
+	}
+	err = (&ReferenceError{Entity: "Store"})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ReferenceError to be ErrConflict")
+	}
+}